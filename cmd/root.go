@@ -6,6 +6,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	stdlog "log"
 	"os"
@@ -15,6 +16,7 @@ import (
 	"github.com/circonus-labs/circonus-agent/internal/agent"
 	"github.com/circonus-labs/circonus-agent/internal/config"
 	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/circonus-labs/circonus-agent/internal/plugins"
 	"github.com/circonus-labs/circonus-agent/internal/release"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -72,6 +74,47 @@ in JSON format.`,
 	},
 }
 
+// pluginCmd groups plugin related subcommands
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Plugin utilities",
+}
+
+// pluginTestCmd runs a single plugin and reports how its output was parsed
+var pluginTestCmd = &cobra.Command{
+	Use:   "test <path|name>",
+	Short: "Run a single plugin and show the parsed metrics",
+	Long: `Run a single plugin, the same way the agent would, and show the
+metrics parsed from its output (with stream tags), every rejected
+line of output with the reason it was rejected, and its stderr.
+The plugin can be specified by path or by name, a name is found
+in the plugin directory (and its subdirectories with --plugin-recursive).`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		timeout, err := cmd.Flags().GetDuration("long-running-timeout")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		// everything of interest is in the report
+		if !viper.GetBool(config.KeyDebug) {
+			zerolog.SetGlobalLevel(zerolog.Disabled)
+		}
+
+		p, err := plugins.New(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: initializing plugins: %s\n", err)
+			os.Exit(1)
+		}
+
+		if err := p.Test(args[0], timeout, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
 func init() {
 	zerolog.TimeFieldFormat = time.RFC3339Nano
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
@@ -83,6 +126,10 @@ func init() {
 
 	cobra.OnInitialize(initConfig)
 
+	RootCmd.AddCommand(pluginCmd)
+	pluginCmd.AddCommand(pluginTestCmd)
+	pluginTestCmd.Flags().Duration("long-running-timeout", defaults.PluginTestLongRunningTimeout, "Stop a long running plugin after timeout and report its output so far (0s runs it until it exits or is interrupted)")
+
 	desc := func(desc, env string) string {
 		return fmt.Sprintf("[ENV: %s] %s", env, desc)
 	}
@@ -127,6 +174,33 @@ func init() {
 		viper.SetDefault(key, defaults.Collectors)
 	}
 
+	{
+		const (
+			key         = config.KeyCollectorCategories
+			longOpt     = "collector-categories"
+			envVar      = release.ENVPREFIX + "_COLLECTOR_CATEGORIES"
+			description = "List of builtin collector categories (<collector>=<category>), overrides default categories"
+		)
+
+		RootCmd.Flags().StringSlice(longOpt, []string{}, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+	}
+
+	{
+		const (
+			key         = config.KeyCollectorCategoryTags
+			longOpt     = "collector-category-tags"
+			envVar      = release.ENVPREFIX + "_COLLECTOR_CATEGORY_TAGS"
+			description = "Add a collector:<category> stream tag to builtin collector metrics"
+		)
+
+		RootCmd.Flags().Bool(longOpt, defaults.CollectorCategoryTags, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+		viper.SetDefault(key, defaults.CollectorCategoryTags)
+	}
+
 	{
 		const (
 			key         = config.KeyListenSocket
@@ -141,6 +215,19 @@ func init() {
 		viper.BindEnv(key, envVar)
 	}
 
+	{
+		const (
+			key         = config.KeyAdminSocket
+			longOpt     = "admin-socket"
+			envVar      = release.ENVPREFIX + "_ADMIN_SOCKET"
+			description = "Unix socket to create for the admin API (list, enable, disable, reload builtin collectors and plugins)"
+		)
+
+		RootCmd.Flags().String(longOpt, "", desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+	}
+
 	{
 		const (
 			key         = config.KeyPluginDir
@@ -150,8 +237,8 @@ func init() {
 			description = "Plugin directory"
 		)
 
-		RootCmd.Flags().StringP(longOpt, shortOpt, defaults.PluginPath, desc(description, envVar))
-		viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt))
+		RootCmd.PersistentFlags().StringP(longOpt, shortOpt, defaults.PluginPath, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
 		viper.BindEnv(key, envVar)
 		viper.SetDefault(key, defaults.PluginPath)
 	}
@@ -164,12 +251,135 @@ func init() {
 			description = "Default plugin TTL units"
 		)
 
-		RootCmd.Flags().String(longOpt, defaults.PluginTTLUnits, desc(description, envVar))
-		viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt))
+		RootCmd.PersistentFlags().String(longOpt, defaults.PluginTTLUnits, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
 		viper.BindEnv(key, envVar)
 		viper.SetDefault(key, defaults.PluginTTLUnits)
 	}
 
+	{
+		const (
+			key         = config.KeyPluginHistorySize
+			longOpt     = "plugin-history-size"
+			envVar      = release.ENVPREFIX + "_PLUGIN_HISTORY_SIZE"
+			description = "Number of stderr lines and runs to retain for each plugin"
+		)
+
+		RootCmd.PersistentFlags().Int(longOpt, defaults.PluginHistorySize, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+		viper.SetDefault(key, defaults.PluginHistorySize)
+	}
+
+	{
+		const (
+			key         = config.KeyPluginLivenessTimeout
+			longOpt     = "plugin-liveness-timeout"
+			envVar      = release.ENVPREFIX + "_PLUGIN_LIVENESS_TIMEOUT"
+			description = "Restart a supervised long running plugin if no output is received within timeout (0s disables)"
+		)
+
+		RootCmd.PersistentFlags().String(longOpt, defaults.PluginLivenessTimeout, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+		viper.SetDefault(key, defaults.PluginLivenessTimeout)
+	}
+
+	{
+		const (
+			key         = config.KeyPluginLongRunning
+			longOpt     = "plugin-long-running"
+			envVar      = release.ENVPREFIX + "_PLUGIN_LONG_RUNNING"
+			description = "List of long running plugins to supervise"
+		)
+
+		RootCmd.PersistentFlags().StringSlice(longOpt, []string{}, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+	}
+
+	{
+		const (
+			key         = config.KeyPluginMaxConcurrency
+			longOpt     = "plugin-max-concurrency"
+			envVar      = release.ENVPREFIX + "_PLUGIN_MAX_CONCURRENCY"
+			description = "Maximum number of plugins to run at the same time (0 is unlimited)"
+		)
+
+		RootCmd.PersistentFlags().Int(longOpt, defaults.PluginMaxConcurrency, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+		viper.SetDefault(key, defaults.PluginMaxConcurrency)
+	}
+
+	{
+		const (
+			key         = config.KeyPluginPriorities
+			longOpt     = "plugin-priorities"
+			envVar      = release.ENVPREFIX + "_PLUGIN_PRIORITIES"
+			description = "List of plugin run priorities (<plugin>=<priority>), higher priority plugins run first"
+		)
+
+		RootCmd.PersistentFlags().StringSlice(longOpt, []string{}, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+	}
+
+	{
+		const (
+			key         = config.KeyPluginRecursive
+			longOpt     = "plugin-recursive"
+			envVar      = release.ENVPREFIX + "_PLUGIN_RECURSIVE"
+			description = "Scan plugin directory recursively, plugins in subdirectories are namespaced (e.g. mysql`replication)"
+		)
+
+		RootCmd.PersistentFlags().Bool(longOpt, defaults.PluginRecursive, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+		viper.SetDefault(key, defaults.PluginRecursive)
+	}
+
+	{
+		const (
+			key         = config.KeyPluginStalePolicies
+			longOpt     = "plugin-stale-policies"
+			envVar      = release.ENVPREFIX + "_PLUGIN_STALE_POLICIES"
+			description = "List of per-plugin stale metric policies (<plugin>=<policy>)"
+		)
+
+		RootCmd.PersistentFlags().StringSlice(longOpt, []string{}, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+	}
+
+	{
+		const (
+			key         = config.KeyPluginStalePolicy
+			longOpt     = "plugin-stale-policy"
+			envVar      = release.ENVPREFIX + "_PLUGIN_STALE_POLICY"
+			description = "Default stale metric policy [(keep|expire:<duration>|failures:<count>|null)]"
+		)
+
+		RootCmd.PersistentFlags().String(longOpt, defaults.PluginStalePolicy, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+		viper.SetDefault(key, defaults.PluginStalePolicy)
+	}
+
+	{
+		const (
+			key         = config.KeyPluginStderrLogLevel
+			longOpt     = "plugin-stderr-log-level"
+			envVar      = release.ENVPREFIX + "_PLUGIN_STDERR_LOG_LEVEL"
+			description = "Log level to forward plugin stderr [(error|warn|info|debug|disabled)]"
+		)
+
+		RootCmd.PersistentFlags().String(longOpt, defaults.PluginStderrLogLevel, desc(description, envVar))
+		viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt))
+		viper.BindEnv(key, envVar)
+		viper.SetDefault(key, defaults.PluginStderrLogLevel)
+	}
+
 	//
 	// Reverse mode
 	//
@@ -0,0 +1,139 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package builtins
+
+import (
+	"sort"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	appstats "github.com/maier/go-appstats"
+	"github.com/pkg/errors"
+)
+
+// List returns the state of the builtin collectors, enabled and disabled
+func (b *Builtins) List() []CollectorState {
+	b.Lock()
+	defer b.Unlock()
+
+	states := make([]CollectorState, 0, len(b.collectors)+len(b.disabled))
+	for id := range b.collectors {
+		states = append(states, CollectorState{ID: id, Name: b.names[id], Category: b.category(id), Enabled: true})
+	}
+	for id := range b.disabled {
+		states = append(states, CollectorState{ID: id, Name: b.names[id], Category: b.category(id), Enabled: false})
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].ID < states[j].ID })
+
+	return states
+}
+
+// Enable a builtin collector which was disabled. A builtin collector which
+// was not configured at startup (see --collectors) is created by name, reading
+// its config file, and enabled.
+func (b *Builtins) Enable(id string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.collectors[id]; ok {
+		return nil // already enabled
+	}
+
+	c, ok := b.disabled[id]
+	if ok {
+		delete(b.disabled, id)
+	} else {
+		nc, err := b.newCollector(id)
+		if err != nil {
+			if errors.Cause(err) == collector.ErrUnknownCollector {
+				return errors.Wrap(ErrNotFound, id)
+			}
+			return errors.Wrapf(err, "enabling %s", id)
+		}
+		name := id
+		id = nc.ID()
+		if _, exists := b.names[id]; exists {
+			return errors.Errorf("unable to enable %s, id (%s) is already in use", name, id)
+		}
+		b.names[id] = name
+		c = nc
+	}
+
+	b.collectors[id] = c
+	appstats.MapIncrementInt("builtins", "total")
+	b.logger.Info().Str("id", id).Msg("enabled builtin")
+
+	return nil
+}
+
+// Disable a builtin collector, it will not be run and its metrics
+// will not be flushed until it is enabled again
+func (b *Builtins) Disable(id string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.disabled[id]; ok {
+		return nil // already disabled
+	}
+
+	c, ok := b.collectors[id]
+	if !ok {
+		return errors.Wrap(ErrNotFound, id)
+	}
+
+	delete(b.collectors, id)
+	b.disabled[id] = c
+	appstats.MapAddInt("builtins", "total", -1)
+	b.logger.Info().Str("id", id).Msg("disabled builtin")
+
+	return nil
+}
+
+// Reload re-creates a builtin collector, reading its config file again. The
+// collector keeps its enabled/disabled state. If the id was changed in the
+// config file, the collector is replaced by one with the new id.
+func (b *Builtins) Reload(id string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	_, enabled := b.collectors[id]
+	_, disabled := b.disabled[id]
+	if !enabled && !disabled {
+		return errors.Wrap(ErrNotFound, id)
+	}
+
+	name, ok := b.names[id]
+	if !ok {
+		return errors.Errorf("unable to reload %s, unknown collector name", id)
+	}
+
+	c, err := b.newCollector(name)
+	if err != nil {
+		return errors.Wrapf(err, "reloading %s", id)
+	}
+
+	newID := c.ID()
+	if newID != id {
+		if _, exists := b.names[newID]; exists {
+			return errors.Errorf("unable to reload %s, new id (%s) is already in use", id, newID)
+		}
+	}
+
+	delete(b.collectors, id)
+	delete(b.disabled, id)
+	delete(b.names, id)
+
+	if enabled {
+		b.collectors[newID] = c
+	} else {
+		b.disabled[newID] = c
+	}
+	b.names[newID] = name
+
+	b.logger.Info().Str("id", newID).Str("name", name).Bool("enabled", enabled).Msg("reloaded builtin")
+
+	return nil
+}
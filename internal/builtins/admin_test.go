@@ -0,0 +1,138 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package builtins
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+func TestAdmin(t *testing.T) {
+	t.Log("Testing admin (List/Enable/Disable/Reload)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	b, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	b.collectors = make(map[string]collector.Collector)
+	b.collectors["foo"] = newFoo()
+	b.names["foo"] = "foo"
+
+	t.Log("list")
+	{
+		states := b.List()
+		if len(states) != 1 {
+			t.Fatalf("expected 1 collector, got %#v", states)
+		}
+		if !states[0].Enabled || states[0].ID != "foo" {
+			t.Fatalf("expected foo enabled, got %#v", states[0])
+		}
+	}
+
+	t.Log("disable")
+	{
+		if err := b.Disable("foo"); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if b.IsBuiltin("foo") {
+			t.Fatal("expected foo to not be an active builtin")
+		}
+		states := b.List()
+		if len(states) != 1 || states[0].Enabled {
+			t.Fatalf("expected foo disabled, got %#v", states)
+		}
+		if err := b.Disable("foo"); err != nil {
+			t.Fatalf("expected NO error (already disabled), got (%s)", err)
+		}
+	}
+
+	t.Log("enable")
+	{
+		if err := b.Enable("foo"); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !b.IsBuiltin("foo") {
+			t.Fatal("expected foo to be an active builtin")
+		}
+	}
+
+	t.Log("not found")
+	{
+		if err := b.Enable("bar"); errors.Cause(err) != ErrNotFound {
+			t.Fatalf("expected (%s) got (%v)", ErrNotFound, err)
+		}
+		if err := b.Disable("bar"); errors.Cause(err) != ErrNotFound {
+			t.Fatalf("expected (%s) got (%v)", ErrNotFound, err)
+		}
+		if err := b.Reload("bar"); errors.Cause(err) != ErrNotFound {
+			t.Fatalf("expected (%s) got (%v)", ErrNotFound, err)
+		}
+	}
+
+	t.Log("reload (unknown collector)")
+	{
+		if err := b.Reload("foo"); err == nil {
+			t.Fatal("expected error")
+		}
+		if !b.IsBuiltin("foo") {
+			t.Fatal("expected foo to still be an active builtin")
+		}
+	}
+
+	if runtime.GOOS == "linux" {
+		t.Log("reload (procfs collector, keeps disabled state)")
+		{
+			c, err := b.newCollector("loadavg")
+			if err != nil {
+				t.Fatalf("expected NO error, got (%s)", err)
+			}
+			b.collectors[c.ID()] = c
+			b.names[c.ID()] = "loadavg"
+			if err := b.Disable(c.ID()); err != nil {
+				t.Fatalf("expected NO error, got (%s)", err)
+			}
+			if err := b.Reload(c.ID()); err != nil {
+				t.Fatalf("expected NO error, got (%s)", err)
+			}
+			if b.IsBuiltin(c.ID()) {
+				t.Fatal("expected reloaded collector to remain disabled")
+			}
+			if _, ok := b.disabled[c.ID()]; !ok {
+				t.Fatal("expected reloaded collector in disabled list")
+			}
+		}
+
+		t.Log("enable (procfs collector not configured at startup)")
+		{
+			if b.IsBuiltin("vm") {
+				t.Fatal("expected vm to not be an active builtin")
+			}
+			if err := b.Enable("vm"); err != nil {
+				t.Fatalf("expected NO error, got (%s)", err)
+			}
+			if !b.IsBuiltin("vm") {
+				t.Fatal("expected vm to be an active builtin")
+			}
+			if b.names["vm"] != "vm" {
+				t.Fatalf("expected vm name, got (%s)", b.names["vm"])
+			}
+			if err := b.Disable("vm"); err != nil {
+				t.Fatalf("expected NO error, got (%s)", err)
+			}
+			if err := b.Enable("vm"); err != nil {
+				t.Fatalf("expected NO error, got (%s)", err)
+			}
+			if !b.IsBuiltin("vm") {
+				t.Fatal("expected vm to be an active builtin")
+			}
+		}
+	}
+}
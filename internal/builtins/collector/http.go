@@ -0,0 +1,28 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package collector
+
+import (
+	"context"
+	"net/http"
+)
+
+// HTTPDoRequest sends req and passes the response to respHandler, returning
+// early with the context error if ctx is done before the handler finishes
+func HTTPDoRequest(ctx context.Context, req *http.Request, respHandler func(*http.Response, error) error) error {
+	client := &http.Client{Transport: &http.Transport{DisableCompression: false, DisableKeepAlives: true, MaxIdleConnsPerHost: 1}}
+	ec := make(chan error, 1)
+
+	go func() { ec <- respHandler(client.Do(req)) }()
+
+	select {
+	case <-ctx.Done():
+		<-ec
+		return ctx.Err()
+	case err := <-ec:
+		return err
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package jsonhttp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// New creates new json http collector
+func New(cfgBaseName string) (collector.Collector, error) {
+	c := JSONHTTP{
+		cache: map[string]urlMetrics{},
+	}
+	c.pkgID = "builtins.json_http"
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+
+	// JSONHTTP requires a configuration file, there is nothing to
+	// collect without urls and the metrics to extract from them.
+	// The default config is a file named json_http_collector.(json|toml|yaml)
+	// located in the agent's default etc path.
+	// (e.g. /opt/circonus/agent/etc/json_http_collector.yaml)
+	if cfgBaseName == "" {
+		cfgBaseName = path.Join(defaults.EtcPath, "json_http_collector")
+	}
+
+	var opts jsonhttpOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Msg("loaded config")
+
+	if len(opts.URLs) == 0 {
+		return nil, errors.Errorf("%s 'urls' is REQUIRED in configuration", c.pkgID)
+	}
+
+	ids := map[string]bool{}
+	for i := range opts.URLs {
+		u := opts.URLs[i]
+		if !idRx.MatchString(u.ID) {
+			return nil, errors.Errorf("%s url %d, invalid id (%s)", c.pkgID, i, u.ID)
+		}
+		if ids[u.ID] {
+			return nil, errors.Errorf("%s url %d, duplicate id (%s)", c.pkgID, i, u.ID)
+		}
+		ids[u.ID] = true
+		if u.URL == "" {
+			return nil, errors.Errorf("%s url %s, 'url' is REQUIRED", c.pkgID, u.ID)
+		}
+		if _, err := url.Parse(u.URL); err != nil {
+			return nil, errors.Wrapf(err, "%s url %s", c.pkgID, u.ID)
+		}
+		if u.TTL != "" {
+			ttl, err := time.ParseDuration(u.TTL)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s url %s, parsing ttl", c.pkgID, u.ID)
+			}
+			u.uttl = ttl
+		}
+		u.utimeout = defaultTimeout
+		if u.Timeout != "" {
+			timeout, err := time.ParseDuration(u.Timeout)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s url %s, parsing timeout", c.pkgID, u.ID)
+			}
+			u.utimeout = timeout
+		}
+		if len(u.Metrics) == 0 {
+			return nil, errors.Errorf("%s url %s, 'metrics' is REQUIRED", c.pkgID, u.ID)
+		}
+		for _, md := range u.Metrics {
+			s, err := newSelector(md)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s url %s", c.pkgID, u.ID)
+			}
+			u.metrics = append(u.metrics, s)
+		}
+		c.logger.Debug().Str("id", u.ID).Str("url", u.URL).Int("metrics", len(u.metrics)).Msg("enabling json http collection URL")
+		c.urls = append(c.urls, &u)
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	return &c, nil
+}
+
+// Collect returns collector metrics
+func (c *JSONHTTP) Collect() error {
+	metrics := cgm.Metrics{}
+	c.Lock()
+
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	for _, u := range c.urls {
+		um, ok := c.cache[u.ID]
+		if !ok || u.uttl == time.Duration(0) || time.Since(um.ts) >= u.uttl {
+			c.logger.Debug().Str("id", u.ID).Str("url", u.URL).Msg("json fetch request")
+			m, err := c.fetchMetrics(u)
+			if err != nil {
+				// do not keep returning a stale set of metrics for the url
+				c.logger.Error().Err(err).Str("id", u.ID).Str("url", u.URL).Msg("fetching json metrics")
+				delete(c.cache, u.ID)
+				continue
+			}
+			um = urlMetrics{metrics: m, ts: time.Now()}
+			c.cache[u.ID] = um
+		}
+		for mn, mv := range um.metrics {
+			metrics[mn] = mv
+		}
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// fetchMetrics requests the url and extracts the configured metrics from the response
+func (c *JSONHTTP) fetchMetrics(u *URLDef) (cgm.Metrics, error) {
+	req, err := http.NewRequest("GET", u.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	for hn, hv := range u.Headers {
+		req.Header.Set(hn, os.ExpandEnv(hv))
+	}
+	if u.Username != "" {
+		req.SetBasicAuth(os.ExpandEnv(u.Username), os.ExpandEnv(u.Password))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), u.utimeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	metrics := cgm.Metrics{}
+	err = collector.HTTPDoRequest(ctx, req, func(resp *http.Response, err error) error {
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return errors.Errorf("unexpected response status (%s)", resp.Status)
+		}
+		return c.parse(u, resp.Body, metrics)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// parse decodes the JSON document and applies each of the url's selectors
+func (c *JSONHTTP) parse(u *URLDef, data io.Reader, metrics cgm.Metrics) error {
+	var doc interface{}
+
+	dec := json.NewDecoder(data)
+	dec.UseNumber() // retain integer precision
+	if err := dec.Decode(&doc); err != nil {
+		return errors.Wrap(err, "parsing json")
+	}
+
+	for _, s := range u.metrics {
+		s.extract(doc, metrics, u.ID)
+	}
+
+	return nil
+}
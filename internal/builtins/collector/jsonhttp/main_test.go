@@ -0,0 +1,241 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package jsonhttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNew(t *testing.T) {
+	t.Log("Testing New")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("default config (not found)")
+	{
+		_, err := New("")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	tt := []struct {
+		desc string
+		cfg  string
+	}{
+		{"config (missing)", "missing"},
+		{"config (no urls)", "no_urls"},
+		{"config (run ttl invalid)", "config_run_ttl_invalid_setting"},
+		{"config (url id invalid)", "config_url_id_invalid_setting"},
+		{"config (url timeout invalid)", "config_url_timeout_invalid_setting"},
+		{"config (url no metrics)", "config_url_no_metrics_setting"},
+		{"config (metric type invalid)", "config_metric_type_invalid_setting"},
+		{"config (metric tags invalid)", "config_metric_tags_invalid_setting"},
+	}
+	for _, tst := range tt {
+		t.Log(tst.desc)
+		_, err := New(filepath.Join("testdata", tst.cfg))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := New(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*JSONHTTP).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+		if c.(*JSONHTTP).urls[0].utimeout != defaultTimeout {
+			t.Fatal("expected default timeout")
+		}
+	}
+
+	t.Log("config (valid)")
+	{
+		c, err := New(filepath.Join("testdata", "valid"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		jh := c.(*JSONHTTP)
+		if len(jh.urls) != 1 {
+			t.Fatalf("expected 1 url, got %d", len(jh.urls))
+		}
+		u := jh.urls[0]
+		if u.uttl != time.Minute || u.utimeout != 5*time.Second {
+			t.Fatalf("expected ttl 1m timeout 5s, got %s %s", u.uttl, u.utimeout)
+		}
+		if len(u.metrics) != 7 {
+			t.Fatalf("expected 7 metrics, got %d", len(u.metrics))
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	stats, err := ioutil.ReadFile(filepath.Join("testdata", "stats.json"))
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(stats)
+	}))
+	defer ts.Close()
+
+	t.Log("already running")
+	{
+		c, err := New(filepath.Join("testdata", "valid"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*JSONHTTP).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("ttl not expired")
+	{
+		c, err := New(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*JSONHTTP).lastEnd = time.Now()
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrTTLNotExpired.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrTTLNotExpired, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("unauthorized")
+	{
+		os.Setenv("JSON_HTTP_TEST_TOKEN", "invalid")
+		c, err := New(filepath.Join("testdata", "valid"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		c.(*JSONHTTP).urls[0].URL = ts.URL
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if metrics := c.Flush(); len(metrics) != 0 {
+			t.Fatalf("expected no metrics, got %#v", metrics)
+		}
+	}
+
+	t.Log("good")
+	{
+		os.Setenv("JSON_HTTP_TEST_TOKEN", "secret")
+		defer os.Unsetenv("JSON_HTTP_TEST_TOKEN")
+		c, err := New(filepath.Join("testdata", "valid"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		c.(*JSONHTTP).urls[0].URL = ts.URL
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+
+		expect := map[string]interface{}{
+			"es`status":  "UP",
+			"es`cluster": "prod",
+			"es`ok":      uint64(1),
+			"es`version": uint64(12),
+			"es`nodes`jvm`mem`heap_used_in_bytes|ST[node:n1]":  float64(1024),
+			"es`nodes`jvm`mem`heap_used_in_bytes|ST[node:n2]":  float64(2048),
+			"es`breaker_tripped|ST[breaker:request,node:n1]":   float64(0),
+			"es`breaker_tripped|ST[breaker:fielddata,node:n1]": float64(2),
+			"es`breaker_tripped|ST[breaker:request,node:n2]":   float64(1),
+			"es`http_requests|ST[statistic:COUNT]":             float64(42),
+			"es`http_requests|ST[statistic:TOTAL_TIME]":        float64(1.5),
+		}
+		if len(metrics) != len(expect) {
+			t.Fatalf("expected %d metrics, got %#v", len(expect), metrics)
+		}
+		for name, val := range expect {
+			m, ok := metrics[name]
+			if !ok {
+				t.Fatalf("expected metric %s, got %#v", name, metrics)
+			}
+			if m.Value != val {
+				t.Fatalf("%s expected %v, got %v", name, val, m.Value)
+			}
+		}
+
+		t.Log("\turl ttl not expired (cached)")
+		n := requests
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if requests != n {
+			t.Fatal("expected no request")
+		}
+		if metrics := c.Flush(); len(metrics) != len(expect) {
+			t.Fatalf("expected %d metrics, got %d", len(expect), len(metrics))
+		}
+	}
+
+	t.Log("timeout")
+	{
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+			w.Write(stats)
+		}))
+		defer slow.Close()
+
+		c, err := New(filepath.Join("testdata", "valid"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		c.(*JSONHTTP).urls[0].URL = slow.URL
+		c.(*JSONHTTP).urls[0].utimeout = 50 * time.Millisecond
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if metrics := c.Flush(); len(metrics) != 0 {
+			t.Fatalf("expected no metrics, got %#v", metrics)
+		}
+	}
+}
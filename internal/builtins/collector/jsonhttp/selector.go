@@ -0,0 +1,238 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package jsonhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+)
+
+// newSelector validates and parses a metric definition
+func newSelector(md MetricDef) (*selector, error) {
+	segments := splitPath(md.Path)
+	if len(segments) == 0 {
+		return nil, errors.New("path is REQUIRED")
+	}
+
+	s := &selector{segments: segments, mtype: md.Type}
+
+	if s.mtype != "" && !validTypes[s.mtype] {
+		return nil, errors.Errorf("path %s, invalid type (%s)", md.Path, md.Type)
+	}
+
+	wildcards := 0
+	var nameParts []string
+	for i, seg := range segments {
+		if seg != wildcardObject && seg != wildcardArray {
+			nameParts = append(nameParts, cleanNamePart(seg))
+			continue
+		}
+		td := tagDef{}
+		if wildcards < len(md.Tags) {
+			parts := strings.SplitN(md.Tags[wildcards], "=", 2)
+			td.name = parts[0]
+			if len(parts) == 2 {
+				td.field = parts[1]
+			}
+		} else if i > 0 {
+			td.name = tagValueCleaner.ReplaceAllString(segments[i-1], "_") // default, name of the containing element
+		} else {
+			td.name = "key"
+		}
+		if td.name == "" || strings.ContainsAny(td.name, tags.Delimiter+tags.Separator) {
+			return nil, errors.Errorf("path %s, invalid tag name (%s)", md.Path, td.name)
+		}
+		s.tags = append(s.tags, td)
+		wildcards++
+	}
+
+	if len(md.Tags) > wildcards {
+		return nil, errors.Errorf("path %s, %d tags defined for %d wildcards", md.Path, len(md.Tags), wildcards)
+	}
+
+	if md.Name != "" {
+		nameParts = nameParts[:0]
+		for _, part := range strings.Split(md.Name, metricNameSeparator) {
+			nameParts = append(nameParts, cleanNamePart(part))
+		}
+	}
+	s.name = strings.Join(nameParts, metricNameSeparator)
+	if s.name == "" {
+		return nil, errors.Errorf("path %s, name is REQUIRED", md.Path)
+	}
+
+	return s, nil
+}
+
+// cleanNamePart replaces characters which would break a metric name, keys
+// may contain anything (e.g. spaces, backticks or the stream tag marker '|')
+func cleanNamePart(part string) string {
+	return metricNameCleaner.ReplaceAllString(part, "_")
+}
+
+// splitPath splits a dotted path into segments, a '\.' is a literal dot in a key
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	var segments []string
+	var seg []byte
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+1 < len(path) && path[i+1] == '.' {
+			seg = append(seg, '.')
+			i++
+			continue
+		}
+		if path[i] == '.' {
+			segments = append(segments, string(seg))
+			seg = seg[:0]
+			continue
+		}
+		seg = append(seg, path[i])
+	}
+	return append(segments, string(seg))
+}
+
+// extract adds the metrics for all values matching the selector
+func (s *selector) extract(doc interface{}, metrics cgm.Metrics, prefix string) {
+	s.walk(doc, 0, nil, func(v interface{}, tagVals []string) {
+		val, mtype, ok := metricValue(v, s.mtype)
+		if !ok {
+			return
+		}
+		name := prefix + metricNameSeparator + s.name
+		if len(tagVals) > 0 {
+			spec, err := tags.PrepStreamTags(strings.Join(tagVals, tags.Separator))
+			if err != nil {
+				return
+			}
+			name += spec
+		}
+		metrics[name] = cgm.Metric{Type: mtype, Value: val}
+	})
+}
+
+// walk descends the document following the selector segments, wildcards
+// expand to every key/element and record the corresponding tag value
+func (s *selector) walk(v interface{}, depth int, tagVals []string, fn func(interface{}, []string)) {
+	if depth == len(s.segments) {
+		fn(v, tagVals)
+		return
+	}
+
+	seg := s.segments[depth]
+	switch seg {
+	case wildcardObject:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for k, child := range obj {
+			s.walk(child, depth+1, s.appendTag(tagVals, k, child), fn)
+		}
+	case wildcardArray:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return
+		}
+		for i, child := range arr {
+			s.walk(child, depth+1, s.appendTag(tagVals, strconv.Itoa(i), child), fn)
+		}
+	default:
+		switch t := v.(type) {
+		case map[string]interface{}:
+			if child, ok := t[seg]; ok {
+				s.walk(child, depth+1, tagVals, fn)
+			}
+		case []interface{}:
+			if i, err := strconv.Atoi(seg); err == nil && i >= 0 && i < len(t) {
+				s.walk(t[i], depth+1, tagVals, fn)
+			}
+		}
+	}
+}
+
+// appendTag returns a new list of tag values with the tag for the next wildcard
+func (s *selector) appendTag(tagVals []string, key string, elem interface{}) []string {
+	td := s.tags[len(tagVals)]
+	tv := key
+	if td.field != "" {
+		if obj, ok := elem.(map[string]interface{}); ok {
+			if fv, ok := obj[td.field]; ok {
+				switch fv.(type) {
+				case map[string]interface{}, []interface{}, nil:
+				default:
+					tv = fmt.Sprintf("%v", fv)
+				}
+			}
+		}
+	}
+	tv = tagValueCleaner.ReplaceAllString(tv, "_")
+	if tv == "" {
+		tv = "_"
+	}
+
+	ret := make([]string, len(tagVals), len(tagVals)+1)
+	copy(ret, tagVals)
+	return append(ret, td.name+tags.Delimiter+tv)
+}
+
+// metricValue converts a JSON value to a metric value of the requested type,
+// without a type numbers are 'n', booleans 'L' (0/1) and strings 's'. Objects,
+// arrays and nulls are not metric values.
+func metricValue(v interface{}, mtype string) (interface{}, string, bool) {
+	var str string
+	switch t := v.(type) {
+	case json.Number:
+		str = t.String()
+		if mtype == "" {
+			mtype = "n"
+		}
+	case bool:
+		str = "0"
+		if t {
+			str = "1"
+		}
+		if mtype == "" {
+			mtype = "L"
+		}
+	case string:
+		str = t
+		if mtype == "" {
+			mtype = "s"
+		}
+	default:
+		return nil, "", false
+	}
+
+	switch mtype {
+	case "s":
+		return str, mtype, true
+	case "n":
+		f, err := strconv.ParseFloat(str, 64)
+		return f, mtype, err == nil
+	case "i":
+		i, err := strconv.ParseInt(str, 10, 32)
+		return int32(i), mtype, err == nil
+	case "I":
+		i, err := strconv.ParseUint(str, 10, 32)
+		return uint32(i), mtype, err == nil
+	case "l":
+		i, err := strconv.ParseInt(str, 10, 64)
+		return i, mtype, err == nil
+	case "L":
+		i, err := strconv.ParseUint(str, 10, 64)
+		return i, mtype, err == nil
+	}
+
+	return nil, "", false
+}
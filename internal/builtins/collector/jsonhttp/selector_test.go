@@ -0,0 +1,98 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package jsonhttp
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	cgm "github.com/circonus-labs/circonus-gometrics"
+)
+
+func TestSplitPath(t *testing.T) {
+	t.Log("Testing splitPath")
+
+	tt := []struct {
+		path   string
+		expect []string
+	}{
+		{"", nil},
+		{"foo", []string{"foo"}},
+		{"foo.*.bar", []string{"foo", "*", "bar"}},
+		{`foo.a\.b.#`, []string{"foo", "a.b", "#"}},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.path)
+		if s := splitPath(tst.path); !reflect.DeepEqual(s, tst.expect) {
+			t.Fatalf("expected %#v got %#v", tst.expect, s)
+		}
+	}
+}
+
+func TestSelector(t *testing.T) {
+	t.Log("Testing selector")
+
+	tt := []struct {
+		desc        string
+		md          MetricDef
+		doc         string
+		expect      cgm.Metrics
+		shouldError bool
+	}{
+		{"no path", MetricDef{}, "", nil, true},
+		{"invalid tag name", MetricDef{Path: "*", Tags: []string{"a:b"}}, "", nil, true},
+		{"no name", MetricDef{Path: "*"}, "", nil, true},
+		{"array index", MetricDef{Path: "a.1"}, `{"a":[1,2]}`, cgm.Metrics{"x`a`1": cgm.Metric{Type: "n", Value: float64(2)}}, false},
+		{"array expansion, default tag", MetricDef{Path: "a.#"}, `{"a":[1,2]}`, cgm.Metrics{
+			"x`a|ST[a:0]": cgm.Metric{Type: "n", Value: float64(1)},
+			"x`a|ST[a:1]": cgm.Metric{Type: "n", Value: float64(2)},
+		}, false},
+		{"tag field, value cleaned", MetricDef{Path: "#.v", Name: "v", Tags: []string{"k=k"}}, `[{"k":"a b","v":"3"}]`, cgm.Metrics{
+			"x`v|ST[k:a_b]": cgm.Metric{Type: "s", Value: "3"},
+		}, false},
+		{"name cleaned", MetricDef{Path: "a b.c`d.e|f"}, "{\"a b\":{\"c`d\":{\"e|f\":1}}}", cgm.Metrics{
+			"x`a_b`c_d`e_f": cgm.Metric{Type: "n", Value: float64(1)},
+		}, false},
+		{"explicit name cleaned", MetricDef{Path: "v", Name: "a b`c|d"}, `{"v":1}`, cgm.Metrics{
+			"x`a_b`c_d": cgm.Metric{Type: "n", Value: float64(1)},
+		}, false},
+		{"wildcard key cleaned", MetricDef{Path: "a b.*"}, "{\"a b\":{\"c`d|e f\":1}}", cgm.Metrics{
+			"x`a_b|ST[a_b:c_d_e_f]": cgm.Metric{Type: "n", Value: float64(1)},
+		}, false},
+		{"type conversion failure", MetricDef{Path: "v", Type: "L"}, `{"v":"abc"}`, cgm.Metrics{}, false},
+		{"object value ignored", MetricDef{Path: "v"}, `{"v":{"a":1}}`, cgm.Metrics{}, false},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.desc)
+		s, err := newSelector(tst.md)
+		if tst.shouldError {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		var doc interface{}
+		dec := json.NewDecoder(strings.NewReader(tst.doc))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := cgm.Metrics{}
+		s.extract(doc, metrics, "x")
+		if !reflect.DeepEqual(metrics, tst.expect) {
+			t.Fatalf("expected %#v got %#v", tst.expect, metrics)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package jsonhttp
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/rs/zerolog"
+)
+
+// URLDef defines a url to fetch JSON from and the metrics to extract
+type URLDef struct {
+	ID       string            `json:"id" toml:"id" yaml:"id"`
+	URL      string            `json:"url" toml:"url" yaml:"url"`
+	TTL      string            `json:"ttl" toml:"ttl" yaml:"ttl"`             // fetch no more frequently than ttl (cached metrics returned)
+	Timeout  string            `json:"timeout" toml:"timeout" yaml:"timeout"` // request timeout
+	Headers  map[string]string `json:"headers" toml:"headers" yaml:"headers"` // request headers (e.g. Authorization), environment variables are expanded
+	Username string            `json:"username" toml:"username" yaml:"username"`
+	Password string            `json:"password" toml:"password" yaml:"password"`
+	Metrics  []MetricDef       `json:"metrics" toml:"metrics" yaml:"metrics"`
+	uttl     time.Duration
+	utimeout time.Duration
+	metrics  []*selector
+}
+
+// MetricDef defines a selector for values in a JSON document and the metric produced
+type MetricDef struct {
+	Path string   `json:"path" toml:"path" yaml:"path"` // dotted path, '*' any object key, '#' any array element
+	Name string   `json:"name" toml:"name" yaml:"name"` // metric name (default, path without wildcards)
+	Type string   `json:"type" toml:"type" yaml:"type"` // metric type (default, based on the JSON value)
+	Tags []string `json:"tags" toml:"tags" yaml:"tags"` // tag for each wildcard, 'name' (key/index) or 'name=field' (field of the element)
+}
+
+// JSONHTTP defines json http collector
+type JSONHTTP struct {
+	pkgID           string                // package prefix used for logging and errors
+	urls            []*URLDef             // URLs to collect metrics from
+	cache           map[string]urlMetrics // last metrics for each URL (honor url ttl)
+	lastEnd         time.Time             // last collection end time
+	lastError       string                // last collection error
+	lastMetrics     cgm.Metrics           // last metrics collected
+	lastRunDuration time.Duration         // last collection duration
+	lastStart       time.Time             // last collection start time
+	logger          zerolog.Logger        // collector logging instance
+	running         bool                  // is collector currently running
+	runTTL          time.Duration         // OPT ttl for collector (default is for every request)
+	sync.Mutex
+}
+
+// jsonhttpOptions defines what elements can be overridden in a config file
+type jsonhttpOptions struct {
+	RunTTL string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	URLs   []URLDef `json:"urls" toml:"urls" yaml:"urls"`
+}
+
+// urlMetrics holds the metrics last fetched from a URL
+type urlMetrics struct {
+	metrics cgm.Metrics
+	ts      time.Time
+}
+
+// selector defines a parsed metric definition
+type selector struct {
+	segments []string
+	name     string
+	mtype    string
+	tags     []tagDef
+}
+
+// tagDef defines the stream tag produced by a wildcard in a selector path
+type tagDef struct {
+	name  string
+	field string // use value of field in the matched element, rather than the key/index
+}
+
+const (
+	defaultTimeout      = 10 * time.Second
+	metricNameSeparator = "`" // character used to separate parts of metric names
+	wildcardArray       = "#"
+	wildcardObject      = "*"
+)
+
+var (
+	idRx = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+	// metricNameCleaner replaces characters which are not valid in a metric name part
+	metricNameCleaner = regexp.MustCompile(`[^a-zA-Z0-9_.:-]`)
+
+	// tagValueCleaner removes characters with special meaning in stream tags
+	tagValueCleaner = regexp.MustCompile(`[:,|\s]`)
+
+	// validTypes metric types which may be specified for a metric
+	validTypes = map[string]bool{"i": true, "I": true, "l": true, "L": true, "n": true, "s": true}
+)
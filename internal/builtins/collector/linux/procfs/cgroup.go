@@ -0,0 +1,527 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Cgroup resource usage metrics for control groups from the Linux SysFS,
+// supports both the unified (v2) and legacy (v1) hierarchies
+type Cgroup struct {
+	pfscommon
+	include   *regexp.Regexp
+	exclude   *regexp.Regexp
+	sysFSPath string
+}
+
+// cgroupOptions defines what elements can be overriden in a config file
+type cgroupOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+
+	// collector specific
+	SysFSPath    string `json:"sysfs_path" toml:"sysfs_path" yaml:"sysfs_path"`
+	IncludeRegex string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
+	ExcludeRegex string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+}
+
+// cgstats metric values for a cgroup (all counters/gauges are uint64)
+type cgstats map[string]uint64
+
+const (
+	// cgroupUnlimited v1 limits at or above this value are effectively unlimited
+	cgroupUnlimited = uint64(1) << 62
+	// cgroupUserHZ clock ticks per second used in v1 cpuacct.stat
+	cgroupUserHZ = 100
+)
+
+// cgroupCounters cpu time, io and memory events
+var cgroupCounters = regexp.MustCompile(fmt.Sprintf(regexPat, "(cpu|io|memory`events)`.+"))
+
+// NewCgroupCollector creates new cgroup collector
+func NewCgroupCollector(cfgBaseName string) (collector.Collector, error) {
+	c := Cgroup{}
+	c.id = "cgroup"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = cgroupCounters
+	c.sysFSPath = "/sys"
+	c.file = filepath.Join(c.sysFSPath, "fs", "cgroup")
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+
+	c.include = defaultIncludeRegex
+	c.exclude = defaultExcludeRegex
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts cgroupOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.IncludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.IncludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling include regex", c.pkgID)
+		}
+		c.include = rx
+	}
+
+	if opts.ExcludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.ExcludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling exclude regex", c.pkgID)
+		}
+		c.exclude = rx
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.SysFSPath != "" {
+		c.sysFSPath = opts.SysFSPath
+		c.file = filepath.Join(c.sysFSPath, "fs", "cgroup")
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the cgroup hierarchy
+func (c *Cgroup) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	var stats map[string]cgstats
+	var err error
+	if _, serr := os.Stat(filepath.Join(c.file, "cgroup.controllers")); serr == nil {
+		stats, err = c.collectUnified()
+	} else {
+		stats, err = c.collectLegacy()
+	}
+	if err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	for cgPath, cgs := range stats {
+		streamTags, err := tags.PrepStreamTags(cgroupTags(cgPath))
+		if err != nil {
+			c.logger.Warn().Err(err).Str("cgroup", cgPath).Msg("stream tags, ignoring cgroup")
+			continue
+		}
+		for mn, mv := range cgs {
+			c.addTaggedMetric(&metrics, c.id, mn, streamTags, "L", mv)
+		}
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// walk calls fn for each cgroup (directory) beneath root which passes the
+// include/exclude filters, cgroups are identified by their path relative
+// to root (e.g. /system.slice/nginx.service)
+func (c *Cgroup) walk(root string, fn func(cgPath, dir string)) error {
+	// v1 controller directories are often symlinks (e.g. cpuacct -> cpu,cpuacct)
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(realRoot, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			// cgroup removed while walking
+			c.logger.Debug().Err(err).Str("dir", dir).Msg("walking cgroups, ignoring")
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(realRoot, dir)
+		if err != nil {
+			return nil
+		}
+		cgPath := "/"
+		if rel != "." {
+			cgPath += filepath.ToSlash(rel)
+		}
+		if c.exclude.MatchString(cgPath) || !c.include.MatchString(cgPath) {
+			return nil
+		}
+		fn(cgPath, dir)
+		return nil
+	})
+}
+
+// collectUnified reads the unified (v2) hierarchy
+func (c *Cgroup) collectUnified() (map[string]cgstats, error) {
+	stats := make(map[string]cgstats)
+
+	err := c.walk(c.file, func(cgPath, dir string) {
+		cgs := cgstats{}
+
+		if kv, err := readKeyValues(filepath.Join(dir, "cpu.stat")); err == nil {
+			for _, k := range []string{"usage_usec", "user_usec", "system_usec", "nr_periods", "nr_throttled", "throttled_usec"} {
+				if v, ok := kv[k]; ok {
+					cgs["cpu"+metricNameSeparator+k] = v
+				}
+			}
+		}
+
+		if v, err := readUint(filepath.Join(dir, "memory.current")); err == nil {
+			cgs["memory"+metricNameSeparator+"usage_bytes"] = v
+		}
+		if v, err := readUint(filepath.Join(dir, "memory.max")); err == nil { // "max" is unlimited
+			cgs["memory"+metricNameSeparator+"limit_bytes"] = v
+		}
+		if kv, err := readKeyValues(filepath.Join(dir, "memory.events")); err == nil {
+			for _, k := range []string{"low", "high", "max", "oom", "oom_kill"} {
+				if v, ok := kv[k]; ok {
+					cgs["memory"+metricNameSeparator+"events"+metricNameSeparator+k] = v
+				}
+			}
+		}
+
+		if io, err := readIOStat(filepath.Join(dir, "io.stat")); err == nil {
+			for k, v := range io {
+				cgs["io"+metricNameSeparator+k] = v
+			}
+		}
+
+		if v, err := readUint(filepath.Join(dir, "pids.current")); err == nil {
+			cgs["pids"+metricNameSeparator+"current"] = v
+		}
+		if v, err := readUint(filepath.Join(dir, "pids.max")); err == nil {
+			cgs["pids"+metricNameSeparator+"limit"] = v
+		}
+
+		if len(cgs) > 0 {
+			stats[cgPath] = cgs
+		}
+	})
+
+	return stats, err
+}
+
+// collectLegacy reads the per-controller (v1) hierarchies
+func (c *Cgroup) collectLegacy() (map[string]cgstats, error) {
+	stats := make(map[string]cgstats)
+	get := func(cgPath string) cgstats {
+		cgs, ok := stats[cgPath]
+		if !ok {
+			cgs = cgstats{}
+			stats[cgPath] = cgs
+		}
+		return cgs
+	}
+
+	controllers := []struct {
+		dirs []string
+		fn   func(cgPath, dir string)
+	}{
+		{[]string{"cpuacct", "cpu,cpuacct"}, func(cgPath, dir string) {
+			if v, err := readUint(filepath.Join(dir, "cpuacct.usage")); err == nil {
+				get(cgPath)["cpu"+metricNameSeparator+"usage_usec"] = v / 1000 // ns
+			}
+			if kv, err := readKeyValues(filepath.Join(dir, "cpuacct.stat")); err == nil {
+				cgs := get(cgPath)
+				if v, ok := kv["user"]; ok {
+					cgs["cpu"+metricNameSeparator+"user_usec"] = v * (1000000 / cgroupUserHZ)
+				}
+				if v, ok := kv["system"]; ok {
+					cgs["cpu"+metricNameSeparator+"system_usec"] = v * (1000000 / cgroupUserHZ)
+				}
+			}
+		}},
+		{[]string{"cpu", "cpu,cpuacct"}, func(cgPath, dir string) {
+			if kv, err := readKeyValues(filepath.Join(dir, "cpu.stat")); err == nil {
+				cgs := get(cgPath)
+				if v, ok := kv["nr_periods"]; ok {
+					cgs["cpu"+metricNameSeparator+"nr_periods"] = v
+				}
+				if v, ok := kv["nr_throttled"]; ok {
+					cgs["cpu"+metricNameSeparator+"nr_throttled"] = v
+				}
+				if v, ok := kv["throttled_time"]; ok {
+					cgs["cpu"+metricNameSeparator+"throttled_usec"] = v / 1000 // ns
+				}
+			}
+		}},
+		{[]string{"memory"}, func(cgPath, dir string) {
+			if v, err := readUint(filepath.Join(dir, "memory.usage_in_bytes")); err == nil {
+				get(cgPath)["memory"+metricNameSeparator+"usage_bytes"] = v
+			}
+			if v, err := readUint(filepath.Join(dir, "memory.limit_in_bytes")); err == nil && v < cgroupUnlimited {
+				get(cgPath)["memory"+metricNameSeparator+"limit_bytes"] = v
+			}
+			if v, err := readUint(filepath.Join(dir, "memory.failcnt")); err == nil {
+				get(cgPath)["memory"+metricNameSeparator+"events"+metricNameSeparator+"max"] = v
+			}
+			if kv, err := readKeyValues(filepath.Join(dir, "memory.oom_control")); err == nil {
+				if v, ok := kv["oom_kill"]; ok {
+					get(cgPath)["memory"+metricNameSeparator+"events"+metricNameSeparator+"oom_kill"] = v
+				}
+			}
+		}},
+		{[]string{"blkio"}, func(cgPath, dir string) {
+			if io, err := readBlkioStat(filepath.Join(dir, "blkio.throttle.io_service_bytes"), "rbytes", "wbytes"); err == nil {
+				cgs := get(cgPath)
+				for k, v := range io {
+					cgs["io"+metricNameSeparator+k] = v
+				}
+			}
+			if io, err := readBlkioStat(filepath.Join(dir, "blkio.throttle.io_serviced"), "rios", "wios"); err == nil {
+				cgs := get(cgPath)
+				for k, v := range io {
+					cgs["io"+metricNameSeparator+k] = v
+				}
+			}
+		}},
+		{[]string{"pids"}, func(cgPath, dir string) {
+			if v, err := readUint(filepath.Join(dir, "pids.current")); err == nil {
+				get(cgPath)["pids"+metricNameSeparator+"current"] = v
+			}
+			if v, err := readUint(filepath.Join(dir, "pids.max")); err == nil {
+				get(cgPath)["pids"+metricNameSeparator+"limit"] = v
+			}
+		}},
+	}
+
+	numControllers := 0
+	for _, ctl := range controllers {
+		for _, dir := range ctl.dirs {
+			root := filepath.Join(c.file, dir)
+			if _, err := os.Stat(root); err != nil {
+				continue
+			}
+			numControllers++
+			if err := c.walk(root, ctl.fn); err != nil {
+				c.logger.Warn().Err(err).Str("controller", dir).Msg("walking cgroups")
+			}
+			break
+		}
+	}
+
+	if numControllers == 0 {
+		return nil, errors.Errorf("no cgroup controllers found in %s", c.file)
+	}
+
+	for cgPath, cgs := range stats {
+		if len(cgs) == 0 {
+			delete(stats, cgPath)
+		}
+	}
+
+	return stats, nil
+}
+
+// cgroupTags returns the stream tags for a cgroup, the cgroup path and the
+// systemd unit, slice or scope (if the cgroup is one)
+func cgroupTags(cgPath string) string {
+	tagList := []string{"cgroup" + tags.Delimiter + cleanTagValue(cgPath)}
+
+	name := filepath.Base(cgPath)
+	switch {
+	case strings.HasSuffix(name, ".service"):
+		tagList = append(tagList, "unit"+tags.Delimiter+cleanTagValue(name))
+	case strings.HasSuffix(name, ".slice"):
+		tagList = append(tagList, "slice"+tags.Delimiter+cleanTagValue(name))
+	case strings.HasSuffix(name, ".scope"):
+		tagList = append(tagList, "scope"+tags.Delimiter+cleanTagValue(name))
+	}
+
+	sort.Strings(tagList)
+	return strings.Join(tagList, tags.Separator)
+}
+
+// readUint reads a file containing a single unsigned integer
+func readUint(fn string) (uint64, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readKeyValues reads a file of "key value" lines (e.g. cpu.stat)
+func readKeyValues(fn string) (map[string]uint64, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	kv := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			kv[fields[0]] = v
+		}
+	}
+	return kv, scanner.Err()
+}
+
+// readIOStat reads a v2 io.stat file, summing the values for all devices
+//
+//	8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+func readIOStat(fn string) (map[string]uint64, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	io := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "rbytes", "wbytes", "rios", "wios":
+				if v, err := strconv.ParseUint(kv[1], 10, 64); err == nil {
+					io[kv[0]] += v
+				}
+			}
+		}
+	}
+	return io, scanner.Err()
+}
+
+// readBlkioStat reads a v1 blkio throttle file, summing the read and write
+// values for all devices
+//
+//	8:0 Read 1459200
+//	8:0 Write 314773504
+func readBlkioStat(fn, readKey, writeKey string) (map[string]uint64, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	io := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[1] {
+		case "Read":
+			io[readKey] += v
+		case "Write":
+			io[writeKey] += v
+		}
+	}
+	return io, scanner.Err()
+}
@@ -0,0 +1,195 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewCgroupCollector(t *testing.T) {
+	t.Log("Testing NewCgroupCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewCgroupCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (sysfs path setting)")
+	{
+		c, err := NewCgroupCollector(filepath.Join("testdata", "config_cgroup_v2_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "cgroupv2", "fs", "cgroup")
+		if c.(*Cgroup).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*Cgroup).file)
+		}
+	}
+
+	t.Log("config (sysfs path setting invalid)")
+	{
+		_, err := NewCgroupCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error (procfs_path not used), got (%s)", err)
+		}
+	}
+
+	t.Log("config (include regex invalid)")
+	{
+		_, err := NewCgroupCollector(filepath.Join("testdata", "config_include_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewCgroupCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Cgroup).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestCgroupCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	nginxTags := "|ST[cgroup:/system.slice/nginx.service,unit:nginx.service]"
+
+	t.Log("already running")
+	{
+		c, err := NewCgroupCollector(filepath.Join("testdata", "config_cgroup_v2_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Cgroup).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("unified (v2)")
+	{
+		c, err := NewCgroupCollector(filepath.Join("testdata", "config_cgroup_v2_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 25 {
+			t.Fatalf("expected 25 metrics, got %d (%#v)", len(metrics), metrics)
+		}
+
+		tests := map[string]uint64{
+			"cgroup`cpu`usage_usec" + nginxTags:                                 1500000,
+			"cgroup`cpu`throttled_usec" + nginxTags:                             25000,
+			"cgroup`memory`usage_bytes" + nginxTags:                             104857600,
+			"cgroup`memory`limit_bytes" + nginxTags:                             536870912,
+			"cgroup`memory`events`oom_kill" + nginxTags:                         1,
+			"cgroup`io`rbytes" + nginxTags:                                      1500,
+			"cgroup`io`wios" + nginxTags:                                        25,
+			"cgroup`pids`current" + nginxTags:                                   12,
+			"cgroup`cpu`usage_usec|ST[cgroup:/]":                                9000000,
+			"cgroup`cpu`usage_usec|ST[cgroup:/system.slice,slice:system.slice]": 4000000,
+		}
+		for mn, expected := range tests {
+			m, ok := metrics[mn]
+			if !ok {
+				t.Fatalf("expected %s, got %#v", mn, metrics)
+			}
+			if m.Value.(uint64) != expected {
+				t.Fatalf("%s expected %d, got %v", mn, expected, m.Value)
+			}
+		}
+		if _, ok := metrics["cgroup`pids`limit"+nginxTags]; ok {
+			t.Fatal("expected no pids limit (max)")
+		}
+	}
+
+	t.Log("legacy (v1)")
+	{
+		c, err := NewCgroupCollector(filepath.Join("testdata", "config_cgroup_v1_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 16 {
+			t.Fatalf("expected 16 metrics, got %d (%#v)", len(metrics), metrics)
+		}
+
+		tests := map[string]uint64{
+			"cgroup`cpu`usage_usec" + nginxTags:         1500000,
+			"cgroup`cpu`user_usec" + nginxTags:          1000000,
+			"cgroup`cpu`throttled_usec" + nginxTags:     25000,
+			"cgroup`memory`usage_bytes" + nginxTags:     104857600,
+			"cgroup`memory`events`oom_kill" + nginxTags: 1,
+			"cgroup`io`wbytes" + nginxTags:              2000,
+			"cgroup`io`rios" + nginxTags:                10,
+			"cgroup`pids`limit" + nginxTags:             100,
+		}
+		for mn, expected := range tests {
+			m, ok := metrics[mn]
+			if !ok {
+				t.Fatalf("expected %s, got %#v", mn, metrics)
+			}
+			if m.Value.(uint64) != expected {
+				t.Fatalf("%s expected %d, got %v", mn, expected, m.Value)
+			}
+		}
+		if _, ok := metrics["cgroup`memory`limit_bytes"+nginxTags]; ok {
+			t.Fatal("expected no memory limit (unlimited)")
+		}
+	}
+
+	t.Log("include regex")
+	{
+		c, err := NewCgroupCollector(filepath.Join("testdata", "config_cgroup_include_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 18 {
+			t.Fatalf("expected 18 metrics, got %d (%#v)", len(metrics), metrics)
+		}
+	}
+}
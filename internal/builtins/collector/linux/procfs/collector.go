@@ -8,9 +8,14 @@
 package procfs
 
 import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
 	cgm "github.com/circonus-labs/circonus-gometrics"
 	"github.com/pkg/errors"
 )
@@ -70,6 +75,12 @@ func (c *pfscommon) cleanName(name string) string {
 
 // addMetric to internal buffer if metric is active
 func (c *pfscommon) addMetric(metrics *cgm.Metrics, prefix string, mname, mtype string, mval interface{}) error {
+	return c.addTaggedMetric(metrics, prefix, mname, "", mtype, mval)
+}
+
+// addTaggedMetric to internal buffer if metric is active, streamTags
+// (from tags.PrepStreamTags) are appended to the metric name
+func (c *pfscommon) addTaggedMetric(metrics *cgm.Metrics, prefix string, mname, streamTags, mtype string, mval interface{}) error {
 	if metrics == nil {
 		return errors.New("invalid metric submission")
 	}
@@ -92,6 +103,7 @@ func (c *pfscommon) addMetric(metrics *cgm.Metrics, prefix string, mname, mtype
 		if prefix != "" {
 			metricName = prefix + metricNameSeparator + mname
 		}
+		metricName += streamTags
 		(*metrics)[metricName] = cgm.Metric{Type: mtype, Value: mval}
 		return nil
 	}
@@ -99,11 +111,17 @@ func (c *pfscommon) addMetric(metrics *cgm.Metrics, prefix string, mname, mtype
 	return errors.Errorf("metric (%s) not active", mname)
 }
 
+// cleanTagValue replaces the stream tag delimiter and separator in a tag value
+func cleanTagValue(v string) string {
+	return strings.NewReplacer(tags.Delimiter, "_", tags.Separator, "_").Replace(v)
+}
+
 // setStatus is used in Collect to set the collector status
 func (c *pfscommon) setStatus(metrics cgm.Metrics, err error) {
 	c.Lock()
 	if err == nil {
 		c.lastError = ""
+		c.applyRates(metrics)
 		c.lastMetrics = metrics
 	} else {
 		c.lastError = err.Error()
@@ -118,3 +136,177 @@ func (c *pfscommon) setStatus(metrics cgm.Metrics, err error) {
 	c.running = false
 	c.Unlock()
 }
+
+// setRateOptions is used in the collector constructors to configure
+// computing per second rates for counter metrics
+func (c *pfscommon) setRateOptions(mode string, patterns []string) error {
+	if mode != "" {
+		switch strings.ToLower(mode) {
+		case rateModeNone, rateModeAlso, rateModeOnly:
+			c.rateMode = strings.ToLower(mode)
+		default:
+			return errors.Errorf("invalid rate mode (%s)", mode)
+		}
+	}
+
+	for _, pat := range patterns {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, pat))
+		if err != nil {
+			return errors.Wrapf(err, "compiling rate metric regex (%s)", pat)
+		}
+		c.rateMetrics = append(c.rateMetrics, rx)
+	}
+
+	return nil
+}
+
+// applyRates adds per second rates for the counter metrics, computed from the
+// previous collection, and removes the counters if rate mode is 'only'. Gauges
+// are never changed, a collector without counters emits no rates.
+// Rates are skipped for the first sample of a counter and when a counter was
+// reset. Metric names are matched against rate_metrics without stream tags, the
+// rate metric is named <counter>_per_sec (e.g. diskstats`sda`rd_bytes_per_sec).
+func (c *pfscommon) applyRates(metrics cgm.Metrics) {
+	if c.rateMode == "" || c.rateMode == rateModeNone {
+		return
+	}
+
+	ts := c.lastStart
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	interval := float64(0)
+	if !c.rateLastTime.IsZero() {
+		interval = ts.Sub(c.rateLastTime).Seconds()
+	}
+
+	samples := cgm.Metrics{}
+	rates := cgm.Metrics{}
+	for name, m := range metrics {
+		switch m.Type {
+		case "i", "I", "l", "L":
+		default:
+			continue
+		}
+
+		baseName, streamTags := name, ""
+		if idx := strings.Index(name, "|ST["); idx != -1 {
+			baseName, streamTags = name[:idx], name[idx:]
+		}
+		if !c.rateMetric(baseName) {
+			continue
+		}
+
+		samples[name] = m
+		if c.rateMode == rateModeOnly {
+			delete(metrics, name)
+		}
+
+		prev, ok := c.rateLast[name]
+		if !ok || interval <= 0 {
+			continue
+		}
+		delta, ok := counterDelta(prev.Value, m.Value, c.rateCounter32(baseName))
+		if !ok {
+			c.logger.Debug().Str("metric", name).Interface("prev", prev.Value).Interface("cur", m.Value).Msg("counter reset, skipping rate")
+			continue
+		}
+		rates[baseName+rateMetricSuffix+streamTags] = cgm.Metric{Type: "n", Value: delta / interval}
+	}
+
+	for name, m := range rates {
+		metrics[name] = m
+	}
+
+	c.rateLast = samples
+	c.rateLastTime = ts
+}
+
+// rateMetric returns true if a rate should be computed for the metric, only
+// metrics the collector declares as counters (rateCounters, matched without
+// the collector id prefix) are candidates, rate_metrics further limits these
+func (c *pfscommon) rateMetric(name string) bool {
+	if c.rateCounters == nil {
+		return false
+	}
+	cname := strings.TrimPrefix(name, c.id+metricNameSeparator)
+	if !c.rateCounters.MatchString(cname) {
+		return false
+	}
+	if c.rateGauges != nil && c.rateGauges.MatchString(cname) {
+		return false
+	}
+	if len(c.rateMetrics) == 0 {
+		return true
+	}
+	for _, rx := range c.rateMetrics {
+		if rx.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateCounter32 returns true if the collector declares the counter metric as
+// 32 bits wide (rateCounters32, matched without the collector id prefix)
+func (c *pfscommon) rateCounter32(name string) bool {
+	if c.rateCounters32 == nil {
+		return false
+	}
+	return c.rateCounters32.MatchString(strings.TrimPrefix(name, c.id+metricNameSeparator))
+}
+
+// counterDelta returns the increase of a counter from the previous value,
+// handling counters which wrapped at 32 or 64 bits. Returns false if the
+// counter was reset (e.g. device re-added, module reloaded). A uint64 value
+// is only considered to have wrapped at 32 bits if counter32 is set, any
+// other decrease below the 64 bit wrap point is a reset.
+func counterDelta(prev, cur interface{}, counter32 bool) (float64, bool) {
+	switch v := cur.(type) {
+	case uint64:
+		p, ok := prev.(uint64)
+		if !ok {
+			return 0, false
+		}
+		if v >= p {
+			return float64(v - p), true
+		}
+		// kernel counters which are 32 bits wide are reported as uint64
+		if counter32 {
+			if p <= math.MaxUint32 && v <= math.MaxUint32 {
+				if d := (math.MaxUint32 - p) + v + 1; d <= math.MaxUint32/2 {
+					return float64(d), true
+				}
+			}
+			return 0, false
+		}
+		if p > math.MaxUint64/2 && v < math.MaxUint64/2 {
+			return float64((math.MaxUint64 - p) + v + 1), true
+		}
+	case uint32:
+		p, ok := prev.(uint32)
+		if !ok {
+			return 0, false
+		}
+		if v >= p {
+			return float64(v - p), true
+		}
+		if p > math.MaxUint32/2 && v < math.MaxUint32/2 {
+			return float64((math.MaxUint32 - p) + v + 1), true
+		}
+	case int64:
+		if p, ok := prev.(int64); ok && v >= p {
+			return float64(v - p), true
+		}
+	case int32:
+		if p, ok := prev.(int32); ok && v >= p {
+			return float64(v - p), true
+		}
+	case int:
+		if p, ok := prev.(int); ok && v >= p {
+			return float64(v - p), true
+		}
+	}
+
+	return 0, false
+}
@@ -9,7 +9,10 @@ package procfs
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"reflect"
+	"regexp"
 	"testing"
 	"time"
 
@@ -156,3 +159,287 @@ func TestSetStatus(t *testing.T) {
 	c.setStatus(m, nil)
 
 }
+
+func TestSetRateOptions(t *testing.T) {
+	t.Log("Testing setRateOptions")
+
+	t.Log("\tvalid")
+	{
+		c := &pfscommon{id: "foo"}
+		if err := c.setRateOptions("Also", []string{"bar`.+"}); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		if c.rateMode != rateModeAlso {
+			t.Fatalf("expected (%s) got (%s)", rateModeAlso, c.rateMode)
+		}
+		if len(c.rateMetrics) != 1 {
+			t.Fatalf("expected 1 rate metric regex, got %d", len(c.rateMetrics))
+		}
+	}
+
+	t.Log("\tinvalid mode")
+	{
+		c := &pfscommon{id: "foo"}
+		if err := c.setRateOptions("sometimes", nil); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tinvalid regex")
+	{
+		c := &pfscommon{id: "foo"}
+		if err := c.setRateOptions(rateModeOnly, []string{"[foo"}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestApplyRates(t *testing.T) {
+	t.Log("Testing applyRates")
+
+	t.Log("\tmode also")
+	{
+		c := &pfscommon{id: "foo", rateMode: rateModeAlso}
+		c.rateCounters = regexp.MustCompile(fmt.Sprintf(regexPat, "bytes"))
+
+		c.lastStart = time.Now()
+		m := cgm.Metrics{
+			"foo`bytes|ST[dev:sda]": cgm.Metric{Type: "L", Value: uint64(1000)},
+			"foo`gauge":             cgm.Metric{Type: "n", Value: float64(1.5)},
+			"foo`inuse":             cgm.Metric{Type: "L", Value: uint64(10)},
+		}
+		c.applyRates(m)
+		if len(m) != 3 {
+			t.Fatalf("expected no rates for first sample, got %v", m)
+		}
+
+		c.lastStart = c.lastStart.Add(10 * time.Second)
+		m = cgm.Metrics{
+			"foo`bytes|ST[dev:sda]": cgm.Metric{Type: "L", Value: uint64(3000)},
+			"foo`gauge":             cgm.Metric{Type: "n", Value: float64(2.5)},
+			"foo`inuse":             cgm.Metric{Type: "L", Value: uint64(20)},
+		}
+		c.applyRates(m)
+		r, ok := m["foo`bytes_per_sec|ST[dev:sda]"]
+		if !ok {
+			t.Fatalf("expected rate metric, got %v", m)
+		}
+		if v := r.Value.(float64); v != 200 {
+			t.Fatalf("expected 200, got %f", v)
+		}
+		if _, ok := m["foo`bytes|ST[dev:sda]"]; !ok {
+			t.Fatal("expected counter metric")
+		}
+		if _, ok := m["foo`gauge_per_sec"]; ok {
+			t.Fatal("expected no rate for non-integer metric")
+		}
+		if _, ok := m["foo`inuse_per_sec"]; ok {
+			t.Fatal("expected no rate for integer gauge")
+		}
+
+		c.lastStart = c.lastStart.Add(10 * time.Second)
+		m = cgm.Metrics{
+			"foo`bytes|ST[dev:sda]": cgm.Metric{Type: "L", Value: uint64(5000000000)},
+		}
+		c.applyRates(m)
+		c.lastStart = c.lastStart.Add(10 * time.Second)
+		m = cgm.Metrics{
+			"foo`bytes|ST[dev:sda]": cgm.Metric{Type: "L", Value: uint64(10)},
+		}
+		c.applyRates(m)
+		if _, ok := m["foo`bytes_per_sec|ST[dev:sda]"]; ok {
+			t.Fatal("expected no rate after counter reset")
+		}
+	}
+
+	t.Log("\t32 bit counters")
+	{
+		c := &pfscommon{id: "foo", rateMode: rateModeAlso}
+		c.rateCounters = regexp.MustCompile(fmt.Sprintf(regexPat, ".+"))
+		c.rateCounters32 = regexp.MustCompile(fmt.Sprintf(regexPat, "[^`]+`cpu[0-9]+"))
+
+		c.lastStart = time.Now()
+		m := cgm.Metrics{
+			"foo`24`cpu0|ST[chip:PCI-MSI]": cgm.Metric{Type: "L", Value: uint64(math.MaxUint32 - 5)},
+			"foo`24|ST[chip:PCI-MSI]":      cgm.Metric{Type: "L", Value: uint64(math.MaxUint32 - 5)},
+		}
+		c.applyRates(m)
+
+		c.lastStart = c.lastStart.Add(10 * time.Second)
+		m = cgm.Metrics{
+			"foo`24`cpu0|ST[chip:PCI-MSI]": cgm.Metric{Type: "L", Value: uint64(94)},
+			"foo`24|ST[chip:PCI-MSI]":      cgm.Metric{Type: "L", Value: uint64(94)},
+		}
+		c.applyRates(m)
+		r, ok := m["foo`24`cpu0_per_sec|ST[chip:PCI-MSI]"]
+		if !ok {
+			t.Fatalf("expected rate metric for wrapped 32 bit counter, got %v", m)
+		}
+		if v := r.Value.(float64); v != 10 {
+			t.Fatalf("expected 10, got %f", v)
+		}
+		if _, ok := m["foo`24_per_sec|ST[chip:PCI-MSI]"]; ok {
+			t.Fatal("expected no rate after 64 bit counter reset")
+		}
+	}
+
+	t.Log("\tmode only, rate metrics")
+	{
+		c := &pfscommon{id: "foo"}
+		c.rateCounters = regexp.MustCompile(fmt.Sprintf(regexPat, "(rd|wr)_ops"))
+		if err := c.setRateOptions(rateModeOnly, []string{"foo`rd_.+"}); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		c.lastStart = time.Now()
+		m := cgm.Metrics{
+			"foo`rd_ops":  cgm.Metric{Type: "I", Value: uint32(10)},
+			"foo`wr_ops":  cgm.Metric{Type: "I", Value: uint32(10)},
+			"foo`balance": cgm.Metric{Type: "l", Value: int64(-5)},
+		}
+		c.applyRates(m)
+		if _, ok := m["foo`rd_ops"]; ok {
+			t.Fatal("expected counter to be removed")
+		}
+		if len(m) != 2 {
+			t.Fatalf("expected 2 metrics, got %v", m)
+		}
+
+		c.lastStart = c.lastStart.Add(2 * time.Second)
+		m = cgm.Metrics{
+			"foo`rd_ops":  cgm.Metric{Type: "I", Value: uint32(30)},
+			"foo`wr_ops":  cgm.Metric{Type: "I", Value: uint32(30)},
+			"foo`balance": cgm.Metric{Type: "l", Value: int64(5)},
+		}
+		c.applyRates(m)
+		r, ok := m["foo`rd_ops_per_sec"]
+		if !ok {
+			t.Fatalf("expected rate metric, got %v", m)
+		}
+		if v := r.Value.(float64); v != 10 {
+			t.Fatalf("expected 10, got %f", v)
+		}
+		if _, ok := m["foo`wr_ops_per_sec"]; ok {
+			t.Fatal("expected no rate for metric not in rate metrics")
+		}
+		if _, ok := m["foo`wr_ops"]; !ok {
+			t.Fatal("expected counter for metric not in rate metrics")
+		}
+		if _, ok := m["foo`balance"]; !ok {
+			t.Fatal("expected gauge to be kept")
+		}
+	}
+
+	t.Log("\tmode only, all counters")
+	{
+		c := &pfscommon{id: "diskstats", rateCounters: diskstatsCounters}
+		if err := c.setRateOptions(rateModeOnly, nil); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		c.lastStart = time.Now()
+		m := cgm.Metrics{
+			"diskstats`sda`rd_bytes":       cgm.Metric{Type: "L", Value: uint64(100)},
+			"diskstats`sda`io_in_progress": cgm.Metric{Type: "L", Value: uint64(3)},
+		}
+		c.applyRates(m)
+		c.lastStart = c.lastStart.Add(time.Second)
+		m = cgm.Metrics{
+			"diskstats`sda`rd_bytes":       cgm.Metric{Type: "L", Value: uint64(300)},
+			"diskstats`sda`io_in_progress": cgm.Metric{Type: "L", Value: uint64(1)},
+		}
+		c.applyRates(m)
+		if _, ok := m["diskstats`sda`rd_bytes_per_sec"]; !ok {
+			t.Fatalf("expected rate metric, got %v", m)
+		}
+		if _, ok := m["diskstats`sda`rd_bytes"]; ok {
+			t.Fatal("expected counter to be removed")
+		}
+		if v, ok := m["diskstats`sda`io_in_progress"]; !ok || v.Value.(uint64) != 1 {
+			t.Fatalf("expected gauge to be kept, got %v", m)
+		}
+		if _, ok := m["diskstats`sda`io_in_progress_per_sec"]; ok {
+			t.Fatal("expected no rate for gauge")
+		}
+	}
+
+	t.Log("\tno counters")
+	{
+		c := &pfscommon{id: "fs", rateMode: rateModeOnly}
+		c.lastStart = time.Now()
+		m := cgm.Metrics{"fs`/`used_bytes": cgm.Metric{Type: "L", Value: uint64(100)}}
+		c.applyRates(m)
+		c.lastStart = c.lastStart.Add(time.Second)
+		m = cgm.Metrics{"fs`/`used_bytes": cgm.Metric{Type: "L", Value: uint64(200)}}
+		c.applyRates(m)
+		if len(m) != 1 {
+			t.Fatalf("expected only the gauge, got %v", m)
+		}
+	}
+
+	t.Log("\tdeclared counters")
+	{
+		tests := []struct {
+			c      *pfscommon
+			name   string
+			expect bool
+		}{
+			{&pfscommon{id: "if", rateCounters: ifCounters, rateGauges: ifGauges}, "if`eth0`in_bytes", true},
+			{&pfscommon{id: "if", rateCounters: ifCounters, rateGauges: ifGauges}, "if`tcpext`ListenDrops", true},
+			{&pfscommon{id: "if", rateCounters: ifCounters, rateGauges: ifGauges}, "if`tcp`CurrEstab", false},
+			{&pfscommon{id: "if", rateCounters: ifCounters, rateGauges: ifGauges}, "if`tcp`inuse", false},
+			{&pfscommon{id: "if", rateCounters: ifCounters, rateGauges: ifGauges}, "if`tcp`connections", false},
+			{&pfscommon{id: "cpu", rateCounters: cpuCounters}, "cpu`context_switch", true},
+			{&pfscommon{id: "cpu", rateCounters: cpuCounters}, "cpu`procs_runnable", false},
+			{&pfscommon{id: "vm", rateCounters: vmCounters}, "vm`info`page_fault`major", true},
+			{&pfscommon{id: "vm", rateCounters: vmCounters}, "vm`meminfo`MemFree", false},
+			{&pfscommon{id: "zfs", rateCounters: zfsCounters}, "zfs`arcstats`l2_hits", true},
+			{&pfscommon{id: "zfs", rateCounters: zfsCounters}, "zfs`arcstats`size", false},
+			{&pfscommon{id: "cgroup", rateCounters: cgroupCounters}, "cgroup`memory`usage_bytes", false},
+			{&pfscommon{id: "cgroup", rateCounters: cgroupCounters}, "cgroup`memory`events`oom_kill", true},
+		}
+		for _, test := range tests {
+			if r := test.c.rateMetric(test.name); r != test.expect {
+				t.Fatalf("%s expected %v got %v", test.name, test.expect, r)
+			}
+		}
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	t.Log("Testing counterDelta")
+
+	tests := []struct {
+		desc      string
+		prev      interface{}
+		cur       interface{}
+		counter32 bool
+		expect    float64
+		ok        bool
+	}{
+		{"uint64 increase", uint64(10), uint64(25), false, 15, true},
+		{"uint64 32 bit wrap", uint64(math.MaxUint32 - 5), uint64(4), true, 10, true},
+		{"uint64 64 bit wrap", uint64(math.MaxUint64 - 5), uint64(4), false, 10, true},
+		{"uint64 reset", uint64(5000000000), uint64(10), false, 0, false},
+		{"uint64 reset 32 bit", uint64(1000), uint64(10), true, 0, false},
+		{"uint64 reset just under 2^32", uint64(math.MaxUint32 - 5), uint64(4), false, 0, false},
+		{"uint64 reset from 2^31", uint64(math.MaxUint32/2 + 10), uint64(100), false, 0, false},
+		{"uint32 wrap", uint32(math.MaxUint32 - 1), uint32(3), false, 5, true},
+		{"uint32 reset", uint32(1000), uint32(10), false, 0, false},
+		{"int64 increase", int64(-5), int64(5), false, 10, true},
+		{"int64 decrease", int64(5), int64(-5), false, 0, false},
+		{"type mismatch", uint32(5), uint64(10), false, 0, false},
+		{"float", float64(5), float64(10), false, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.desc)
+		v, ok := counterDelta(test.prev, test.cur, test.counter32)
+		if ok != test.ok {
+			t.Fatalf("expected %v got %v", test.ok, ok)
+		}
+		if v != test.expect {
+			t.Fatalf("expected %f got %f", test.expect, v)
+		}
+	}
+}
@@ -9,6 +9,7 @@ package procfs
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -40,14 +41,23 @@ type cpuOptions struct {
 	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
 	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
 	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
-	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" toml:"metrics_default_status"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
 	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
 
 	// collector specific
 	ClockHZ string `json:"clock_hz" toml:"clock_hz" yaml:"clock_hz"`
 	AllCPU  string `json:"report_all_cpus" toml:"report_all_cpus" yaml:"report_all_cpus"`
 }
 
+// cpuCounters processes, context switches and the raw cpu time ticks (only
+// emitted with rate_mode), the normalized cpu times are not counters
+var cpuCounters = regexp.MustCompile(fmt.Sprintf(regexPat, "processes|context_switch|(cpu[0-9]+`)?jiffies`.+"))
+
+// cpuJiffies names of the cpu time fields in /proc/stat, in order
+var cpuJiffies = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal", "guest", "guest_nice"}
+
 // NewCPUCollector creates new procfs cpu collector
 func NewCPUCollector(cfgBaseName string) (collector.Collector, error) {
 	procFile := "stat"
@@ -55,6 +65,7 @@ func NewCPUCollector(cfgBaseName string) (collector.Collector, error) {
 	c := CPU{}
 	c.id = "cpu"
 	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = cpuCounters
 	c.procFSPath = "/proc"
 	c.file = filepath.Join(c.procFSPath, procFile)
 	c.logger = log.With().Str("pkg", c.pkgID).Logger()
@@ -138,6 +149,10 @@ func NewCPUCollector(cfgBaseName string) (collector.Collector, error) {
 		c.runTTL = dur
 	}
 
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
 	if _, err := os.Stat(c.file); os.IsNotExist(err) {
 		return nil, errors.Wrap(err, c.pkgID)
 	}
@@ -332,5 +347,20 @@ func (c *CPU) parseCPU(fields []string) (*cgm.Metrics, error) {
 		metricBase + "intr" + metricNameSeparator + "hard":         cgm.Metric{Type: metricType, Value: (softIRQ / numCPU) / c.clockNorm},
 	}
 
+	// the raw cpu time ticks (USER_HZ) are counters, they are only
+	// emitted to compute rates (e.g. cpu`jiffies`user_per_sec)
+	if c.rateMode == rateModeAlso || c.rateMode == rateModeOnly {
+		for i, name := range cpuJiffies {
+			if len(fields) <= i+1 {
+				break
+			}
+			v, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			metrics[metricBase+"jiffies"+metricNameSeparator+name] = cgm.Metric{Type: "L", Value: v}
+		}
+	}
+
 	return &metrics, nil
 }
@@ -318,5 +318,36 @@ func TestCPUCollect(t *testing.T) {
 		if len(metrics) == 0 {
 			t.Fatalf("expected metrics, got %v", metrics)
 		}
+		if _, ok := metrics["cpu`jiffies`user"]; ok {
+			t.Fatal("expected no jiffies counters without rate mode")
+		}
+	}
+
+	t.Log("good (rate mode)")
+	{
+		c, err := NewCPUCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		c.(*CPU).rateMode = rateModeAlso
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		m, ok := metrics["cpu`jiffies`system"]
+		if !ok {
+			t.Fatalf("expected jiffies counter, got %v", metrics)
+		}
+		if v := m.Value.(uint64); v != 206 {
+			t.Fatalf("expected 206, got %d", v)
+		}
+		if !c.(*CPU).rateMetric("cpu`jiffies`system") {
+			t.Fatal("expected jiffies to be a rate counter")
+		}
+		if c.(*CPU).rateMetric("cpu`user") {
+			t.Fatal("expected normalized cpu time to not be a rate counter")
+		}
 	}
 }
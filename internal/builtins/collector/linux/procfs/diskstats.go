@@ -33,6 +33,8 @@ type Diskstats struct {
 	exclude           *regexp.Regexp
 	sectorSizeDefault uint64
 	sectorSizeCache   map[string]uint64
+	lastStats         map[string]*dstats // previous stats for each device, used for derived metrics
+	lastCollect       time.Time          // time previous stats were collected
 }
 
 // diskstatsOptions defines what elements can be overriden in a config file
@@ -42,8 +44,10 @@ type diskstatsOptions struct {
 	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
 	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
 	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
-	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" toml:"metrics_default_status"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
 	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
 
 	// collector specific
 	IncludeRegex      string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
@@ -68,6 +72,9 @@ type dstats struct {
 	iomsWeighted    uint64
 }
 
+// diskstatsCounters the io and time counters, io_in_progress is a gauge
+var diskstatsCounters = regexp.MustCompile(fmt.Sprintf(regexPat, "[^`]+`((rd|wr)_(completed|merged|sectors|bytes|ms)|io_ms|io_ms_weighted)"))
+
 // NewDiskstatsCollector creates new procfs cpu collector
 func NewDiskstatsCollector(cfgBaseName string) (collector.Collector, error) {
 	procFile := "diskstats"
@@ -75,12 +82,14 @@ func NewDiskstatsCollector(cfgBaseName string) (collector.Collector, error) {
 	c := Diskstats{}
 	c.id = "diskstats"
 	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = diskstatsCounters
 	c.procFSPath = "/proc"
 	c.file = filepath.Join(c.procFSPath, procFile)
 	c.logger = log.With().Str("pkg", c.pkgID).Logger()
 	c.metricStatus = map[string]bool{}
 	c.metricDefaultActive = true
 	c.sectorSizeCache = make(map[string]uint64)
+	c.lastStats = make(map[string]*dstats)
 
 	c.include = defaultIncludeRegex
 	c.exclude = defaultExcludeRegex
@@ -165,6 +174,10 @@ func NewDiskstatsCollector(cfgBaseName string) (collector.Collector, error) {
 		c.runTTL = dur
 	}
 
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
 	if _, err := os.Stat(c.file); os.IsNotExist(err) {
 		return nil, errors.Wrap(err, c.pkgID)
 	}
@@ -195,6 +208,12 @@ func (c *Diskstats) Collect() error {
 	c.lastStart = time.Now()
 	c.Unlock()
 
+	now := c.lastStart
+	interval := float64(0)
+	if !c.lastCollect.IsZero() {
+		interval = now.Sub(c.lastCollect).Seconds()
+	}
+
 	f, err := os.Open(c.file)
 	if err != nil {
 		c.setStatus(metrics, err)
@@ -278,12 +297,80 @@ func (c *Diskstats) Collect() error {
 		c.addMetric(&metrics, pfx+devID, "io_in_progress", metricType, devStats.currIO)
 		c.addMetric(&metrics, pfx+devID, "io_ms", metricType, devStats.ioms)
 		c.addMetric(&metrics, pfx+devID, "io_ms_weighted", metricType, devStats.iomsWeighted)
+
+		if last, ok := c.lastStats[devID]; ok && interval > 0 {
+			c.addDerivedMetrics(&metrics, pfx+devID, last, devStats, interval)
+		}
+	}
+
+	// devices which were removed are dropped, a device added with the same
+	// name starts over (no derived metrics until the next collection and the
+	// sector size is looked up again)
+	for devID := range c.sectorSizeCache {
+		if _, ok := stats[devID]; !ok {
+			delete(c.sectorSizeCache, devID)
+		}
 	}
+	c.lastStats = stats
+	c.lastCollect = now
 
 	c.setStatus(metrics, nil)
 	return nil
 }
 
+// addDerivedMetrics adds the per interval metrics computed from the previous
+// and current stats for a device, the way iostat -x computes them:
+//
+//	rd_await_ms        average time (ms) for read requests to be served (r_await)
+//	wr_await_ms        average time (ms) for write requests to be served (w_await)
+//	await_ms           average time (ms) for requests to be served (await)
+//	util_percent       percentage of time the device was busy (%util)
+//	avg_queue_size     average number of requests in queue (aqu-sz)
+//	avg_request_bytes  average size (bytes) of requests (areq-sz)
+//
+// No metrics are added if a counter went backwards (e.g. the device was
+// removed and added again between collections).
+func (c *Diskstats) addDerivedMetrics(metrics *cgm.Metrics, prefix string, last, cur *dstats, interval float64) {
+	if cur.readsCompleted < last.readsCompleted ||
+		cur.writesCompleted < last.writesCompleted ||
+		cur.bytesRead < last.bytesRead ||
+		cur.bytesWritten < last.bytesWritten ||
+		cur.readms < last.readms ||
+		cur.writems < last.writems ||
+		cur.ioms < last.ioms ||
+		cur.iomsWeighted < last.iomsWeighted {
+		c.logger.Debug().Str("device", cur.id).Msg("counter reset, skipping derived metrics")
+		return
+	}
+
+	reads := float64(cur.readsCompleted - last.readsCompleted)
+	writes := float64(cur.writesCompleted - last.writesCompleted)
+	readms := float64(cur.readms - last.readms)
+	writems := float64(cur.writems - last.writems)
+	bytes := float64((cur.bytesRead - last.bytesRead) + (cur.bytesWritten - last.bytesWritten))
+	intervalms := interval * 1000
+
+	ratio := func(n, d float64) float64 {
+		if d == 0 {
+			return 0
+		}
+		return n / d
+	}
+
+	util := ratio(float64(cur.ioms-last.ioms), intervalms) * 100
+	if util > 100 {
+		util = 100 // md devices aggregate io time of member devices
+	}
+
+	metricType := "n"
+	c.addMetric(metrics, prefix, "rd_await_ms", metricType, ratio(readms, reads))
+	c.addMetric(metrics, prefix, "wr_await_ms", metricType, ratio(writems, writes))
+	c.addMetric(metrics, prefix, "await_ms", metricType, ratio(readms+writems, reads+writes))
+	c.addMetric(metrics, prefix, "util_percent", metricType, util)
+	c.addMetric(metrics, prefix, "avg_queue_size", metricType, ratio(float64(cur.iomsWeighted-last.iomsWeighted), intervalms))
+	c.addMetric(metrics, prefix, "avg_request_bytes", metricType, ratio(bytes, reads+writes))
+}
+
 func (c *Diskstats) getSectorSize(dev string) uint64 {
 	if sz, have := c.sectorSizeCache[dev]; have {
 		return sz
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	cgm "github.com/circonus-labs/circonus-gometrics"
 	"github.com/rs/zerolog"
 )
 
@@ -221,6 +222,28 @@ func TestNewDiskstatsCollector(t *testing.T) {
 		}
 	}
 
+	t.Log("config (rate settings)")
+	{
+		c, err := NewDiskstatsCollector(filepath.Join("testdata", "config_rate_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Diskstats).rateMode != rateModeAlso {
+			t.Fatalf("expected (%s) got (%s)", rateModeAlso, c.(*Diskstats).rateMode)
+		}
+		if len(c.(*Diskstats).rateMetrics) != 1 {
+			t.Fatalf("expected 1 rate metric regex, got %d", len(c.(*Diskstats).rateMetrics))
+		}
+	}
+
+	t.Log("config (rate settings invalid)")
+	{
+		_, err := NewDiskstatsCollector(filepath.Join("testdata", "config_rate_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
 	t.Log("config (run ttl invalid)")
 	{
 		_, err := NewDiskstatsCollector(filepath.Join("testdata", "config_run_ttl_invalid_setting"))
@@ -309,5 +332,76 @@ func TestDiskstatsCollect(t *testing.T) {
 		if len(metrics) == 0 {
 			t.Fatalf("expected metrics, got %v", metrics)
 		}
+		if _, ok := metrics["diskstats`sda`util_percent"]; ok {
+			t.Fatal("expected no derived metrics on first collection")
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics = c.Flush()
+		if _, ok := metrics["diskstats`sda`util_percent"]; !ok {
+			t.Fatalf("expected derived metrics on second collection, got %v", metrics)
+		}
+	}
+}
+
+func TestDiskstatsDerivedMetrics(t *testing.T) {
+	t.Log("Testing addDerivedMetrics")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	c, err := NewDiskstatsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	last := &dstats{id: "sda", readsCompleted: 100, writesCompleted: 100, bytesRead: 4096, bytesWritten: 4096, readms: 50, writems: 100, ioms: 1000, iomsWeighted: 2000}
+
+	t.Log("	good")
+	{
+		cur := &dstats{id: "sda", readsCompleted: 150, writesCompleted: 250, bytesRead: 4096 + 204800, bytesWritten: 4096 + 614400, readms: 150, writems: 700, ioms: 1500, iomsWeighted: 4000}
+
+		metrics := cgm.Metrics{}
+		c.(*Diskstats).addDerivedMetrics(&metrics, "diskstats`sda", last, cur, 2)
+
+		expect := map[string]float64{
+			"diskstats`sda`rd_await_ms":       2,
+			"diskstats`sda`wr_await_ms":       4,
+			"diskstats`sda`await_ms":          3.5,
+			"diskstats`sda`util_percent":      25,
+			"diskstats`sda`avg_queue_size":    1,
+			"diskstats`sda`avg_request_bytes": 4096,
+		}
+		for name, val := range expect {
+			m, ok := metrics[name]
+			if !ok {
+				t.Fatalf("expected metric %s", name)
+			}
+			if v := m.Value.(float64); v != val {
+				t.Fatalf("%s expected %f, got %f", name, val, v)
+			}
+		}
+	}
+
+	t.Log("	idle")
+	{
+		metrics := cgm.Metrics{}
+		c.(*Diskstats).addDerivedMetrics(&metrics, "diskstats`sda", last, last, 2)
+		if v := metrics["diskstats`sda`await_ms"].Value.(float64); v != 0 {
+			t.Fatalf("expected 0, got %f", v)
+		}
+	}
+
+	t.Log("	counter reset")
+	{
+		cur := &dstats{id: "sda", readsCompleted: 5}
+
+		metrics := cgm.Metrics{}
+		c.(*Diskstats).addDerivedMetrics(&metrics, "diskstats`sda", last, cur, 2)
+		if len(metrics) != 0 {
+			t.Fatalf("expected no metrics, got %v", metrics)
+		}
 	}
 }
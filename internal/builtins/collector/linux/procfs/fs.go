@@ -0,0 +1,456 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// FS file system usage metrics for the mounts in the Linux ProcFS mountinfo
+type FS struct {
+	pfscommon
+	include       *regexp.Regexp
+	exclude       *regexp.Regexp
+	fsInclude     *regexp.Regexp
+	fsExclude     *regexp.Regexp
+	hung          map[string]bool
+	statfs        func(string, *syscall.Statfs_t) error
+	statfsTimeout time.Duration
+}
+
+// fsOptions defines what elements can be overriden in a config file
+type fsOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+
+	// collector specific
+	IncludeRegex     string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
+	ExcludeRegex     string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+	FSIncludeRegex   string `json:"fs_include_regex" toml:"fs_include_regex" yaml:"fs_include_regex"`
+	FSExcludeRegex   string `json:"fs_exclude_regex" toml:"fs_exclude_regex" yaml:"fs_exclude_regex"`
+	IncludeNetworkFS string `json:"include_network_fs" toml:"include_network_fs" yaml:"include_network_fs"`
+	StatfsTimeout    string `json:"statfs_timeout" toml:"statfs_timeout" yaml:"statfs_timeout"`
+}
+
+// fsMount a mount point from mountinfo
+type fsMount struct {
+	mountPoint string
+	fsType     string
+	source     string
+	readOnly   bool
+}
+
+const (
+	// fsDefaultExclude pseudo file systems excluded by default
+	fsDefaultExclude = `autofs|binfmt_misc|bpf|cgroup|cgroup2|configfs|debugfs|devpts|devtmpfs|efivarfs|fusectl|hugetlbfs|mqueue|nsfs|proc|pstore|rpc_pipefs|securityfs|selinuxfs|squashfs|sysfs|tracefs`
+	// fsNetworkExclude network and fuse file systems excluded by default, statfs
+	// on these can block indefinitely when the server does not respond
+	fsNetworkExclude = `nfs|nfs4|cifs|smb3|smbfs|fuse\..*|9p|ceph|glusterfs`
+	// fsDefaultStatfsTimeout time to wait for statfs on a mount point
+	fsDefaultStatfsTimeout = 5 * time.Second
+)
+
+// NewFSCollector creates new procfs fs collector
+func NewFSCollector(cfgBaseName string) (collector.Collector, error) {
+	procFile := filepath.Join("self", "mountinfo")
+
+	c := FS{}
+	c.id = "fs"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.procFSPath = "/proc"
+	c.file = filepath.Join(c.procFSPath, procFile)
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+	c.hung = map[string]bool{}
+	c.statfs = syscall.Statfs
+	c.statfsTimeout = fsDefaultStatfsTimeout
+
+	c.include = defaultIncludeRegex
+	c.exclude = defaultExcludeRegex
+	c.fsInclude = defaultIncludeRegex
+	c.fsExclude = regexp.MustCompile(fmt.Sprintf(regexPat, fsDefaultExclude+"|"+fsNetworkExclude))
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts fsOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.IncludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.IncludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling include regex", c.pkgID)
+		}
+		c.include = rx
+	}
+
+	if opts.ExcludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.ExcludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling exclude regex", c.pkgID)
+		}
+		c.exclude = rx
+	}
+
+	if opts.FSIncludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.FSIncludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling fs include regex", c.pkgID)
+		}
+		c.fsInclude = rx
+	}
+
+	if opts.IncludeNetworkFS != "" {
+		include, err := strconv.ParseBool(opts.IncludeNetworkFS)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing include_network_fs", c.pkgID)
+		}
+		if include {
+			c.fsExclude = regexp.MustCompile(fmt.Sprintf(regexPat, fsDefaultExclude))
+		}
+	}
+
+	if opts.FSExcludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.FSExcludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling fs exclude regex", c.pkgID)
+		}
+		c.fsExclude = rx
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.StatfsTimeout != "" {
+		dur, err := time.ParseDuration(opts.StatfsTimeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing statfs_timeout", c.pkgID)
+		}
+		if dur <= time.Duration(0) {
+			return nil, errors.Errorf("%s invalid statfs_timeout (%s)", c.pkgID, opts.StatfsTimeout)
+		}
+		c.statfsTimeout = dur
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource
+func (c *FS) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	mounts, err := c.parseMountinfo()
+	if err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	for _, mount := range mounts {
+		if c.fsExclude.MatchString(mount.fsType) || !c.fsInclude.MatchString(mount.fsType) {
+			c.logger.Debug().Str("mount", mount.mountPoint).Str("fs_type", mount.fsType).Msg("excluded fs type, ignoring")
+			continue
+		}
+		if c.exclude.MatchString(mount.mountPoint) || !c.include.MatchString(mount.mountPoint) {
+			c.logger.Debug().Str("mount", mount.mountPoint).Msg("excluded mount point, ignoring")
+			continue
+		}
+
+		st, err := c.statfsMount(mount.mountPoint)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("mount", mount.mountPoint).Msg("statfs, ignoring")
+			continue
+		}
+
+		// no blocks, nothing to report (e.g. a pseudo fs not excluded)
+		if st.Blocks == 0 {
+			continue
+		}
+
+		// block counts are in fragment size units, same as df
+		bsize := uint64(st.Frsize)
+		if bsize == 0 {
+			bsize = uint64(st.Bsize)
+		}
+		totalBytes := st.Blocks * bsize
+		freeBytes := st.Bavail * bsize
+		usedBytes := (st.Blocks - st.Bfree) * bsize
+
+		// same calculation as df, percent of the space available to non-root users
+		usedPct := float64(0)
+		if usedBytes+freeBytes > 0 {
+			usedPct = float64(usedBytes) / float64(usedBytes+freeBytes) * 100
+		}
+
+		usedInodes := st.Files - st.Ffree
+		usedInodesPct := float64(0)
+		if st.Files > 0 {
+			usedInodesPct = float64(usedInodes) / float64(st.Files) * 100
+		}
+
+		readOnly := 0
+		if mount.readOnly {
+			readOnly = 1
+		}
+
+		tagList := []string{
+			"mount" + tags.Delimiter + cleanTagValue(mount.mountPoint),
+			"fstype" + tags.Delimiter + cleanTagValue(mount.fsType),
+		}
+		streamTags, err := tags.PrepStreamTags(strings.Join(tagList, tags.Separator))
+		if err != nil {
+			c.logger.Warn().Err(err).Str("mount", mount.mountPoint).Msg("prep stream tags")
+			continue
+		}
+
+		c.addTaggedMetric(&metrics, c.id, "total_bytes", streamTags, "L", totalBytes)
+		c.addTaggedMetric(&metrics, c.id, "used_bytes", streamTags, "L", usedBytes)
+		c.addTaggedMetric(&metrics, c.id, "free_bytes", streamTags, "L", freeBytes)
+		c.addTaggedMetric(&metrics, c.id, "used_percent", streamTags, "n", usedPct)
+		c.addTaggedMetric(&metrics, c.id, "total_inodes", streamTags, "L", st.Files)
+		c.addTaggedMetric(&metrics, c.id, "used_inodes", streamTags, "L", usedInodes)
+		c.addTaggedMetric(&metrics, c.id, "free_inodes", streamTags, "L", st.Ffree)
+		c.addTaggedMetric(&metrics, c.id, "used_inodes_percent", streamTags, "n", usedInodesPct)
+		c.addTaggedMetric(&metrics, c.id, "read_only", streamTags, "i", readOnly)
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// statfsMount runs statfs for a mount point with a deadline (statfsTimeout). A
+// call which does not return in time (e.g. a hung nfs server) is abandoned and
+// the mount point is skipped until the outstanding call returns, so collections
+// neither block nor pile up goroutines on the same mount.
+func (c *FS) statfsMount(mountPoint string) (*syscall.Statfs_t, error) {
+	c.Lock()
+	hung := c.hung[mountPoint]
+	c.Unlock()
+	if hung {
+		return nil, errors.New("previous statfs has not returned")
+	}
+
+	type statfsResult struct {
+		st  syscall.Statfs_t
+		err error
+	}
+	done := make(chan statfsResult, 1)
+	go func() {
+		var r statfsResult
+		r.err = c.statfs(mountPoint, &r.st)
+		done <- r
+	}()
+
+	timer := time.NewTimer(c.statfsTimeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &r.st, nil
+	case <-timer.C:
+	}
+
+	c.Lock()
+	c.hung[mountPoint] = true
+	c.Unlock()
+	go func() {
+		<-done
+		c.Lock()
+		delete(c.hung, mountPoint)
+		c.Unlock()
+	}()
+
+	return nil, errors.Errorf("statfs timed out after %s", c.statfsTimeout)
+}
+
+// parseMountinfo returns the mounts in mountinfo, when a mount point
+// is mounted more than once, the last (visible) mount is used
+func (c *FS) parseMountinfo() ([]fsMount, error) {
+	f, err := os.Open(c.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mounts := []fsMount{}
+	seen := map[string]int{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		//  1 mount id
+		//  2 parent id
+		//  3 major:minor
+		//  4 root
+		//  5 mount point          apply include/exclude filters
+		//  6 mount options        read only status
+		//  7 optional fields      zero or more, terminated by '-'
+		//  8 separator            '-'
+		//  9 fs type              apply fs include/exclude filters
+		// 10 mount source
+		// 11 super options
+		if len(fields) < 10 {
+			continue
+		}
+
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep == -1 || sep+2 >= len(fields) {
+			c.logger.Debug().Str("line", scanner.Text()).Msg("invalid mountinfo line, ignoring")
+			continue
+		}
+
+		mount := fsMount{
+			mountPoint: unescapeMountinfo(fields[4]),
+			fsType:     fields[sep+1],
+			source:     unescapeMountinfo(fields[sep+2]),
+		}
+		for _, opt := range strings.Split(fields[5], ",") {
+			if opt == "ro" {
+				mount.readOnly = true
+				break
+			}
+		}
+
+		if idx, ok := seen[mount.mountPoint]; ok {
+			mounts[idx] = mount
+			continue
+		}
+		seen[mount.mountPoint] = len(mounts)
+		mounts = append(mounts, mount)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", f.Name())
+	}
+
+	return mounts, nil
+}
+
+// unescapeMountinfo decodes the octal escapes (e.g. \040 for space) used in mountinfo
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b = append(b, byte(v))
+				i += 3
+				continue
+			}
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
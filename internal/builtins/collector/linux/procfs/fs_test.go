@@ -0,0 +1,320 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewFSCollector(t *testing.T) {
+	t.Log("Testing NewFSCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("no config")
+	{
+		_, err := NewFSCollector("")
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (missing)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_id_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*FS).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "self", "mountinfo")
+		if c.(*FS).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*FS).file)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (include regex)")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_include_regex_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := fmt.Sprintf(regexPat, `^foo`)
+		if c.(*FS).include.String() != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*FS).include.String())
+		}
+	}
+
+	t.Log("config (include regex invalid)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "config_include_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (exclude regex)")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_exclude_regex_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := fmt.Sprintf(regexPat, `^foo`)
+		if c.(*FS).exclude.String() != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*FS).exclude.String())
+		}
+	}
+
+	t.Log("config (fs include regex)")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_include_regex_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := fmt.Sprintf(regexPat, `^ext4`)
+		if c.(*FS).fsInclude.String() != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*FS).fsInclude.String())
+		}
+	}
+
+	t.Log("config (fs include regex invalid)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "config_fs_include_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (fs exclude regex)")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_exclude_regex_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := fmt.Sprintf(regexPat, `^tmpfs`)
+		if c.(*FS).fsExclude.String() != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*FS).fsExclude.String())
+		}
+	}
+
+	t.Log("config (fs exclude regex invalid)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "config_fs_exclude_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (include network fs)")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_include_network_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*FS).fsExclude.MatchString("nfs4") {
+			t.Fatal("expected nfs4 to be included")
+		}
+		if !c.(*FS).fsExclude.MatchString("sysfs") {
+			t.Fatal("expected sysfs to still be excluded")
+		}
+		if c.(*FS).statfsTimeout != 50*time.Millisecond {
+			t.Fatalf("expected 50ms statfs timeout, got %s", c.(*FS).statfsTimeout)
+		}
+	}
+
+	t.Log("config (statfs timeout invalid)")
+	{
+		_, err := NewFSCollector(filepath.Join("testdata", "config_fs_statfs_timeout_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*FS).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestFSCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*FS).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		statted := map[string]bool{}
+		c.(*FS).statfs = func(mountPoint string, st *syscall.Statfs_t) error {
+			statted[mountPoint] = true
+			st.Bsize = 4096
+			st.Frsize = 4096
+			if mountPoint == "/mnt/data disk" {
+				st.Bsize = 65536 // preferred io size, differs from the fragment size
+			}
+			st.Blocks = 1000
+			st.Bfree = 400
+			st.Bavail = 300
+			st.Files = 200
+			st.Ffree = 150
+			return nil
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		for _, mp := range []string{"/sys", "/proc", "/dev", "/mnt/nfs", "/mnt/sshfs"} {
+			if statted[mp] {
+				t.Fatalf("expected pseudo/network fs %s to be excluded", mp)
+			}
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 4*9 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 4*9, len(metrics), metrics)
+		}
+
+		if v := metrics["fs`used_bytes|ST[fstype:ext4,mount:/]"].Value.(uint64); v != 600*4096 {
+			t.Fatalf("expected %d used bytes, got %d", 600*4096, v)
+		}
+		if v := metrics["fs`used_percent|ST[fstype:ext4,mount:/]"].Value.(float64); v != float64(600)/float64(900)*100 {
+			t.Fatalf("unexpected used percent %f", v)
+		}
+		if v := metrics["fs`used_inodes|ST[fstype:ext4,mount:/]"].Value.(uint64); v != 50 {
+			t.Fatalf("expected 50 used inodes, got %d", v)
+		}
+		if v := metrics["fs`read_only|ST[fstype:ext4,mount:/boot]"].Value.(int); v != 1 {
+			t.Fatalf("expected /boot read only, got %d", v)
+		}
+		if _, ok := metrics["fs`total_bytes|ST[fstype:xfs,mount:/mnt/data disk]"]; !ok {
+			t.Fatalf("expected unescaped mount point, got %#v", metrics)
+		}
+		if v := metrics["fs`total_bytes|ST[fstype:xfs,mount:/mnt/data disk]"].Value.(uint64); v != 1000*4096 {
+			t.Fatalf("expected %d total bytes (fragment size), got %d", 1000*4096, v)
+		}
+	}
+
+	t.Log("statfs timeout")
+	{
+		c, err := NewFSCollector(filepath.Join("testdata", "config_fs_include_network_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		release := make(chan struct{})
+		var calls int32
+		c.(*FS).statfs = func(mountPoint string, st *syscall.Statfs_t) error {
+			if mountPoint == "/mnt/nfs" {
+				atomic.AddInt32(&calls, 1)
+				<-release
+			}
+			st.Bsize = 4096
+			st.Blocks = 1000
+			return nil
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- c.Collect() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("expected NO error, got (%s)", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected collect to return when statfs hangs")
+		}
+
+		metrics := c.Flush()
+		if _, ok := metrics["fs`total_bytes|ST[fstype:nfs4,mount:/mnt/nfs]"]; ok {
+			t.Fatal("expected hung mount to be skipped")
+		}
+		if _, ok := metrics["fs`total_bytes|ST[fstype:ext4,mount:/]"]; !ok {
+			t.Fatalf("expected other mounts to be reported, got %#v", metrics)
+		}
+
+		// hung mount is skipped, statfs is not called again while outstanding
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Fatalf("expected 1 statfs call on hung mount, got %d", n)
+		}
+
+		close(release)
+	}
+}
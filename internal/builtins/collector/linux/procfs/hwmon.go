@@ -0,0 +1,395 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// HWMon hardware sensor (temperature, fan, voltage, power, current) metrics
+// from the Linux SysFS hwmon and thermal classes
+type HWMon struct {
+	pfscommon
+	include   *regexp.Regexp
+	exclude   *regexp.Regexp
+	sysFSPath string
+}
+
+// hwmonOptions defines what elements can be overriden in a config file
+type hwmonOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+
+	// collector specific
+	SysFSPath    string `json:"sysfs_path" toml:"sysfs_path" yaml:"sysfs_path"`
+	IncludeRegex string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
+	ExcludeRegex string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+}
+
+// hwmonSensor how to report a type of hwmon sensor
+type hwmonSensor struct {
+	name       string   // metric name (without units)
+	units      string   // metric name units suffix
+	divisor    float64  // sysfs values are in milli/micro units
+	thresholds []string // threshold attributes reported, when they exist
+}
+
+// hwmonSensors sensor types by sysfs attribute prefix
+// (Documentation/hwmon/sysfs-interface)
+var hwmonSensors = map[string]hwmonSensor{
+	"temp":  {name: "temp", units: "celsius", divisor: 1000, thresholds: []string{"max", "crit"}},
+	"fan":   {name: "fan", units: "rpm", divisor: 1, thresholds: []string{"min", "max"}},
+	"in":    {name: "voltage", units: "volts", divisor: 1000, thresholds: []string{"min", "max", "crit"}},
+	"power": {name: "power", units: "watts", divisor: 1000000, thresholds: []string{"max", "crit"}},
+	"curr":  {name: "current", units: "amps", divisor: 1000, thresholds: []string{"max", "crit"}},
+}
+
+var (
+	hwmonInputRx    = regexp.MustCompile(`^(temp|fan|in|power|curr)([0-9]+)_(input|average)$`)
+	thermalTripRx   = regexp.MustCompile(`^trip_point_([0-9]+)_type$`)
+	thermalTripType = map[string]string{"critical": "crit", "hot": "hot"}
+)
+
+// NewHWMonCollector creates new hwmon collector
+func NewHWMonCollector(cfgBaseName string) (collector.Collector, error) {
+	c := HWMon{}
+	c.id = "hwmon"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.sysFSPath = "/sys"
+	c.file = filepath.Join(c.sysFSPath, "class", "hwmon")
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+
+	c.include = defaultIncludeRegex
+	c.exclude = defaultExcludeRegex
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts hwmonOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.IncludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.IncludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling include regex", c.pkgID)
+		}
+		c.include = rx
+	}
+
+	if opts.ExcludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.ExcludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling exclude regex", c.pkgID)
+		}
+		c.exclude = rx
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.SysFSPath != "" {
+		c.sysFSPath = opts.SysFSPath
+		c.file = filepath.Join(c.sysFSPath, "class", "hwmon")
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the sysfs resources
+func (c *HWMon) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	if err := c.hwmonCollect(&metrics); err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	// thermal zones are optional (e.g. not present in most virtual machines)
+	if err := c.thermalCollect(&metrics); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		c.logger.Warn().Err(err).Msg("thermal zones")
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// hwmonCollect gets sensor metrics from /sys/class/hwmon/hwmon*
+func (c *HWMon) hwmonCollect(metrics *cgm.Metrics) error {
+	chipDirs, err := filepath.Glob(filepath.Join(c.file, "hwmon*"))
+	if err != nil {
+		return errors.Wrap(err, "hwmon")
+	}
+
+	for _, hwmonDir := range chipDirs {
+		dir := hwmonDir
+		chip := readString(filepath.Join(dir, "name"))
+		if chip == "" {
+			// older drivers put the attributes in the device directory
+			chip = readString(filepath.Join(dir, "device", "name"))
+			if chip != "" {
+				dir = filepath.Join(dir, "device")
+			}
+		}
+		if chip == "" {
+			c.logger.Debug().Str("dir", dir).Msg("no chip name, skipping")
+			continue
+		}
+		if c.exclude.MatchString(chip) || !c.include.MatchString(chip) {
+			c.logger.Debug().Str("chip", chip).Msg("excluded chip name, skipping")
+			continue
+		}
+
+		// the device distinguishes multiple instances of the same chip
+		device := ""
+		if p, err := filepath.EvalSymlinks(filepath.Join(hwmonDir, "device")); err == nil {
+			device = filepath.Base(p)
+		}
+
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("dir", dir).Msg("reading hwmon directory")
+			continue
+		}
+
+		for _, entry := range entries {
+			m := hwmonInputRx.FindStringSubmatch(entry.Name())
+			if m == nil {
+				continue
+			}
+			attrBase := m[1] + m[2] // e.g. temp1
+			sensor := hwmonSensors[m[1]]
+
+			// some drivers (e.g. acpi power_meter, fam15h_power) only
+			// have an average, use it when there is no input
+			if m[3] == "average" {
+				if _, err := os.Stat(filepath.Join(dir, attrBase+"_input")); err == nil {
+					continue
+				}
+			}
+
+			val, err := readFloat(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				c.logger.Debug().Err(err).Str("chip", chip).Str("sensor", attrBase).Msg("reading sensor, skipping")
+				continue
+			}
+
+			label := readString(filepath.Join(dir, attrBase+"_label"))
+			if label == "" {
+				label = attrBase
+			}
+
+			streamTags, err := tags.PrepStreamTags(hwmonTags(chip, label, device))
+			if err != nil {
+				c.logger.Warn().Err(err).Str("chip", chip).Str("sensor", attrBase).Msg("prep stream tags")
+				continue
+			}
+
+			c.addTaggedMetric(metrics, c.id, sensor.name+"_"+sensor.units, streamTags, "n", val/sensor.divisor)
+			for _, threshold := range sensor.thresholds {
+				v, err := readFloat(filepath.Join(dir, attrBase+"_"+threshold))
+				if err != nil {
+					continue
+				}
+				c.addTaggedMetric(metrics, c.id, sensor.name+"_"+threshold+"_"+sensor.units, streamTags, "n", v/sensor.divisor)
+			}
+		}
+	}
+
+	return nil
+}
+
+// thermalCollect gets temperature metrics from /sys/class/thermal/thermal_zone*
+func (c *HWMon) thermalCollect(metrics *cgm.Metrics) error {
+	thermalDir := filepath.Join(c.sysFSPath, "class", "thermal")
+	if _, err := os.Stat(thermalDir); err != nil {
+		return errors.Wrap(err, "thermal")
+	}
+
+	zoneDirs, err := filepath.Glob(filepath.Join(thermalDir, "thermal_zone*"))
+	if err != nil {
+		return errors.Wrap(err, "thermal")
+	}
+
+	pfx := c.id + metricNameSeparator + "thermal"
+	for _, dir := range zoneDirs {
+		zone := filepath.Base(dir)
+		zoneType := readString(filepath.Join(dir, "type"))
+		if c.exclude.MatchString(zoneType) || !c.include.MatchString(zoneType) {
+			c.logger.Debug().Str("zone", zone).Str("type", zoneType).Msg("excluded zone type, skipping")
+			continue
+		}
+
+		temp, err := readFloat(filepath.Join(dir, "temp"))
+		if err != nil {
+			c.logger.Debug().Err(err).Str("zone", zone).Msg("reading temp, skipping")
+			continue
+		}
+
+		tagList := []string{"zone" + tags.Delimiter + zone}
+		if zoneType != "" {
+			tagList = append(tagList, "type"+tags.Delimiter+cleanTagValue(zoneType))
+		}
+		zoneTags := strings.Join(tagList, tags.Separator)
+		streamTags, err := tags.PrepStreamTags(zoneTags)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("zone", zone).Msg("prep stream tags")
+			continue
+		}
+
+		c.addTaggedMetric(metrics, pfx, "temp_celsius", streamTags, "n", temp/1000)
+
+		trips, _ := filepath.Glob(filepath.Join(dir, "trip_point_*_type"))
+		for _, trip := range trips {
+			m := thermalTripRx.FindStringSubmatch(filepath.Base(trip))
+			if m == nil {
+				continue
+			}
+			threshold, ok := thermalTripType[readString(trip)]
+			if !ok {
+				continue // passive, active
+			}
+			v, err := readFloat(filepath.Join(dir, "trip_point_"+m[1]+"_temp"))
+			if err != nil {
+				continue
+			}
+			// a zone may have several trip points of the same type
+			tripTags, err := tags.PrepStreamTags(zoneTags + tags.Separator + "trip" + tags.Delimiter + m[1])
+			if err != nil {
+				c.logger.Warn().Err(err).Str("zone", zone).Msg("prep stream tags")
+				continue
+			}
+			c.addTaggedMetric(metrics, pfx, "temp_"+threshold+"_celsius", tripTags, "n", v/1000)
+		}
+	}
+
+	return nil
+}
+
+// hwmonTags returns the stream tags for an hwmon sensor
+func hwmonTags(chip, label, device string) string {
+	tagList := []string{
+		"chip" + tags.Delimiter + cleanTagValue(chip),
+		"sensor" + tags.Delimiter + cleanTagValue(label),
+	}
+	if device != "" {
+		tagList = append(tagList, "device"+tags.Delimiter+cleanTagValue(device))
+	}
+
+	sort.Strings(tagList)
+	return strings.Join(tagList, tags.Separator)
+}
+
+// readString reads a file containing a single string value, returns
+// an empty string if the file cannot be read
+func readString(fn string) string {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readFloat reads a file containing a single numeric value
+func readFloat(fn string) (float64, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+}
@@ -0,0 +1,171 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewHWMonCollector(t *testing.T) {
+	t.Log("Testing NewHWMonCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("config (missing)")
+	{
+		_, err := NewHWMonCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewHWMonCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (sysfs path setting)")
+	{
+		c, err := NewHWMonCollector(filepath.Join("testdata", "config_hwmon_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "hwmon", "class", "hwmon")
+		if c.(*HWMon).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*HWMon).file)
+		}
+	}
+
+	t.Log("config (sysfs path setting invalid)")
+	{
+		_, err := NewHWMonCollector(filepath.Join("testdata", "config_hwmon_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (include regex invalid)")
+	{
+		_, err := NewHWMonCollector(filepath.Join("testdata", "config_include_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (exclude regex invalid)")
+	{
+		_, err := NewHWMonCollector(filepath.Join("testdata", "config_exclude_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestHWMonCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewHWMonCollector(filepath.Join("testdata", "config_hwmon_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*HWMon).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good")
+	{
+		c, err := NewHWMonCollector(filepath.Join("testdata", "config_hwmon_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+
+		// coretemp 2 temps (+3 thresholds), nct6775 fan (+1), voltage (+2), power and current,
+		// acpitz temp, legacy w83627ehf temp, power_meter average power,
+		// 2 thermal zones (+2 critical and 1 hot trip points)
+		expectCount := (2 + 3) + (1 + 1) + (1 + 2) + 1 + 1 + 1 + 1 + 1 + (2 + 3)
+		if len(metrics) != expectCount {
+			t.Fatalf("expected %d metrics, got %d (%#v)", expectCount, len(metrics), metrics)
+		}
+
+		expect := map[string]float64{
+			"hwmon`temp_celsius|ST[chip:coretemp,device:coretemp.0,sensor:Package id 0]":     45,
+			"hwmon`temp_max_celsius|ST[chip:coretemp,device:coretemp.0,sensor:Package id 0]": 84,
+			"hwmon`temp_crit_celsius|ST[chip:coretemp,device:coretemp.0,sensor:Core 0]":      100,
+			"hwmon`fan_rpm|ST[chip:nct6775,device:nct6775.656,sensor:fan1]":                  1250,
+			"hwmon`fan_min_rpm|ST[chip:nct6775,device:nct6775.656,sensor:fan1]":              300,
+			"hwmon`voltage_volts|ST[chip:nct6775,device:nct6775.656,sensor:Vcore]":           1.216,
+			"hwmon`voltage_max_volts|ST[chip:nct6775,device:nct6775.656,sensor:Vcore]":       1.744,
+			"hwmon`power_watts|ST[chip:nct6775,device:nct6775.656,sensor:power1]":            65.5,
+			"hwmon`current_amps|ST[chip:nct6775,device:nct6775.656,sensor:curr1]":            1.5,
+			"hwmon`temp_celsius|ST[chip:acpitz,sensor:temp1]":                                27.8,
+			"hwmon`temp_celsius|ST[chip:w83627ehf,device:w83627ehf.2560,sensor:temp1]":       38,
+			"hwmon`power_watts|ST[chip:power_meter,device:ACPI000D_00,sensor:power1]":        180,
+			"hwmon`thermal`temp_celsius|ST[type:x86_pkg_temp,zone:thermal_zone0]":            46,
+			"hwmon`thermal`temp_crit_celsius|ST[trip:0,type:acpitz,zone:thermal_zone1]":      105,
+			"hwmon`thermal`temp_hot_celsius|ST[trip:1,type:acpitz,zone:thermal_zone1]":       95,
+			"hwmon`thermal`temp_crit_celsius|ST[trip:2,type:acpitz,zone:thermal_zone1]":      110,
+		}
+		for name, val := range expect {
+			m, ok := metrics[name]
+			if !ok {
+				t.Fatalf("expected metric %s (%#v)", name, metrics)
+			}
+			if v := m.Value.(float64); v != val {
+				t.Fatalf("%s expected %f, got %f", name, val, v)
+			}
+		}
+	}
+
+	t.Log("exclude")
+	{
+		c, err := NewHWMonCollector(filepath.Join("testdata", "config_hwmon_exclude_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if _, ok := metrics["hwmon`temp_celsius|ST[chip:acpitz,sensor:temp1]"]; ok {
+			t.Fatal("expected acpitz chip to be excluded")
+		}
+		if _, ok := metrics["hwmon`thermal`temp_celsius|ST[type:acpitz,zone:thermal_zone1]"]; ok {
+			t.Fatal("expected acpitz zone to be excluded")
+		}
+		if _, ok := metrics["hwmon`thermal`temp_celsius|ST[type:x86_pkg_temp,zone:thermal_zone0]"]; !ok {
+			t.Fatal("expected x86_pkg_temp zone")
+		}
+	}
+}
@@ -38,14 +38,22 @@ type ifOptions struct {
 	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
 	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
 	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
-	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" toml:"metrics_default_status"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
 	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
 
 	// collector specific
 	IncludeRegex string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
 	ExcludeRegex string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
 }
 
+// ifCounters interface statistics and the (CamelCase) snmp/netstat counters
+var ifCounters = regexp.MustCompile(fmt.Sprintf(regexPat, "[^`]+`(in|out)_.+|tcp`segments_retransmitted|[a-z0-9]+`[A-Z][A-Za-z0-9]*"))
+
+// ifGauges metrics matched by ifCounters which are not counters
+var ifGauges = regexp.MustCompile(fmt.Sprintf(regexPat, "ip`(Forwarding|DefaultTTL)|tcp`(RtoAlgorithm|RtoMin|RtoMax|MaxConn|CurrEstab)"))
+
 // NewIFCollector creates new procfs cpu collector
 func NewIFCollector(cfgBaseName string) (collector.Collector, error) {
 	procFile := filepath.Join("net", "dev")
@@ -53,6 +61,8 @@ func NewIFCollector(cfgBaseName string) (collector.Collector, error) {
 	c := IF{}
 	c.id = "if"
 	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = ifCounters
+	c.rateGauges = ifGauges
 	c.procFSPath = "/proc"
 	c.file = filepath.Join(c.procFSPath, procFile)
 	c.logger = log.With().Str("pkg", c.pkgID).Logger()
@@ -60,7 +70,7 @@ func NewIFCollector(cfgBaseName string) (collector.Collector, error) {
 	c.metricDefaultActive = true
 
 	c.include = defaultIncludeRegex
-	c.exclude = regexp.MustCompile(fmt.Sprintf(regexPat, `lo`))
+	c.exclude = regexp.MustCompile(fmt.Sprintf(regexPat, "lo"))
 
 	if cfgBaseName == "" {
 		if _, err := os.Stat(c.file); os.IsNotExist(err) {
@@ -133,6 +143,10 @@ func NewIFCollector(cfgBaseName string) (collector.Collector, error) {
 		c.runTTL = dur
 	}
 
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
 	if _, err := os.Stat(c.file); os.IsNotExist(err) {
 		return nil, errors.Wrap(err, c.pkgID)
 	}
@@ -172,6 +186,15 @@ func (c *IF) Collect() error {
 		c.logger.Warn().Err(err).Msg("snmp")
 	}
 
+	if err := c.netstatCollect(&metrics); err != nil {
+		c.logger.Warn().Err(err).Msg("netstat")
+	}
+
+	// snmp6 is absent when ipv6 is disabled
+	if err := c.snmp6Collect(&metrics); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		c.logger.Warn().Err(err).Msg("snmp6")
+	}
+
 	if err := c.sockstatCollect(&metrics); err != nil {
 		c.logger.Warn().Err(err).Msg("sockstat")
 	}
@@ -278,14 +301,12 @@ type rawstat struct {
 	val  string
 }
 
+// snmp6ProtoRx splits /proc/net/snmp6 counter names into protocol and counter
+var snmp6ProtoRx = regexp.MustCompile(`^(Ip6|Icmp6|Udp6|UdpLite6)(.+)$`)
+
 // snmpCollect gets metrics from /proc/net/snmp
 func (c *IF) snmpCollect(metrics *cgm.Metrics) error {
 	snmpFile := strings.Replace(c.file, "dev", "snmp", -1)
-	f, err := os.Open(snmpFile)
-	if err != nil {
-		return errors.Wrap(err, "snmpCollect")
-	}
-	defer f.Close()
 
 	/*
 		Ip: Forwarding DefaultTTL InReceives InHdrErrors InAddrErrors ForwDatagrams InUnknownProtos InDiscards InDelivers OutRequests OutDiscards OutNoRoutes ReasmTimeout ReasmReqds ReasmOKs ReasmFails FragOKs FragFails FragCreates
@@ -302,29 +323,14 @@ func (c *IF) snmpCollect(metrics *cgm.Metrics) error {
 		UdpLite: 0 0 0 0 0 0 0
 	*/
 
-	stats := make(map[string][]rawstat)
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		fields := strings.Fields(line)
-
-		statType := strings.ToLower(strings.Replace(fields[0], ":", "", -1))
-
-		if strings.ContainsAny(fields[1], "abcdefghijklmnopqrstuvwxyz") {
-			// header row
-			stats[statType] = make([]rawstat, len(fields))
-			for i := 1; i < len(fields); i++ {
-				stats[statType][i].name = fields[i]
-			}
-		} else {
-			// stats row
-			for i := 1; i < len(fields); i++ {
-				stats[statType][i].val = fields[i]
-			}
-		}
+	stats, err := c.parseProtoStats(snmpFile)
+	if err != nil {
+		return errors.Wrap(err, "snmpCollect")
 	}
 
+	c.addProtoMetrics(metrics, stats)
+
+	// retained for compatibility, same value as tcp`RetransSegs
 	pfx := c.id + metricNameSeparator + "tcp"
 	metricType := "L" // uint64
 	for _, n := range stats["tcp"] {
@@ -339,13 +345,148 @@ func (c *IF) snmpCollect(metrics *cgm.Metrics) error {
 		}
 	}
 
+	return nil
+}
+
+// netstatCollect gets metrics from /proc/net/netstat
+func (c *IF) netstatCollect(metrics *cgm.Metrics) error {
+	netstatFile := strings.Replace(c.file, "dev", "netstat", -1)
+
+	/*
+		TcpExt: SyncookiesSent SyncookiesRecv SyncookiesFailed ... ListenOverflows ListenDrops ... TCPTimeouts ... TCPMemoryPressures ...
+		TcpExt: 0 0 0 ... 0 0 ... 12 ... 0 ...
+		IpExt: InNoRoutes InTruncatedPkts InMcastPkts OutMcastPkts InBcastPkts OutBcastPkts InOctets OutOctets ...
+		IpExt: 0 0 0 0 0 0 28187542 2432530 ...
+	*/
+
+	stats, err := c.parseProtoStats(netstatFile)
+	if err != nil {
+		return errors.Wrap(err, "netstatCollect")
+	}
+
+	c.addProtoMetrics(metrics, stats)
+
+	return nil
+}
+
+// snmp6Collect gets metrics from /proc/net/snmp6
+func (c *IF) snmp6Collect(metrics *cgm.Metrics) error {
+	snmp6File := strings.Replace(c.file, "dev", "snmp6", -1)
+	f, err := os.Open(snmp6File)
+	if err != nil {
+		return errors.Wrap(err, "snmp6Collect")
+	}
+	defer f.Close()
+
+	/*
+		Ip6InReceives                   	14
+		Ip6InHdrErrors                  	0
+		...
+		Icmp6InMsgs                     	0
+		...
+		Udp6InDatagrams                 	0
+		...
+		UdpLite6InDatagrams             	0
+	*/
+
+	stats := make(map[string][]rawstat)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		m := snmp6ProtoRx.FindStringSubmatch(fields[0])
+		if m == nil {
+			c.logger.Debug().Str("name", fields[0]).Msg("snmp6 - unknown protocol, ignoring")
+			continue
+		}
+
+		statType := strings.ToLower(m[1])
+		stats[statType] = append(stats[statType], rawstat{name: m[2], val: fields[1]})
+	}
+
 	if err := scanner.Err(); err != nil {
-		return errors.Wrapf(err, "snmpCollect parsing %s", f.Name())
+		return errors.Wrapf(err, "snmp6Collect parsing %s", f.Name())
 	}
 
+	c.addProtoMetrics(metrics, stats)
+
 	return nil
 }
 
+// parseProtoStats parses the header and value line pairs used by
+// /proc/net/snmp and /proc/net/netstat, returns the stats keyed by
+// the lower case protocol name (e.g. tcp, tcpext)
+func (c *IF) parseProtoStats(file string) (map[string][]rawstat, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stats := make(map[string][]rawstat)
+	headers := make(map[string][]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		statType := strings.ToLower(strings.Replace(fields[0], ":", "", -1))
+
+		names, ok := headers[statType]
+		if !ok {
+			// header row
+			headers[statType] = fields[1:]
+			continue
+		}
+
+		// stats row
+		values := fields[1:]
+		if len(values) != len(names) {
+			c.logger.Warn().Str("type", statType).Int("expected", len(names)).Int("found", len(values)).Msg("invalid number of fields")
+			delete(headers, statType)
+			continue
+		}
+		for i, name := range names {
+			stats[statType] = append(stats[statType], rawstat{name: name, val: values[i]})
+		}
+		delete(headers, statType)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", f.Name())
+	}
+
+	return stats, nil
+}
+
+// addProtoMetrics adds protocol counters as metrics named <id>`<protocol>`<counter>
+// (e.g. if`tcpext`ListenDrops), metrics_enabled and metrics_disabled use <protocol>`<counter>
+func (c *IF) addProtoMetrics(metrics *cgm.Metrics, stats map[string][]rawstat) {
+	for statType, rawstats := range stats {
+		for _, n := range rawstats {
+			mname := statType + metricNameSeparator + n.name
+			if v, err := strconv.ParseUint(n.val, 10, 64); err == nil {
+				c.addMetric(metrics, c.id, mname, "L", v) // uint64
+				continue
+			}
+			// a few counters are signed, e.g. Tcp MaxConn is -1 (dynamic)
+			v, err := strconv.ParseInt(n.val, 10, 64)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("type", statType).Msg("parsing field " + n.name)
+				continue
+			}
+			c.addMetric(metrics, c.id, mname, "l", v) // int64
+		}
+	}
+}
+
 // sockstatCollect gets metrics from /proc/net/sockstat and /proc/net/sockstat6
 func (c *IF) sockstatCollect(metrics *cgm.Metrics) error {
 
@@ -311,3 +311,62 @@ func TestIFCollect(t *testing.T) {
 		}
 	}
 }
+
+func TestIFProtoCollect(t *testing.T) {
+	t.Log("Testing Collect protocol counters")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	c, err := NewIFCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	c.(*IF).metricStatus["tcpext`TCPMemoryPressuresChrono"] = false
+
+	if err := c.Collect(); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	metrics := c.Flush()
+
+	tests := []struct {
+		name  string
+		mtype string
+		val   interface{}
+	}{
+		{"if`tcp`RetransSegs", "L", uint64(0)},
+		{"if`tcp`segments_retransmitted", "L", uint64(0)},
+		{"if`tcp`MaxConn", "l", int64(-1)},
+		{"if`ip`InReceives", "L", uint64(24796)},
+		{"if`icmpmsg`OutType3", "L", uint64(33)},
+		{"if`udp`RcvbufErrors", "L", uint64(0)},
+		{"if`udplite`InDatagrams", "L", uint64(0)},
+		{"if`tcpext`ListenDrops", "L", uint64(5)},
+		{"if`tcpext`SyncookiesSent", "L", uint64(3)},
+		{"if`tcpext`TCPTimeouts", "L", uint64(12)},
+		{"if`tcpext`TCPMemoryPressures", "L", uint64(1)},
+		{"if`ipext`InOctets", "L", uint64(28187542)},
+		{"if`ip6`InReceives", "L", uint64(14)},
+		{"if`icmp6`InType134", "L", uint64(2)},
+		{"if`udp6`RcvbufErrors", "L", uint64(1)},
+		{"if`udplite6`InDatagrams", "L", uint64(0)},
+	}
+
+	for _, test := range tests {
+		m, ok := metrics[test.name]
+		if !ok {
+			t.Fatalf("expected metric %s", test.name)
+		}
+		if m.Type != test.mtype {
+			t.Fatalf("%s expected type %s, got %s", test.name, test.mtype, m.Type)
+		}
+		if m.Value != test.val {
+			t.Fatalf("%s expected %v, got %v", test.name, test.val, m.Value)
+		}
+	}
+
+	if _, ok := metrics["if`tcpext`TCPMemoryPressuresChrono"]; ok {
+		t.Fatal("expected disabled metric to be excluded")
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Interrupts metrics from the Linux ProcFS
+type Interrupts struct {
+	pfscommon
+	reportAllCPUs bool // OPT report all cpus (vs just total) may be overriden in config file
+}
+
+// interruptsOptions defines what elements can be overriden in a config file
+type interruptsOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+
+	// collector specific
+	AllCPU string `json:"report_all_cpus" toml:"report_all_cpus" yaml:"report_all_cpus"`
+}
+
+// cpuTableRow a row from a per cpu table (/proc/interrupts, /proc/softirqs)
+type cpuTableRow struct {
+	name   string   // row name, without the colon
+	counts []uint64 // count for each cpu column
+	total  uint64   // sum of counts
+	desc   []string // remaining fields (e.g. interrupt chip and device names)
+}
+
+// interruptsCounters all interrupt counts
+var interruptsCounters = regexp.MustCompile(fmt.Sprintf(regexPat, ".+"))
+
+// interruptsCounters32 the per cpu and error counts, which are 32 bit in the kernel
+var interruptsCounters32 = regexp.MustCompile(fmt.Sprintf(regexPat, "[^`]+`cpu[0-9]+|ERR|MIS"))
+
+// interruptHwirqRx hwirq and trigger fields of numbered interrupts, e.g. '2-edge',
+// '524288-edge', '27' and 'Level' (gic)
+var interruptHwirqRx = regexp.MustCompile(`^(?:[0-9]+(?:-[a-z_]+)?|0x[0-9a-f]+|[Ee]dge|[Ll]evel)$`)
+
+// NewInterruptsCollector creates new procfs interrupts collector
+func NewInterruptsCollector(cfgBaseName string) (collector.Collector, error) {
+	procFile := "interrupts"
+
+	c := Interrupts{}
+	c.id = "interrupts"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = interruptsCounters
+	c.rateCounters32 = interruptsCounters32
+	c.procFSPath = "/proc"
+	c.file = filepath.Join(c.procFSPath, procFile)
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+	c.reportAllCPUs = false
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts interruptsOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.AllCPU != "" {
+		rpt, err := strconv.ParseBool(opts.AllCPU)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing report_all_cpus", c.pkgID)
+		}
+		c.reportAllCPUs = rpt
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource
+func (c *Interrupts) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	cpus, rows, err := parseCPUTable(c.file)
+	if err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	metricType := "L" // uint64
+	for _, row := range rows {
+		streamTags, err := tags.PrepStreamTags(interruptTags(row))
+		if err != nil {
+			c.logger.Warn().Err(err).Str("irq", row.name).Msg("prep stream tags")
+			continue
+		}
+
+		c.addTaggedMetric(&metrics, c.id, row.name, streamTags, metricType, row.total)
+
+		if !c.reportAllCPUs {
+			continue
+		}
+		for i, v := range row.counts {
+			c.addTaggedMetric(&metrics, c.id, row.name+metricNameSeparator+cpus[i], streamTags, metricType, v)
+		}
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// interruptTags returns the stream tags for an interrupt, numbered interrupts
+// have the interrupt chip and the device name(s), the others (e.g. NMI, LOC)
+// have the description
+//
+//	 24:     123456        789   PCI-MSI 524288-edge      eth0-TxRx-0
+//	  1:          9          0   IO-APIC   1-edge      i8042
+//	  0:         44          0   IO-APIC-edge      timer
+//	 11:     123456     120000     GICv3  27 Level     arch_timer
+//	NMI:          0          0   Non-maskable interrupts
+func interruptTags(row cpuTableRow) string {
+	if len(row.desc) == 0 {
+		return ""
+	}
+
+	tagList := []string{}
+	if _, err := strconv.Atoi(row.name); err == nil {
+		tagList = append(tagList, "chip"+tags.Delimiter+cleanTagValue(row.desc[0]))
+		for _, dev := range interruptDevices(row.desc[1:]) {
+			tagList = append(tagList, "device"+tags.Delimiter+cleanTagValue(dev))
+		}
+	} else {
+		tagList = append(tagList, "description"+tags.Delimiter+cleanTagValue(strings.Join(row.desc, " ")))
+	}
+
+	sort.Strings(tagList)
+	return strings.Join(tagList, tags.Separator)
+}
+
+// interruptDevices returns the device names from the fields following the
+// interrupt chip. The hwirq and trigger fields vary by kernel and interrupt
+// controller (e.g. '524288-edge', '27 Level', none on 3.x kernels where the
+// trigger is part of the chip name), the devices are the fields to the right
+// of the last hwirq/trigger field, devices sharing the interrupt are comma
+// separated.
+func interruptDevices(fields []string) []string {
+	start := 0
+	for i := len(fields) - 1; i >= 0; i-- {
+		if interruptHwirqRx.MatchString(fields[i]) {
+			start = i + 1
+			break
+		}
+	}
+	if start >= len(fields) {
+		return nil
+	}
+
+	devices := []string{}
+	for _, dev := range strings.Split(strings.Join(fields[start:], " "), ",") {
+		if dev = strings.TrimSpace(dev); dev != "" {
+			devices = append(devices, dev)
+		}
+	}
+	return devices
+}
+
+// parseCPUTable parses a file with a header row of cpu names followed by rows
+// of per cpu counts (e.g. /proc/interrupts, /proc/softirqs), returns the cpu
+// names (e.g. cpu0) and the rows. Rows with fewer counts than cpus (e.g. ERR
+// and MIS in /proc/interrupts) have only a total.
+func parseCPUTable(fn string) ([]string, []cpuTableRow, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "opening")
+	}
+	defer f.Close()
+
+	var cpus []string
+	rows := []cpuTableRow{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if cpus == nil {
+			// header row, offline cpus are not listed
+			cpus = make([]string, len(fields))
+			for i, name := range fields {
+				cpus[i] = strings.ToLower(name)
+			}
+			continue
+		}
+
+		if !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+
+		row := cpuTableRow{name: strings.TrimSuffix(fields[0], ":")}
+		values := fields[1:]
+		n := 0
+		for ; n < len(values) && n < len(cpus); n++ {
+			v, err := strconv.ParseUint(values[n], 10, 64)
+			if err != nil {
+				break
+			}
+			row.counts = append(row.counts, v)
+			row.total += v
+		}
+		if n < len(cpus) {
+			row.counts = nil
+		}
+		row.desc = values[n:]
+
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "reading")
+	}
+
+	if cpus == nil {
+		return nil, nil, errors.Errorf("no cpus found in %s", fn)
+	}
+
+	return cpus, rows, nil
+}
@@ -0,0 +1,242 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewInterruptsCollector(t *testing.T) {
+	t.Log("Testing NewInterruptsCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("config (missing)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_id_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Interrupts).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "interrupts")
+		if c.(*Interrupts).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*Interrupts).file)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (report all cpus setting true)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_report_all_cpus_true_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !c.(*Interrupts).reportAllCPUs {
+			t.Fatal("expected true")
+		}
+	}
+
+	t.Log("config (report all cpus setting invalid)")
+	{
+		_, err := NewInterruptsCollector(filepath.Join("testdata", "config_report_all_cpus_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Interrupts).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestInterruptsCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Interrupts).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good (totals)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 9 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 9, len(metrics), metrics)
+		}
+
+		expect := map[string]uint64{
+			"interrupts`24|ST[chip:PCI-MSI,device:eth0-TxRx-0]":        124245,
+			"interrupts`12|ST[chip:IO-APIC,device:i8042,device:serio]": 144,
+			"interrupts`LOC|ST[description:Local timer interrupts]":    2469067,
+			"interrupts`ERR": 0,
+		}
+		for name, val := range expect {
+			m, ok := metrics[name]
+			if !ok {
+				t.Fatalf("expected metric %s", name)
+			}
+			if v := m.Value.(uint64); v != val {
+				t.Fatalf("%s expected %d, got %d", name, val, v)
+			}
+		}
+	}
+
+	t.Log("good (all cpus)")
+	{
+		c, err := NewInterruptsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Interrupts).reportAllCPUs = true
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 9+7*2 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 9+7*2, len(metrics), metrics)
+		}
+
+		expect := map[string]uint64{
+			"interrupts`25`cpu1|ST[chip:PCI-MSI,device:eth0-TxRx-1]":      654321,
+			"interrupts`25`cpu0|ST[chip:PCI-MSI,device:eth0-TxRx-1]":      700,
+			"interrupts`NMI`cpu0|ST[description:Non-maskable interrupts]": 0,
+		}
+		for name, val := range expect {
+			m, ok := metrics[name]
+			if !ok {
+				t.Fatalf("expected metric %s", name)
+			}
+			if v := m.Value.(uint64); v != val {
+				t.Fatalf("%s expected %d, got %d", name, val, v)
+			}
+		}
+	}
+}
+
+func TestInterruptTags(t *testing.T) {
+	t.Log("Testing interruptTags")
+
+	tests := []struct {
+		file   string
+		expect map[string]string
+	}{
+		{"interrupts", map[string]string{
+			"0":   "chip:IO-APIC,device:timer",
+			"12":  "chip:IO-APIC,device:i8042,device:serio",
+			"24":  "chip:PCI-MSI,device:eth0-TxRx-0",
+			"NMI": "description:Non-maskable interrupts",
+		}},
+		{"interrupts_x86_3x", map[string]string{
+			"0":   "chip:IO-APIC-edge,device:timer",
+			"9":   "chip:IO-APIC-fasteoi,device:acpi",
+			"16":  "chip:IO-APIC-fasteoi,device:ehci_hcd_usb1,device:uhci_hcd_usb3",
+			"27":  "chip:PCI-MSI-edge,device:eth0-TxRx-0",
+			"NMI": "description:Non-maskable interrupts",
+		}},
+		{"interrupts_gic", map[string]string{
+			"11":   "chip:GICv3,device:arch_timer",
+			"44":   "chip:ITS-MSI,device:eth0-tx-0",
+			"45":   "chip:GICv3,device:arm-pmu",
+			"IPI0": "description:Rescheduling interrupts",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.file)
+		_, rows, err := parseCPUTable(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		found := 0
+		for _, row := range rows {
+			expect, ok := test.expect[row.name]
+			if !ok {
+				continue
+			}
+			found++
+			if tl := interruptTags(row); tl != expect {
+				t.Fatalf("%s expected (%s) got (%s)", row.name, expect, tl)
+			}
+		}
+		if found != len(test.expect) {
+			t.Fatalf("expected %d rows, found %d", len(test.expect), found)
+		}
+	}
+}
@@ -14,13 +14,15 @@ import (
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
 	"github.com/circonus-labs/circonus-agent/internal/config"
 	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
-// New creates new ProcFS collector
-func New() ([]collector.Collector, error) {
-	none := []collector.Collector{}
+// New creates new ProcFS collectors, for each builtin collector enabled in
+// the configuration, keyed by collector name
+func New() (map[string]collector.Collector, error) {
+	none := map[string]collector.Collector{}
 
 	if runtime.GOOS != "linux" {
 		return none, nil
@@ -34,55 +36,65 @@ func New() ([]collector.Collector, error) {
 		return none, nil
 	}
 
-	collectors := make([]collector.Collector, 0, len(enbledCollectors))
+	collectors := make(map[string]collector.Collector, len(enbledCollectors))
 	initErrMsg := "initializing builtin collector"
 	for _, name := range enbledCollectors {
-		cfgBase := name + "_collector"
-		switch name {
-		case "cpu":
-			c, err := NewCPUCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
+		c, err := NewCollector(name)
+		if err != nil {
+			if errors.Cause(err) == collector.ErrUnknownCollector {
+				l.Warn().Str("name", name).Msg("unknown builtin collector, ignoring")
+			} else {
 				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
-				continue
 			}
-			collectors = append(collectors, c)
-
-		case "diskstats":
-			c, err := NewDiskstatsCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "if":
-			c, err := NewIFCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "loadavg":
-			c, err := NewLoadavgCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "vm":
-			c, err := NewVMCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				l.Error().Str("name", name).Err(err).Msg(initErrMsg)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		default:
-			l.Warn().Str("name", name).Msg("unknown builtin collector, ignoring")
+			continue
 		}
+		collectors[name] = c
 	}
 
 	return collectors, nil
 }
+
+// NewCollector creates a ProcFS collector by name (e.g. cpu), using the
+// collector config file (<name>_collector) in the agent etc path
+func NewCollector(name string) (collector.Collector, error) {
+	cfgBase := path.Join(defaults.EtcPath, name+"_collector")
+
+	switch name {
+	case "cgroup":
+		return NewCgroupCollector(cfgBase)
+	case "cpu":
+		return NewCPUCollector(cfgBase)
+	case "diskstats":
+		return NewDiskstatsCollector(cfgBase)
+	case "fs":
+		return NewFSCollector(cfgBase)
+	case "hwmon":
+		return NewHWMonCollector(cfgBase)
+	case "if":
+		return NewIFCollector(cfgBase)
+	case "interrupts":
+		return NewInterruptsCollector(cfgBase)
+	case "loadavg":
+		return NewLoadavgCollector(cfgBase)
+	case "mdraid":
+		return NewMDRaidCollector(cfgBase)
+	case "nfs":
+		return NewNFSCollector(cfgBase)
+	case "pressure":
+		return NewPressureCollector(cfgBase)
+	case "proc":
+		return NewProcCollector(cfgBase)
+	case "schedstat":
+		return NewSchedstatCollector(cfgBase)
+	case "softirqs":
+		return NewSoftirqsCollector(cfgBase)
+	case "tcp":
+		return NewTCPCollector(cfgBase)
+	case "vm":
+		return NewVMCollector(cfgBase)
+	case "zfs":
+		return NewZFSCollector(cfgBase)
+	default:
+		return nil, collector.ErrUnknownCollector
+	}
+}
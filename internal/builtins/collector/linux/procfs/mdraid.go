@@ -0,0 +1,364 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// MDRaid software raid (md) array health metrics from the Linux ProcFS
+type MDRaid struct {
+	pfscommon
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// mdraidOptions defines what elements can be overriden in a config file
+type mdraidOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+
+	// collector specific
+	IncludeRegex string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
+	ExcludeRegex string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+}
+
+// mdarray status of an md array
+type mdarray struct {
+	name          string
+	state         string // active, inactive, active-auto-read-only, etc.
+	level         string // raid1, raid5, etc.
+	sizeBytes     uint64
+	disksTotal    uint64
+	disksActive   uint64
+	disksFailed   uint64
+	disksSpare    uint64
+	syncAction    string  // idle, resync, recovery, check, reshape
+	syncProgress  float64 // percent complete
+	syncSpeed     uint64  // bytes per second
+	syncRemaining float64 // estimated seconds to completion
+}
+
+var (
+	mdArrayRx    = regexp.MustCompile(`^(md[^\s]+)\s+:\s+(.+)$`)
+	mdDisksRx    = regexp.MustCompile(`\[([0-9]+)/([0-9]+)\]`)
+	mdBlocksRx   = regexp.MustCompile(`^([0-9]+) blocks`)
+	mdSyncRx     = regexp.MustCompile(`(resync|recovery|check|reshape)\s*=\s*([0-9.]+)%`)
+	mdSyncWaitRx = regexp.MustCompile(`(resync|recovery|check|reshape)\s*=\s*(DELAYED|PENDING)`)
+	mdFinishRx   = regexp.MustCompile(`finish=([0-9.]+)min`)
+	mdSpeedRx    = regexp.MustCompile(`speed=([0-9]+)K/sec`)
+)
+
+// NewMDRaidCollector creates new procfs mdraid collector
+func NewMDRaidCollector(cfgBaseName string) (collector.Collector, error) {
+	procFile := "mdstat"
+
+	c := MDRaid{}
+	c.id = "mdraid"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.procFSPath = "/proc"
+	c.file = filepath.Join(c.procFSPath, procFile)
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+
+	c.include = defaultIncludeRegex
+	c.exclude = defaultExcludeRegex
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts mdraidOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.IncludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.IncludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling include regex", c.pkgID)
+		}
+		c.include = rx
+	}
+
+	if opts.ExcludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.ExcludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling exclude regex", c.pkgID)
+		}
+		c.exclude = rx
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource
+func (c *MDRaid) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	arrays, err := c.parse()
+	if err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	pfx := c.id + metricNameSeparator
+	for _, md := range arrays {
+		if c.exclude.MatchString(md.name) || !c.include.MatchString(md.name) {
+			c.logger.Debug().Str("array", md.name).Msg("excluded array name, skipping")
+			continue
+		}
+
+		mpfx := pfx + md.name
+		degraded := 0
+		if md.disksFailed > 0 || md.disksActive < md.disksTotal || md.state == "inactive" {
+			degraded = 1
+		}
+
+		c.addMetric(&metrics, mpfx, "state", "s", md.state)
+		c.addMetric(&metrics, mpfx, "level", "s", md.level)
+		c.addMetric(&metrics, mpfx, "size_bytes", "L", md.sizeBytes)
+		c.addMetric(&metrics, mpfx, "disks_total", "L", md.disksTotal)
+		c.addMetric(&metrics, mpfx, "disks_active", "L", md.disksActive)
+		c.addMetric(&metrics, mpfx, "disks_failed", "L", md.disksFailed)
+		c.addMetric(&metrics, mpfx, "disks_spare", "L", md.disksSpare)
+		c.addMetric(&metrics, mpfx, "degraded", "i", degraded)
+		c.addMetric(&metrics, mpfx, "sync_action", "s", md.syncAction)
+		if md.syncAction != "idle" {
+			c.addMetric(&metrics, mpfx, "sync_progress_percent", "n", md.syncProgress)
+			c.addMetric(&metrics, mpfx, "sync_speed_bytes_per_sec", "L", md.syncSpeed)
+			c.addMetric(&metrics, mpfx, "sync_remaining_seconds", "n", md.syncRemaining)
+		}
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// parse /proc/mdstat, format:
+//
+//	Personalities : [raid1] [raid6] [raid5] [raid4]
+//	md1 : active raid5 sdd1[3] sdc1[1](F) sdb1[0]
+//	      2095104 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [U_U]
+//	      [=>...................]  recovery =  8.5% (89600/1047552) finish=1.7min speed=8960K/sec
+//
+//	md0 : active raid1 sdb2[1] sda2[0]
+//	      1048512 blocks super 1.2 [2/2] [UU]
+//
+//	unused devices: <none>
+func (c *MDRaid) parse() ([]*mdarray, error) {
+	f, err := os.Open(c.file)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening")
+	}
+	defer f.Close()
+
+	arrays := []*mdarray{}
+	var md *mdarray
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if m := mdArrayRx.FindStringSubmatch(line); m != nil {
+			md = c.parseArray(m[1], strings.Fields(m[2]))
+			arrays = append(arrays, md)
+			continue
+		}
+
+		if md == nil {
+			continue // Personalities, etc.
+		}
+
+		if m := mdBlocksRx.FindStringSubmatch(line); m != nil {
+			if v, err := strconv.ParseUint(m[1], 10, 64); err == nil {
+				md.sizeBytes = v * 1024 // 1k blocks
+			}
+			if m := mdDisksRx.FindStringSubmatch(line); m != nil {
+				// [total/active] supersedes the member device count
+				total, _ := strconv.ParseUint(m[1], 10, 64)
+				active, _ := strconv.ParseUint(m[2], 10, 64)
+				md.disksTotal = total
+				md.disksActive = active
+			}
+			continue
+		}
+
+		if m := mdSyncRx.FindStringSubmatch(line); m != nil {
+			md.syncAction = m[1]
+			if v, err := strconv.ParseFloat(m[2], 64); err == nil {
+				md.syncProgress = v
+			}
+			if m := mdFinishRx.FindStringSubmatch(line); m != nil {
+				if v, err := strconv.ParseFloat(m[1], 64); err == nil {
+					md.syncRemaining = v * 60
+				}
+			}
+			if m := mdSpeedRx.FindStringSubmatch(line); m != nil {
+				if v, err := strconv.ParseUint(m[1], 10, 64); err == nil {
+					md.syncSpeed = v * 1024
+				}
+			}
+			continue
+		}
+
+		if m := mdSyncWaitRx.FindStringSubmatch(line); m != nil {
+			// queued behind another array sharing the same devices
+			md.syncAction = m[1]
+			continue
+		}
+
+		if strings.HasPrefix(line, "unused devices") {
+			md = nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading")
+	}
+
+	return arrays, nil
+}
+
+// parseArray parses the fields following the colon on an array's first line
+// (e.g. "active (auto-read-only) raid1 sdb1[1] sda1[0](F)")
+func (c *MDRaid) parseArray(name string, fields []string) *mdarray {
+	md := &mdarray{name: name, syncAction: "idle"}
+
+	if len(fields) == 0 {
+		return md
+	}
+
+	md.state = fields[0]
+	fields = fields[1:]
+
+	// optional read-only qualifiers, e.g. (read-only), (auto-read-only)
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "(") {
+		md.state += "-" + strings.Trim(fields[0], "()")
+		fields = fields[1:]
+	}
+
+	// inactive arrays have no personality
+	if len(fields) > 0 && !strings.Contains(fields[0], "[") {
+		md.level = fields[0]
+		fields = fields[1:]
+	}
+
+	for _, dev := range fields {
+		switch {
+		case strings.HasSuffix(dev, "(F)"):
+			md.disksFailed++
+		case strings.HasSuffix(dev, "(S)"):
+			md.disksSpare++
+		default:
+			md.disksActive++
+		}
+	}
+	// without a [total/active] status (e.g. raid0, inactive) the members
+	// (less spares) are the total
+	md.disksTotal = md.disksActive + md.disksFailed
+
+	return md
+}
@@ -0,0 +1,239 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewMDRaidCollector(t *testing.T) {
+	t.Log("Testing NewMDRaidCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("config (missing)")
+	{
+		_, err := NewMDRaidCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewMDRaidCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewMDRaidCollector(filepath.Join("testdata", "config_mdraid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "mdraid", "mdstat")
+		if c.(*MDRaid).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*MDRaid).file)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewMDRaidCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (include regex)")
+	{
+		c, err := NewMDRaidCollector(filepath.Join("testdata", "config_include_regex_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := fmt.Sprintf(regexPat, `^foo`)
+		if c.(*MDRaid).include.String() != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*MDRaid).include.String())
+		}
+	}
+
+	t.Log("config (include regex invalid)")
+	{
+		_, err := NewMDRaidCollector(filepath.Join("testdata", "config_include_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (exclude regex)")
+	{
+		c, err := NewMDRaidCollector(filepath.Join("testdata", "config_exclude_regex_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := fmt.Sprintf(regexPat, `^foo`)
+		if c.(*MDRaid).exclude.String() != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*MDRaid).exclude.String())
+		}
+	}
+
+	t.Log("config (exclude regex invalid)")
+	{
+		_, err := NewMDRaidCollector(filepath.Join("testdata", "config_exclude_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestMDRaidCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewMDRaidCollector(filepath.Join("testdata", "config_mdraid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*MDRaid).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("ttl not expired")
+	{
+		c, err := NewMDRaidCollector(filepath.Join("testdata", "config_mdraid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*MDRaid).runTTL = 60 * time.Second
+		c.(*MDRaid).lastEnd = time.Now()
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrTTLNotExpired.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrTTLNotExpired, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("no arrays")
+	{
+		c, err := NewMDRaidCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if metrics := c.Flush(); len(metrics) != 0 {
+			t.Fatalf("expected no metrics, got %#v", metrics)
+		}
+	}
+
+	t.Log("good")
+	{
+		c, err := NewMDRaidCollector(filepath.Join("testdata", "config_mdraid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+
+		// 5 arrays with 9 metrics each, 2 syncing arrays with 3 more
+		if len(metrics) != 5*9+2*3 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 5*9+2*3, len(metrics), metrics)
+		}
+
+		tests := []struct {
+			name string
+			val  interface{}
+		}{
+			{"mdraid`md1`state", "active"},
+			{"mdraid`md1`level", "raid5"},
+			{"mdraid`md1`size_bytes", uint64(2095104 * 1024)},
+			{"mdraid`md1`disks_total", uint64(3)},
+			{"mdraid`md1`disks_active", uint64(2)},
+			{"mdraid`md1`disks_failed", uint64(1)},
+			{"mdraid`md1`degraded", 1},
+			{"mdraid`md1`sync_action", "recovery"},
+			{"mdraid`md1`sync_progress_percent", 8.5},
+			{"mdraid`md1`sync_speed_bytes_per_sec", uint64(8960 * 1024)},
+			{"mdraid`md1`sync_remaining_seconds", 1.7 * 60},
+			{"mdraid`md0`disks_total", uint64(2)},
+			{"mdraid`md0`disks_active", uint64(2)},
+			{"mdraid`md0`disks_spare", uint64(1)},
+			{"mdraid`md0`degraded", 0},
+			{"mdraid`md0`sync_action", "idle"},
+			{"mdraid`md2`state", "active-auto-read-only"},
+			{"mdraid`md2`sync_action", "resync"},
+			{"mdraid`md127`level", "raid0"},
+			{"mdraid`md127`disks_total", uint64(2)},
+			{"mdraid`md127`degraded", 0},
+			{"mdraid`md3`state", "inactive"},
+			{"mdraid`md3`level", ""},
+			{"mdraid`md3`disks_total", uint64(0)},
+			{"mdraid`md3`disks_spare", uint64(1)},
+			{"mdraid`md3`degraded", 1},
+		}
+		for _, test := range tests {
+			m, ok := metrics[test.name]
+			if !ok {
+				t.Fatalf("expected metric %s", test.name)
+			}
+			if m.Value != test.val {
+				t.Fatalf("%s expected %v, got %v", test.name, test.val, m.Value)
+			}
+		}
+	}
+
+	t.Log("exclude")
+	{
+		c, err := NewMDRaidCollector(filepath.Join("testdata", "config_mdraid_exclude_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if _, ok := metrics["mdraid`md127`state"]; ok {
+			t.Fatal("expected md127 to be excluded")
+		}
+		if _, ok := metrics["mdraid`md0`state"]; !ok {
+			t.Fatal("expected md0 metrics")
+		}
+	}
+}
@@ -0,0 +1,516 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// NFS client and server metrics from the Linux ProcFS
+type NFS struct {
+	pfscommon
+	include  *regexp.Regexp
+	exclude  *regexp.Regexp
+	mountOps map[string]bool
+}
+
+// nfsOptions defines what elements can be overriden in a config file
+type nfsOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+
+	// collector specific
+	IncludeRegex string   `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
+	ExcludeRegex string   `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+	MountOps     []string `json:"mount_ops" toml:"mount_ops" yaml:"mount_ops"`
+}
+
+// nfsProcNames procedure names by version, in the order they appear in
+// /proc/net/rpc/nfs and /proc/net/rpc/nfsd (procedures beyond the end of
+// a list are named op<index>)
+var nfsProcNames = map[string][]string{
+	"proc2": {
+		"null", "getattr", "setattr", "root", "lookup", "readlink", "read", "wrcache", "write",
+		"create", "remove", "rename", "link", "symlink", "mkdir", "rmdir", "readdir", "fsstat",
+	},
+	"proc3": {
+		"null", "getattr", "setattr", "lookup", "access", "readlink", "read", "write", "create",
+		"mkdir", "symlink", "mknod", "remove", "rmdir", "rename", "link", "readdir", "readdirplus",
+		"fsstat", "fsinfo", "pathconf", "commit",
+	},
+	// client
+	"proc4": {
+		"null", "read", "write", "commit", "open", "open_confirm", "open_noattr", "open_downgrade",
+		"close", "setattr", "fsinfo", "renew", "setclientid", "setclientid_confirm", "lock", "lockt",
+		"locku", "access", "getattr", "lookup", "lookup_root", "remove", "rename", "link", "symlink",
+		"create", "pathconf", "statfs", "readlink", "readdir", "server_caps", "delegreturn", "getacl",
+		"setacl", "fs_locations", "release_lockowner", "secinfo", "fsid_present", "exchange_id",
+		"create_session", "destroy_session", "sequence", "get_lease_time", "reclaim_complete",
+		"layoutget", "getdeviceinfo", "layoutcommit", "layoutreturn", "secinfo_no_name",
+		"test_stateid", "free_stateid", "getdevicelist", "bind_conn_to_session", "destroy_clientid",
+		"seek", "allocate", "deallocate", "layoutstats", "clone",
+	},
+	// server, proc4 is null and compound, the operations are in proc4ops
+	// (indexed by operation number, 0-2 are unused)
+	"proc4ops": {
+		"", "", "", "access", "close", "commit", "create", "delegpurge", "delegreturn", "getattr",
+		"getfh", "link", "lock", "lockt", "locku", "lookup", "lookupp", "nverify", "open", "openattr",
+		"open_confirm", "open_downgrade", "putfh", "putpubfh", "putrootfh", "read", "readdir",
+		"readlink", "remove", "rename", "renew", "restorefh", "savefh", "secinfo", "setattr",
+		"setclientid", "setclientid_confirm", "verify", "write", "release_lockowner",
+		"backchannel_ctl", "bind_conn_to_session", "exchange_id", "create_session",
+		"destroy_session", "free_stateid", "get_dir_delegation", "getdeviceinfo", "getdevicelist",
+		"layoutcommit", "layoutget", "layoutreturn", "secinfo_no_name", "sequence", "set_ssv",
+		"test_stateid", "want_delegation", "destroy_clientid", "reclaim_complete", "allocate",
+		"copy", "copy_notify", "deallocate", "io_advise", "layouterror", "layoutstats",
+		"offload_cancel", "offload_status", "read_plus", "seek", "write_same", "clone",
+	},
+}
+
+// nfsServerProc4Names server proc4 procedure names
+var nfsServerProc4Names = []string{"null", "compound"}
+
+// nfsStatNames names of the fields for the non-procedure lines
+var nfsStatNames = map[string][]string{
+	"net": {"packets", "udp", "tcp", "tcpconn"},
+	"rc":  {"hits", "misses", "nocache"},
+	"io":  {"read_bytes", "write_bytes"},
+}
+
+// nfsRPCNames names of the rpc line fields for client and server
+var nfsRPCNames = map[string][]string{
+	"client": {"calls", "retrans", "authrefrsh"},
+	"server": {"calls", "badcalls", "badfmt", "badauth", "badclnt"},
+}
+
+// nfsVersions metric name used for each procedure line
+var nfsVersions = map[string]string{
+	"proc2":    "v2",
+	"proc3":    "v3",
+	"proc4":    "v4",
+	"proc4ops": "v4ops",
+}
+
+// nfsBytesNames names of the mountstats bytes: fields
+var nfsBytesNames = []string{
+	"read_bytes", "write_bytes", "direct_read_bytes", "direct_write_bytes",
+	"server_read_bytes", "server_write_bytes", "read_pages", "write_pages",
+}
+
+// nfsOpNames names of the mountstats per-op statistics fields
+var nfsOpNames = []string{
+	"ops", "transmissions", "timeouts", "sent_bytes", "received_bytes",
+	"queue_ms", "rtt_ms", "execute_ms", "errors",
+}
+
+// nfsMount statistics for an nfs mount from mountstats
+type nfsMount struct {
+	device     string
+	mountPoint string
+	fsType     string
+	bytes      []uint64
+	ops        map[string][]uint64
+}
+
+// nfsCounters all rpc, procedure and mountstats values
+var nfsCounters = regexp.MustCompile(fmt.Sprintf(regexPat, ".+"))
+
+// NewNFSCollector creates new procfs nfs collector
+func NewNFSCollector(cfgBaseName string) (collector.Collector, error) {
+	procFile := filepath.Join("self", "mountstats")
+
+	c := NFS{}
+	c.id = "nfs"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = nfsCounters
+	c.procFSPath = "/proc"
+	c.file = filepath.Join(c.procFSPath, procFile)
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+
+	c.include = defaultIncludeRegex
+	c.exclude = defaultExcludeRegex
+	c.mountOps = map[string]bool{"READ": true, "WRITE": true}
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts nfsOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.IncludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.IncludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling include regex", c.pkgID)
+		}
+		c.include = rx
+	}
+
+	if opts.ExcludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.ExcludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling exclude regex", c.pkgID)
+		}
+		c.exclude = rx
+	}
+
+	if len(opts.MountOps) > 0 {
+		c.mountOps = map[string]bool{}
+		for _, op := range opts.MountOps {
+			c.mountOps[strings.ToUpper(op)] = true
+		}
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource
+func (c *NFS) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	// the rpc files are only present when the nfs client/server modules are loaded
+	rpcDir := filepath.Join(c.procFSPath, "net", "rpc")
+	if err := c.rpcCollect(&metrics, filepath.Join(rpcDir, "nfs"), "client"); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		c.logger.Warn().Err(err).Msg("nfs client")
+	}
+	if err := c.rpcCollect(&metrics, filepath.Join(rpcDir, "nfsd"), "server"); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		c.logger.Warn().Err(err).Msg("nfs server")
+	}
+
+	if err := c.mountstatsCollect(&metrics); err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// rpcCollect gets metrics from /proc/net/rpc/nfs (client) or /proc/net/rpc/nfsd (server), format:
+//
+//	net 0 0 0 0
+//	rpc 1234 5 0
+//	proc3 22 0 310 12 ...
+//	proc4 59 0 100 ...
+func (c *NFS) rpcCollect(metrics *cgm.Metrics, fn, role string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return errors.Wrap(err, "opening")
+	}
+	defer f.Close()
+
+	pfx := c.id + metricNameSeparator + role
+	metricType := "L" // uint64
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		statType := fields[0]
+		values := fields[1:]
+
+		var names []string
+		switch statType {
+		case "rpc":
+			names = nfsRPCNames[role]
+		case "net", "io", "rc":
+			names = nfsStatNames[statType]
+		case "proc2", "proc3", "proc4", "proc4ops":
+			// first value is the number of procedures
+			if n, err := strconv.Atoi(values[0]); err != nil || n != len(values)-1 {
+				c.logger.Warn().Str("file", fn).Str("type", statType).Msg("invalid number of procedures")
+				continue
+			}
+			values = values[1:]
+			names = nfsProcNames[statType]
+			if role == "server" && statType == "proc4" {
+				names = nfsServerProc4Names
+			}
+			statType = nfsVersions[statType]
+		default:
+			continue // fh, th, ra, etc.
+		}
+
+		for i, val := range values {
+			name := ""
+			if i < len(names) {
+				name = names[i]
+			} else if strings.HasPrefix(statType, "v") {
+				name = "op" + strconv.Itoa(i)
+			}
+			if name == "" {
+				continue
+			}
+			v, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("file", fn).Str("type", statType).Msg("parsing field " + name)
+				continue
+			}
+			c.addMetric(metrics, pfx, statType+metricNameSeparator+name, metricType, v)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "parsing %s", f.Name())
+	}
+
+	return nil
+}
+
+// mountstatsCollect gets per mount metrics for nfs mounts from /proc/self/mountstats
+func (c *NFS) mountstatsCollect(metrics *cgm.Metrics) error {
+	mounts, err := c.parseMountstats()
+	if err != nil {
+		return err
+	}
+
+	pfx := c.id + metricNameSeparator + "mount"
+	metricType := "L" // uint64
+	for _, m := range mounts {
+		if c.exclude.MatchString(m.mountPoint) || !c.include.MatchString(m.mountPoint) {
+			c.logger.Debug().Str("mount", m.mountPoint).Msg("excluded mount point, skipping")
+			continue
+		}
+
+		streamTags, err := tags.PrepStreamTags(nfsMountTags(m))
+		if err != nil {
+			c.logger.Warn().Err(err).Str("mount", m.mountPoint).Msg("prep stream tags")
+			continue
+		}
+
+		for i, v := range m.bytes {
+			if i >= len(nfsBytesNames) {
+				break
+			}
+			c.addTaggedMetric(metrics, pfx, nfsBytesNames[i], streamTags, metricType, v)
+		}
+
+		for op, vals := range m.ops {
+			opName := strings.ToLower(op)
+			for i, v := range vals {
+				if i >= len(nfsOpNames) {
+					break
+				}
+				c.addTaggedMetric(metrics, pfx, opName+metricNameSeparator+nfsOpNames[i], streamTags, metricType, v)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseMountstats parses the nfs mounts in /proc/self/mountstats, format:
+//
+//	device server:/export mounted on /mnt/export with fstype nfs4 statvers=1.1
+//		opts:	rw,vers=4.1,...
+//		bytes:	1048576 0 0 0 1048576 0 256 0
+//		RPC iostats version: 1.0  p/v: 100003/4 (nfs)
+//		per-op statistics
+//		        NULL: 0 0 0 0 0 0 0 0
+//		        READ: 12 12 0 2064 1050112 3 120 125 0
+func (c *NFS) parseMountstats() ([]*nfsMount, error) {
+	f, err := os.Open(c.file)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening")
+	}
+	defer f.Close()
+
+	mounts := []*nfsMount{}
+	var mnt *nfsMount
+	inOps := false
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "device" {
+			mnt = nil
+			inOps = false
+			// device <dev> mounted on <mount point> with fstype <type> [statvers=x]
+			if len(fields) < 8 || fields[2] != "mounted" || fields[5] != "with" {
+				continue
+			}
+			if fields[7] != "nfs" && fields[7] != "nfs4" {
+				continue
+			}
+			mnt = &nfsMount{
+				device:     fields[1],
+				mountPoint: unescapeMountinfo(fields[4]),
+				fsType:     fields[7],
+				ops:        make(map[string][]uint64),
+			}
+			mounts = append(mounts, mnt)
+			continue
+		}
+
+		if mnt == nil {
+			continue
+		}
+
+		switch {
+		case fields[0] == "bytes:":
+			mnt.bytes = parseUints(fields[1:])
+		case fields[0] == "per-op":
+			inOps = true
+		case inOps && strings.HasSuffix(fields[0], ":"):
+			op := strings.TrimSuffix(fields[0], ":")
+			if c.mountOps[op] {
+				mnt.ops[op] = parseUints(fields[1:])
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading")
+	}
+
+	return mounts, nil
+}
+
+// nfsMountTags returns the stream tags for an nfs mount (server, export, mount and fstype)
+func nfsMountTags(m *nfsMount) string {
+	server, export := m.device, ""
+	if strings.HasPrefix(server, "[") {
+		// ipv6 address, [::1]:/export
+		if i := strings.Index(server, "]:"); i > 0 {
+			server, export = server[1:i], server[i+2:]
+		}
+	} else if i := strings.Index(server, ":"); i > 0 {
+		server, export = server[:i], server[i+1:]
+	}
+
+	tagList := []string{
+		"server" + tags.Delimiter + cleanTagValue(server),
+		"mount" + tags.Delimiter + cleanTagValue(m.mountPoint),
+		"fstype" + tags.Delimiter + cleanTagValue(m.fsType),
+	}
+	if export != "" {
+		tagList = append(tagList, "export"+tags.Delimiter+cleanTagValue(export))
+	}
+
+	sort.Strings(tagList)
+	return strings.Join(tagList, tags.Separator)
+}
+
+// parseUints parses a list of unsigned integers, stopping at the first invalid value
+func parseUints(fields []string) []uint64 {
+	vals := make([]uint64, 0, len(fields))
+	for _, field := range fields {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			break
+		}
+		vals = append(vals, v)
+	}
+	return vals
+}
@@ -0,0 +1,203 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewNFSCollector(t *testing.T) {
+	t.Log("Testing NewNFSCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("config (missing)")
+	{
+		_, err := NewNFSCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewNFSCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewNFSCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "self", "mountstats")
+		if c.(*NFS).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*NFS).file)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewNFSCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (include regex)")
+	{
+		c, err := NewNFSCollector(filepath.Join("testdata", "config_include_regex_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := fmt.Sprintf(regexPat, `^foo`)
+		if c.(*NFS).include.String() != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*NFS).include.String())
+		}
+	}
+
+	t.Log("config (include regex invalid)")
+	{
+		_, err := NewNFSCollector(filepath.Join("testdata", "config_include_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (exclude regex invalid)")
+	{
+		_, err := NewNFSCollector(filepath.Join("testdata", "config_exclude_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (mount ops)")
+	{
+		c, err := NewNFSCollector(filepath.Join("testdata", "config_nfs_mount_ops_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(c.(*NFS).mountOps) != 3 || !c.(*NFS).mountOps["OPEN"] {
+			t.Fatalf("expected READ, WRITE, OPEN got (%#v)", c.(*NFS).mountOps)
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewNFSCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*NFS).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestNFSCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewNFSCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*NFS).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good")
+	{
+		c, err := NewNFSCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+
+		builds := "|ST[export:/export/builds,fstype:nfs4,mount:/mnt/builds,server:nfs1.example.com]"
+		scratch := "|ST[export:/scratch,fstype:nfs,mount:/mnt/scratch,server:fd00__2]"
+
+		tests := []struct {
+			name string
+			val  uint64
+		}{
+			{"nfs`client`rpc`calls", 13218},
+			{"nfs`client`rpc`retrans", 3},
+			{"nfs`client`v3`getattr", 1054},
+			{"nfs`client`v3`commit", 190},
+			{"nfs`client`v4`read", 812},
+			{"nfs`client`v4`clone", 0},
+			{"nfs`server`rpc`badcalls", 1},
+			{"nfs`server`io`read_bytes", 2097152},
+			{"nfs`server`rc`nocache", 4070},
+			{"nfs`server`net`tcpconn", 6},
+			{"nfs`server`v3`read", 512},
+			{"nfs`server`v4`compound", 1000},
+			{"nfs`server`v4ops`putfh", 990},
+			{"nfs`server`v4ops`sequence", 850},
+			{"nfs`mount`read_bytes" + builds, 10485760},
+			{"nfs`mount`server_write_bytes" + builds, 2097152},
+			{"nfs`mount`read`ops" + builds, 10},
+			{"nfs`mount`read`rtt_ms" + builds, 250},
+			{"nfs`mount`read`execute_ms" + builds, 260},
+			{"nfs`mount`write`received_bytes" + builds, 272},
+			{"nfs`mount`write`execute_ms" + scratch, 5},
+		}
+		for _, test := range tests {
+			m, ok := metrics[test.name]
+			if !ok {
+				t.Fatalf("expected metric %s", test.name)
+			}
+			if v := m.Value.(uint64); v != test.val {
+				t.Fatalf("%s expected %d, got %d", test.name, test.val, v)
+			}
+		}
+
+		for name := range metrics {
+			if ok, _ := regexp.MatchString("`op[0-9]+", name); ok {
+				t.Fatalf("unexpected unnamed procedure metric %s", name)
+			}
+			if strings.Contains(name, "mount`open`") || strings.Contains(name, "mount`null`") {
+				t.Fatalf("unexpected op metric %s", name)
+			}
+		}
+
+		// nfsv3 mounts do not have the errors field
+		if _, ok := metrics["nfs`mount`read`errors"+scratch]; ok {
+			t.Fatal("expected no errors metric for nfsv3 mount")
+		}
+	}
+}
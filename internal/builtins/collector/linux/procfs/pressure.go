@@ -0,0 +1,252 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Pressure stall information (PSI) metrics from the Linux ProcFS
+type Pressure struct {
+	pfscommon
+	resources []string
+}
+
+// pressureOptions defines what elements can be overriden in a config file
+type pressureOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+}
+
+// pressureCounters the stall totals, the averages are gauges
+var pressureCounters = regexp.MustCompile(fmt.Sprintf(regexPat, ".+`total"))
+
+// NewPressureCollector creates new procfs pressure collector
+func NewPressureCollector(cfgBaseName string) (collector.Collector, error) {
+	procFile := "pressure"
+
+	c := Pressure{}
+	c.id = "pressure"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = pressureCounters
+	c.procFSPath = "/proc"
+	c.file = filepath.Join(c.procFSPath, procFile)
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+	c.resources = []string{"cpu", "io", "memory"}
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts pressureOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource
+func (c *Pressure) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	numRead := 0
+	pfx := c.id + metricNameSeparator
+	for _, resource := range c.resources {
+		fn := filepath.Join(c.file, resource)
+		stats, err := c.parse(fn)
+		if err != nil {
+			if !os.IsNotExist(errors.Cause(err)) {
+				c.logger.Warn().Err(err).Str("file", fn).Msg("parsing, ignoring")
+			}
+			continue
+		}
+		numRead++
+
+		for stallType, st := range stats {
+			mpfx := pfx + resource + metricNameSeparator + stallType
+
+			c.addMetric(&metrics, mpfx, "avg10", "n", st.avg10)
+			c.addMetric(&metrics, mpfx, "avg60", "n", st.avg60)
+			c.addMetric(&metrics, mpfx, "avg300", "n", st.avg300)
+			c.addMetric(&metrics, mpfx, "total", "L", st.total)
+		}
+	}
+
+	if numRead == 0 {
+		err := errors.Errorf("no pressure information found in %s", c.file)
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// pressureStat some or full stall information for a resource
+type pressureStat struct {
+	avg10  float64
+	avg60  float64
+	avg300 float64
+	total  uint64
+}
+
+// parse a pressure file, format:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func (c *Pressure) parse(fn string) (map[string]pressureStat, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening")
+	}
+	defer f.Close()
+
+	stats := make(map[string]pressureStat)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 5 {
+			continue
+		}
+		stallType := fields[0]
+		if stallType != "some" && stallType != "full" {
+			continue
+		}
+
+		st := pressureStat{}
+		valid := true
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				valid = false
+				break
+			}
+			var perr error
+			switch kv[0] {
+			case "avg10":
+				st.avg10, perr = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				st.avg60, perr = strconv.ParseFloat(kv[1], 64)
+			case "avg300":
+				st.avg300, perr = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				st.total, perr = strconv.ParseUint(kv[1], 10, 64)
+			}
+			if perr != nil {
+				c.logger.Warn().Err(perr).Str("file", fn).Str("field", field).Msg("parsing field")
+				valid = false
+				break
+			}
+		}
+		if valid {
+			stats[stallType] = st
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading")
+	}
+
+	return stats, nil
+}
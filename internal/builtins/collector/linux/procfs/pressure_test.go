@@ -0,0 +1,156 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/rs/zerolog"
+)
+
+func TestNewPressureCollector(t *testing.T) {
+	t.Log("Testing NewPressureCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("config (missing)")
+	{
+		_, err := NewPressureCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewPressureCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewPressureCollector(filepath.Join("testdata", "config_id_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Pressure).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewPressureCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "pressure")
+		if c.(*Pressure).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*Pressure).file)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewPressureCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewPressureCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Pressure).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestPressureCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewPressureCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Pressure).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good")
+	{
+		c, err := NewPressureCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		// 5 resource`type combinations, 4 metrics each, no rates on first collection
+		metrics := c.Flush()
+		if len(metrics) != 5*4 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 5*4, len(metrics), metrics)
+		}
+		if v := metrics["pressure`cpu`some`avg10"].Value.(float64); v != 1.5 {
+			t.Fatalf("expected 1.5, got %f", v)
+		}
+		if v := metrics["pressure`io`full`total"].Value.(uint64); v != 250000 {
+			t.Fatalf("expected 250000, got %d", v)
+		}
+
+		// stall totals are counters, rates are computed by applyRates
+		// simulate a previous collection 10s ago
+		c.(*Pressure).rateMode = rateModeAlso
+		c.(*Pressure).rateLast = cgm.Metrics{}
+		for name, m := range metrics {
+			c.(*Pressure).rateLast[name] = m
+		}
+		c.(*Pressure).rateLast["pressure`cpu`some`total"] = cgm.Metric{Type: "L", Value: uint64(0)}
+		c.(*Pressure).rateLastTime = time.Now().Add(-10 * time.Second)
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics = c.Flush()
+		if len(metrics) != 5*4+5 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 5*4+5, len(metrics), metrics)
+		}
+		v := metrics["pressure`cpu`some`total_per_sec"].Value.(float64)
+		if v < 99000 || v > 100000 {
+			t.Fatalf("expected ~100000 stall us/sec, got %f", v)
+		}
+		if v := metrics["pressure`io`full`total_per_sec"].Value.(float64); v != 0 {
+			t.Fatalf("expected 0 stall us/sec, got %f", v)
+		}
+	}
+}
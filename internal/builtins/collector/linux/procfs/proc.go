@@ -0,0 +1,489 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Proc process group metrics from the Linux ProcFS
+type Proc struct {
+	pfscommon
+	clockHZ  float64
+	pageSize uint64
+	groups   []procGroup
+}
+
+// procOptions defines what elements can be overriden in a config file
+type procOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+
+	// collector specific
+	ClockHZ string             `json:"clock_hz" toml:"clock_hz" yaml:"clock_hz"`
+	Groups  []procGroupOptions `json:"groups" toml:"groups" yaml:"groups"`
+}
+
+// procGroupOptions defines a process group, a process is a member of the
+// group if it matches all of the criteria set for the group
+type procGroupOptions struct {
+	Name         string `json:"name" toml:"name" yaml:"name"`
+	CommRegex    string `json:"comm_regex" toml:"comm_regex" yaml:"comm_regex"`
+	CmdlineRegex string `json:"cmdline_regex" toml:"cmdline_regex" yaml:"cmdline_regex"`
+	User         string `json:"user" toml:"user" yaml:"user"`
+	PIDFile      string `json:"pidfile" toml:"pidfile" yaml:"pidfile"`
+}
+
+type procGroup struct {
+	name      string
+	comm      *regexp.Regexp
+	cmdline   *regexp.Regexp
+	uid       string
+	pidFile   string
+	filePID   string // pid read from pidFile, for the current collection
+	hasFilter bool
+}
+
+// pstats process (or aggregated process group) stats
+type pstats struct {
+	procs      uint64
+	threads    uint64
+	utime      uint64 // clock ticks
+	stime      uint64 // clock ticks
+	rssBytes   uint64
+	openFDs    uint64
+	readBytes  uint64
+	writeBytes uint64
+}
+
+// pinfo identifying details of a process used to match groups
+type pinfo struct {
+	pid     string
+	comm    string
+	cmdline string
+	uid     string
+}
+
+// procCounters read and write bytes of each process group
+var procCounters = regexp.MustCompile(fmt.Sprintf(regexPat, "[^`]+`(read|write)_bytes"))
+
+// NewProcCollector creates new procfs proc collector
+func NewProcCollector(cfgBaseName string) (collector.Collector, error) {
+	c := Proc{}
+	c.id = "proc"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = procCounters
+	c.procFSPath = "/proc"
+	c.file = c.procFSPath
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+	c.clockHZ = 100
+	c.pageSize = uint64(os.Getpagesize())
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts procOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.ClockHZ != "" {
+		v, err := strconv.ParseFloat(opts.ClockHZ, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing clock_hz", c.pkgID)
+		}
+		if v <= 0 {
+			return nil, errors.Errorf("%s invalid clock_hz (%s)", c.pkgID, opts.ClockHZ)
+		}
+		c.clockHZ = v
+	}
+
+	for _, gopts := range opts.Groups {
+		g, err := newProcGroup(gopts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s group", c.pkgID)
+		}
+		c.groups = append(c.groups, g)
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = c.procFSPath
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// newProcGroup validates a process group definition
+func newProcGroup(opts procGroupOptions) (procGroup, error) {
+	g := procGroup{name: opts.Name}
+
+	if g.name == "" {
+		return g, errors.New("invalid group, no name")
+	}
+	if strings.Contains(g.name, metricNameSeparator) {
+		return g, errors.Errorf("invalid group name (%s)", g.name)
+	}
+
+	if opts.CommRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.CommRegex))
+		if err != nil {
+			return g, errors.Wrapf(err, "%s compiling comm regex", g.name)
+		}
+		g.comm = rx
+		g.hasFilter = true
+	}
+
+	if opts.CmdlineRegex != "" {
+		// cmdline is matched anywhere in the command line, not anchored
+		rx, err := regexp.Compile(opts.CmdlineRegex)
+		if err != nil {
+			return g, errors.Wrapf(err, "%s compiling cmdline regex", g.name)
+		}
+		g.cmdline = rx
+		g.hasFilter = true
+	}
+
+	if opts.User != "" {
+		if _, err := strconv.ParseUint(opts.User, 10, 32); err == nil {
+			g.uid = opts.User
+		} else {
+			u, err := user.Lookup(opts.User)
+			if err != nil {
+				return g, errors.Wrapf(err, "%s user", g.name)
+			}
+			g.uid = u.Uid
+		}
+		g.hasFilter = true
+	}
+
+	if opts.PIDFile != "" {
+		g.pidFile = opts.PIDFile
+		g.hasFilter = true
+	}
+
+	if !g.hasFilter {
+		return g, errors.Errorf("%s no criteria (comm_regex, cmdline_regex, user, pidfile)", g.name)
+	}
+
+	return g, nil
+}
+
+// matches determines if a process is a member of the group
+func (g *procGroup) matches(pi *pinfo) bool {
+	if g.pidFile != "" && pi.pid != g.filePID {
+		return false
+	}
+	if g.comm != nil && !g.comm.MatchString(pi.comm) {
+		return false
+	}
+	if g.cmdline != nil && !g.cmdline.MatchString(pi.cmdline) {
+		return false
+	}
+	if g.uid != "" && pi.uid != g.uid {
+		return false
+	}
+	return true
+}
+
+// Collect metrics from the procfs resource
+func (c *Proc) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	// nothing to report without groups
+	if len(c.groups) == 0 {
+		c.setStatus(metrics, nil)
+		return nil
+	}
+
+	for i := range c.groups {
+		g := &c.groups[i]
+		if g.pidFile == "" {
+			continue
+		}
+		g.filePID = ""
+		data, err := ioutil.ReadFile(g.pidFile)
+		if err != nil {
+			c.logger.Debug().Err(err).Str("group", g.name).Msg("reading pidfile")
+			continue
+		}
+		g.filePID = strings.TrimSpace(string(data))
+	}
+
+	entries, err := ioutil.ReadDir(c.procFSPath)
+	if err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	groupStats := make([]pstats, len(c.groups))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pid := entry.Name()
+		if _, err := strconv.ParseUint(pid, 10, 64); err != nil {
+			continue // not a process
+		}
+
+		pi, err := c.readInfo(pid)
+		if err != nil {
+			// process exited while walking, or permission denied
+			c.logger.Debug().Err(err).Str("pid", pid).Msg("reading process info, ignoring")
+			continue
+		}
+
+		var ps *pstats
+		for i := range c.groups {
+			if !c.groups[i].matches(pi) {
+				continue
+			}
+			if ps == nil {
+				ps, err = c.readStats(pid)
+				if err != nil {
+					c.logger.Debug().Err(err).Str("pid", pid).Msg("reading process stats, ignoring")
+					break
+				}
+			}
+			gs := &groupStats[i]
+			gs.procs++
+			gs.threads += ps.threads
+			gs.utime += ps.utime
+			gs.stime += ps.stime
+			gs.rssBytes += ps.rssBytes
+			gs.openFDs += ps.openFDs
+			gs.readBytes += ps.readBytes
+			gs.writeBytes += ps.writeBytes
+		}
+	}
+
+	pfx := c.id + metricNameSeparator
+	for i, g := range c.groups {
+		gs := groupStats[i]
+		gpfx := pfx + g.name
+		c.addMetric(&metrics, gpfx, "procs", "L", gs.procs)
+		c.addMetric(&metrics, gpfx, "threads", "L", gs.threads)
+		c.addMetric(&metrics, gpfx, "cpu_user_seconds", "n", float64(gs.utime)/c.clockHZ)
+		c.addMetric(&metrics, gpfx, "cpu_system_seconds", "n", float64(gs.stime)/c.clockHZ)
+		c.addMetric(&metrics, gpfx, "rss_bytes", "L", gs.rssBytes)
+		c.addMetric(&metrics, gpfx, "open_fds", "L", gs.openFDs)
+		c.addMetric(&metrics, gpfx, "read_bytes", "L", gs.readBytes)
+		c.addMetric(&metrics, gpfx, "write_bytes", "L", gs.writeBytes)
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// readInfo reads the details of a process used to match it to groups
+func (c *Proc) readInfo(pid string) (*pinfo, error) {
+	pi := pinfo{pid: pid}
+
+	comm, err := ioutil.ReadFile(filepath.Join(c.procFSPath, pid, "comm"))
+	if err != nil {
+		return nil, err
+	}
+	pi.comm = strings.TrimSpace(string(comm))
+
+	cmdline, err := ioutil.ReadFile(filepath.Join(c.procFSPath, pid, "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	pi.cmdline = strings.TrimSpace(string(bytes.Replace(cmdline, []byte{0}, []byte{' '}, -1)))
+
+	f, err := os.Open(filepath.Join(c.procFSPath, pid, "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Uid: real effective saved filesystem
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == "Uid:" {
+			pi.uid = fields[1]
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &pi, nil
+}
+
+// readStats reads the resource usage of a process
+func (c *Proc) readStats(pid string) (*pstats, error) {
+	ps := pstats{}
+
+	data, err := ioutil.ReadFile(filepath.Join(c.procFSPath, pid, "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	// comm (field 2) is in parens and may contain spaces, parse
+	// the fields after the closing paren (starting with field 3 state)
+	//
+	// 14 utime       clock ticks in user mode
+	// 15 stime       clock ticks in kernel mode
+	// 20 num_threads
+	// 24 rss         pages
+	stat := string(data)
+	idx := strings.LastIndex(stat, ")")
+	if idx == -1 {
+		return nil, errors.New("invalid stat format")
+	}
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 22 {
+		return nil, errors.Errorf("invalid stat format (%d fields)", len(fields))
+	}
+	field := func(n int) (uint64, error) {
+		return strconv.ParseUint(fields[n-3], 10, 64)
+	}
+
+	if ps.utime, err = field(14); err != nil {
+		return nil, errors.Wrap(err, "parsing utime")
+	}
+	if ps.stime, err = field(15); err != nil {
+		return nil, errors.Wrap(err, "parsing stime")
+	}
+	if ps.threads, err = field(20); err != nil {
+		return nil, errors.Wrap(err, "parsing num_threads")
+	}
+	rss, err := strconv.ParseInt(fields[24-3], 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing rss")
+	}
+	if rss > 0 {
+		ps.rssBytes = uint64(rss) * c.pageSize
+	}
+
+	// open fds and io require privileges for processes
+	// owned by other users, they are optional
+	// only the entries are counted, names avoid an lstat per fd
+	if f, err := os.Open(filepath.Join(c.procFSPath, pid, "fd")); err == nil {
+		if fds, err := f.Readdirnames(-1); err == nil {
+			ps.openFDs = uint64(len(fds))
+		}
+		f.Close()
+	}
+
+	if f, err := os.Open(filepath.Join(c.procFSPath, pid, "io")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 2 {
+				continue
+			}
+			switch fields[0] {
+			case "read_bytes:":
+				ps.readBytes, _ = strconv.ParseUint(fields[1], 10, 64)
+			case "write_bytes:":
+				ps.writeBytes, _ = strconv.ParseUint(fields[1], 10, 64)
+			}
+		}
+		f.Close()
+	}
+
+	return &ps, nil
+}
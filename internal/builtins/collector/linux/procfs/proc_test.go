@@ -0,0 +1,195 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewProcCollector(t *testing.T) {
+	t.Log("Testing NewProcCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("no config")
+	{
+		_, err := NewProcCollector("")
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (missing)")
+	{
+		_, err := NewProcCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewProcCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewProcCollector(filepath.Join("testdata", "config_id_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Proc).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewProcCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (clock hz)")
+	{
+		c, err := NewProcCollector(filepath.Join("testdata", "config_clock_hz_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Proc).clockHZ != 300 {
+			t.Fatalf("expected 300, got %f", c.(*Proc).clockHZ)
+		}
+	}
+
+	t.Log("config (clock hz invalid)")
+	{
+		_, err := NewProcCollector(filepath.Join("testdata", "config_clock_hz_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (groups)")
+	{
+		c, err := NewProcCollector(filepath.Join("testdata", "config_proc_groups_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(c.(*Proc).groups) != 4 {
+			t.Fatalf("expected 4 groups, got %d", len(c.(*Proc).groups))
+		}
+	}
+
+	t.Log("config (groups invalid regex)")
+	{
+		_, err := NewProcCollector(filepath.Join("testdata", "config_proc_groups_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (groups no criteria)")
+	{
+		_, err := NewProcCollector(filepath.Join("testdata", "config_proc_groups_no_criteria_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewProcCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Proc).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestProcCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewProcCollector(filepath.Join("testdata", "config_proc_groups_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Proc).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good")
+	{
+		c, err := NewProcCollector(filepath.Join("testdata", "config_proc_groups_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 4*8 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 4*8, len(metrics), metrics)
+		}
+
+		pageSize := uint64(os.Getpagesize())
+		tests := []struct {
+			name     string
+			expected interface{}
+		}{
+			{"proc`nginx`procs", uint64(2)},
+			{"proc`nginx`threads", uint64(2)},
+			{"proc`nginx`cpu_user_seconds", float64(3)},
+			{"proc`nginx`cpu_system_seconds", float64(1.5)},
+			{"proc`nginx`rss_bytes", 3000 * pageSize},
+			{"proc`nginx`open_fds", uint64(8)},
+			{"proc`nginx`read_bytes", uint64(4096)},
+			{"proc`nginx`write_bytes", uint64(9216)},
+			{"proc`nginx_master`procs", uint64(1)},
+			{"proc`nginx_master`open_fds", uint64(3)},
+			{"proc`postgres`procs", uint64(1)},
+			{"proc`postgres`threads", uint64(4)},
+			{"proc`www`procs", uint64(1)},
+			{"proc`www`rss_bytes", 2000 * pageSize},
+		}
+		for _, test := range tests {
+			m, ok := metrics[test.name]
+			if !ok {
+				t.Fatalf("expected %s, got %#v", test.name, metrics)
+			}
+			if m.Value != test.expected {
+				t.Fatalf("%s expected %v, got %v", test.name, test.expected, m.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Schedstat scheduler (run queue) metrics from the Linux ProcFS
+type Schedstat struct {
+	pfscommon
+	reportAllCPUs bool // OPT report all cpus (vs just total) may be overriden in config file
+}
+
+// schedstatOptions defines what elements can be overriden in a config file
+type schedstatOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+
+	// collector specific
+	AllCPU string `json:"report_all_cpus" toml:"report_all_cpus" yaml:"report_all_cpus"`
+}
+
+// schedstatCounters all schedstat values
+var schedstatCounters = regexp.MustCompile(fmt.Sprintf(regexPat, ".+"))
+
+// NewSchedstatCollector creates new procfs schedstat collector
+func NewSchedstatCollector(cfgBaseName string) (collector.Collector, error) {
+	procFile := "schedstat"
+
+	c := Schedstat{}
+	c.id = "schedstat"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = schedstatCounters
+	c.procFSPath = "/proc"
+	c.file = filepath.Join(c.procFSPath, procFile)
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+	c.reportAllCPUs = false
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts schedstatOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.AllCPU != "" {
+		rpt, err := strconv.ParseBool(opts.AllCPU)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing report_all_cpus", c.pkgID)
+		}
+		c.reportAllCPUs = rpt
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource
+func (c *Schedstat) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	f, err := os.Open(c.file)
+	if err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+	defer f.Close()
+
+	// cpu<N> fields (version 15+):
+	//  1 sched_yield() calls
+	//  2 unused (legacy array expiration count)
+	//  3 schedule() calls
+	//  4 schedule() calls which left the cpu idle
+	//  5 try_to_wake_up() calls
+	//  6 try_to_wake_up() calls which woke a task on the local cpu
+	//  7 time spent running tasks on the cpu (ns)
+	//  8 time spent waiting to run on the cpu (ns)
+	//  9 timeslices run on the cpu
+	stats := []struct {
+		idx  int
+		name string
+	}{
+		{idx: 7, name: "run_time_ns"},
+		{idx: 8, name: "run_delay_ns"},
+		{idx: 9, name: "timeslices"},
+	}
+
+	totals := make([]uint64, len(stats))
+	numCPU := 0
+	metricType := "L" // uint64
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "version" && len(fields) == 2 {
+			if v, err := strconv.Atoi(fields[1]); err == nil && v < 15 {
+				err := errors.Errorf("unsupported schedstat version (%d)", v)
+				c.setStatus(metrics, err)
+				return errors.Wrap(err, c.pkgID)
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(fields[0], "cpu") {
+			continue // timestamp, domain<N>
+		}
+
+		if len(fields) < 10 {
+			c.logger.Warn().Str("cpu", fields[0]).Int("expected", 10).Int("found", len(fields)).Msg("invalid number of fields")
+			continue
+		}
+
+		numCPU++
+		for i, s := range stats {
+			v, err := strconv.ParseUint(fields[s.idx], 10, 64)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("cpu", fields[0]).Msg("parsing field " + s.name)
+				continue
+			}
+			totals[i] += v
+			if c.reportAllCPUs {
+				c.addMetric(&metrics, c.id, fields[0]+metricNameSeparator+s.name, metricType, v)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrapf(err, "%s parsing %s", c.pkgID, f.Name())
+	}
+
+	if numCPU == 0 {
+		err := errors.Errorf("no cpus found in %s", c.file)
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	for i, s := range stats {
+		c.addMetric(&metrics, c.id, s.name, metricType, totals[i])
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
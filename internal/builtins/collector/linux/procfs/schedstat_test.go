@@ -0,0 +1,190 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewSchedstatCollector(t *testing.T) {
+	t.Log("Testing NewSchedstatCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("config (missing)")
+	{
+		_, err := NewSchedstatCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewSchedstatCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewSchedstatCollector(filepath.Join("testdata", "config_id_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Schedstat).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewSchedstatCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "schedstat")
+		if c.(*Schedstat).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*Schedstat).file)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewSchedstatCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (report all cpus setting true)")
+	{
+		c, err := NewSchedstatCollector(filepath.Join("testdata", "config_report_all_cpus_true_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !c.(*Schedstat).reportAllCPUs {
+			t.Fatal("expected true")
+		}
+	}
+
+	t.Log("config (report all cpus setting invalid)")
+	{
+		_, err := NewSchedstatCollector(filepath.Join("testdata", "config_report_all_cpus_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewSchedstatCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Schedstat).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestSchedstatCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewSchedstatCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Schedstat).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good (totals)")
+	{
+		c, err := NewSchedstatCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 3 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 3, len(metrics), metrics)
+		}
+
+		expect := map[string]uint64{
+			"schedstat`run_delay_ns": 400000000,
+			"schedstat`run_time_ns":  5135811716,
+			"schedstat`timeslices":   1228881,
+		}
+		for name, val := range expect {
+			m, ok := metrics[name]
+			if !ok {
+				t.Fatalf("expected metric %s", name)
+			}
+			if v := m.Value.(uint64); v != val {
+				t.Fatalf("%s expected %d, got %d", name, val, v)
+			}
+		}
+	}
+
+	t.Log("good (all cpus)")
+	{
+		c, err := NewSchedstatCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Schedstat).reportAllCPUs = true
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 3*3 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 3*3, len(metrics), metrics)
+		}
+
+		expect := map[string]uint64{
+			"schedstat`cpu0`run_delay_ns": 251226208,
+			"schedstat`cpu1`timeslices":   608740,
+			"schedstat`run_delay_ns":      400000000,
+		}
+		for name, val := range expect {
+			m, ok := metrics[name]
+			if !ok {
+				t.Fatalf("expected metric %s", name)
+			}
+			if v := m.Value.(uint64); v != val {
+				t.Fatalf("%s expected %d, got %d", name, val, v)
+			}
+		}
+	}
+}
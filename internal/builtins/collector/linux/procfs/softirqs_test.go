@@ -0,0 +1,190 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewSoftirqsCollector(t *testing.T) {
+	t.Log("Testing NewSoftirqsCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("config (missing)")
+	{
+		_, err := NewSoftirqsCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewSoftirqsCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewSoftirqsCollector(filepath.Join("testdata", "config_id_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Softirqs).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewSoftirqsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "softirqs")
+		if c.(*Softirqs).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*Softirqs).file)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewSoftirqsCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (report all cpus setting true)")
+	{
+		c, err := NewSoftirqsCollector(filepath.Join("testdata", "config_report_all_cpus_true_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !c.(*Softirqs).reportAllCPUs {
+			t.Fatal("expected true")
+		}
+	}
+
+	t.Log("config (report all cpus setting invalid)")
+	{
+		_, err := NewSoftirqsCollector(filepath.Join("testdata", "config_report_all_cpus_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewSoftirqsCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*Softirqs).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestSoftirqsCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewSoftirqsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Softirqs).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good (totals)")
+	{
+		c, err := NewSoftirqsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 10 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 10, len(metrics), metrics)
+		}
+
+		expect := map[string]uint64{
+			"softirqs`net_rx": 3000,
+			"softirqs`timer":  246456,
+			"softirqs`hi":     1,
+		}
+		for name, val := range expect {
+			m, ok := metrics[name]
+			if !ok {
+				t.Fatalf("expected metric %s", name)
+			}
+			if v := m.Value.(uint64); v != val {
+				t.Fatalf("%s expected %d, got %d", name, val, v)
+			}
+		}
+	}
+
+	t.Log("good (all cpus)")
+	{
+		c, err := NewSoftirqsCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*Softirqs).reportAllCPUs = true
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != 10*3 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", 10*3, len(metrics), metrics)
+		}
+
+		expect := map[string]uint64{
+			"softirqs`net_rx`cpu0": 1000,
+			"softirqs`net_rx`cpu1": 2000,
+			"softirqs`sched":       186419,
+		}
+		for name, val := range expect {
+			m, ok := metrics[name]
+			if !ok {
+				t.Fatalf("expected metric %s", name)
+			}
+			if v := m.Value.(uint64); v != val {
+				t.Fatalf("%s expected %d, got %d", name, val, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// TCP connection state metrics from the Linux ProcFS
+type TCP struct {
+	pfscommon
+	reportPorts bool            // OPT report connections for local listening ports
+	ports       map[uint64]bool // OPT listening ports to report (empty, all listening ports)
+}
+
+// tcpOptions defines what elements can be overriden in a config file
+type tcpOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+
+	// collector specific
+	ReportPorts string   `json:"report_ports" toml:"report_ports" yaml:"report_ports"`
+	Ports       []string `json:"ports" toml:"ports" yaml:"ports"`
+}
+
+// tcpStates connection states, indexed by the state code used in /proc/net/tcp
+// (include/net/tcp_states.h)
+var tcpStates = []string{
+	"",
+	"established",  // 01
+	"syn_sent",     // 02
+	"syn_recv",     // 03
+	"fin_wait1",    // 04
+	"fin_wait2",    // 05
+	"time_wait",    // 06
+	"close",        // 07
+	"close_wait",   // 08
+	"last_ack",     // 09
+	"listen",       // 0A
+	"closing",      // 0B
+	"new_syn_recv", // 0C
+}
+
+const tcpStateListen = 0x0A
+
+// tcpSocket the elements of a /proc/net/tcp entry used for metrics
+type tcpSocket struct {
+	localPort uint64
+	state     uint64
+	rxQueue   uint64
+}
+
+// tcpPortStats connection states and accept queue for a listening port
+type tcpPortStats struct {
+	states      []uint64
+	acceptQueue uint64
+}
+
+// NewTCPCollector creates new procfs tcp collector
+func NewTCPCollector(cfgBaseName string) (collector.Collector, error) {
+	procFile := filepath.Join("net", "tcp")
+
+	c := TCP{}
+	c.id = "tcp"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.procFSPath = "/proc"
+	c.file = filepath.Join(c.procFSPath, procFile)
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+	c.ports = map[uint64]bool{}
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts tcpOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.ReportPorts != "" {
+		rpt, err := strconv.ParseBool(opts.ReportPorts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing report_ports", c.pkgID)
+		}
+		c.reportPorts = rpt
+	}
+
+	for _, p := range opts.Ports {
+		port, err := strconv.ParseUint(strings.TrimSpace(p), 10, 16)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing ports", c.pkgID)
+		}
+		c.ports[port] = true
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource
+func (c *TCP) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	sockets, err := c.parse(c.file)
+	if err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	// tcp6 is absent when ipv6 is disabled
+	sockets6, err := c.parse(c.file + "6")
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		c.logger.Warn().Err(err).Msg("tcp6")
+	}
+	sockets = append(sockets, sockets6...)
+
+	states := make([]uint64, len(tcpStates))
+	ports := make(map[uint64]*tcpPortStats)
+
+	for _, s := range sockets {
+		states[s.state]++
+		if c.reportPorts && s.state == tcpStateListen && c.portActive(s.localPort) {
+			ps, ok := ports[s.localPort]
+			if !ok {
+				ps = &tcpPortStats{states: make([]uint64, len(tcpStates))}
+				ports[s.localPort] = ps
+			}
+			// for listening sockets rx_queue is the current accept queue
+			// length (the listen backlog is not in /proc/net/tcp)
+			ps.acceptQueue += s.rxQueue
+		}
+	}
+
+	if c.reportPorts {
+		for _, s := range sockets {
+			if s.state == tcpStateListen {
+				continue
+			}
+			if ps, ok := ports[s.localPort]; ok {
+				ps.states[s.state]++
+			}
+		}
+	}
+
+	pfx := c.id
+	metricType := "L" // uint64
+	for state, name := range tcpStates {
+		if name == "" {
+			continue
+		}
+		c.addMetric(&metrics, pfx, name, metricType, states[state])
+	}
+
+	for port, ps := range ports {
+		ppfx := pfx + metricNameSeparator + "port" + metricNameSeparator + strconv.FormatUint(port, 10)
+		for state, name := range tcpStates {
+			if name == "" || state == tcpStateListen {
+				continue
+			}
+			c.addMetric(&metrics, ppfx, name, metricType, ps.states[state])
+		}
+		c.addMetric(&metrics, ppfx, "accept_queue", metricType, ps.acceptQueue)
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// portActive returns true if metrics should be reported for the port
+func (c *TCP) portActive(port uint64) bool {
+	if len(c.ports) == 0 {
+		return true
+	}
+	return c.ports[port]
+}
+
+// parse a /proc/net/tcp or /proc/net/tcp6 file, format:
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	 0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 12345 1 ...
+func (c *TCP) parse(fn string) ([]tcpSocket, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening")
+	}
+	defer f.Close()
+
+	sockets := []tcpSocket{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] == "sl" {
+			continue // skip header and short lines
+		}
+
+		s := tcpSocket{}
+
+		local := strings.Split(fields[1], ":")
+		if len(local) != 2 {
+			c.logger.Warn().Str("file", fn).Str("local_address", fields[1]).Msg("invalid local address")
+			continue
+		}
+		if s.localPort, err = strconv.ParseUint(local[1], 16, 16); err != nil {
+			c.logger.Warn().Err(err).Str("file", fn).Str("local_address", fields[1]).Msg("parsing local port")
+			continue
+		}
+
+		if s.state, err = strconv.ParseUint(fields[3], 16, 8); err != nil || s.state == 0 || s.state >= uint64(len(tcpStates)) {
+			c.logger.Warn().Err(err).Str("file", fn).Str("state", fields[3]).Msg("invalid state")
+			continue
+		}
+
+		queues := strings.Split(fields[4], ":")
+		if len(queues) != 2 {
+			c.logger.Warn().Str("file", fn).Str("queues", fields[4]).Msg("invalid tx/rx queues")
+			continue
+		}
+		if s.rxQueue, err = strconv.ParseUint(queues[1], 16, 64); err != nil {
+			c.logger.Warn().Err(err).Str("file", fn).Str("queues", fields[4]).Msg("parsing rx_queue")
+			continue
+		}
+
+		sockets = append(sockets, s)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading")
+	}
+
+	return sockets, nil
+}
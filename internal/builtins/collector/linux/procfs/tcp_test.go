@@ -0,0 +1,229 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewTCPCollector(t *testing.T) {
+	t.Log("Testing NewTCPCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("config (missing)")
+	{
+		_, err := NewTCPCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewTCPCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (id setting)")
+	{
+		c, err := NewTCPCollector(filepath.Join("testdata", "config_id_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*TCP).id != "foo" {
+			t.Fatalf("expected foo, got (%s)", c.ID())
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewTCPCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "net", "tcp")
+		if c.(*TCP).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*TCP).file)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewTCPCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (report ports setting)")
+	{
+		c, err := NewTCPCollector(filepath.Join("testdata", "config_tcp_ports_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !c.(*TCP).reportPorts {
+			t.Fatal("expected report ports true")
+		}
+		if !c.(*TCP).ports[8080] || len(c.(*TCP).ports) != 1 {
+			t.Fatalf("expected port 8080, got (%#v)", c.(*TCP).ports)
+		}
+	}
+
+	t.Log("config (report ports setting invalid)")
+	{
+		_, err := NewTCPCollector(filepath.Join("testdata", "config_tcp_report_ports_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (ports setting invalid)")
+	{
+		_, err := NewTCPCollector(filepath.Join("testdata", "config_tcp_ports_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewTCPCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*TCP).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestTCPCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewTCPCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*TCP).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good (states only)")
+	{
+		c, err := NewTCPCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if len(metrics) != len(tcpStates)-1 {
+			t.Fatalf("expected %d metrics, got %d (%#v)", len(tcpStates)-1, len(metrics), metrics)
+		}
+
+		expect := map[string]uint64{
+			"tcp`established": 4,
+			"tcp`listen":      3,
+			"tcp`time_wait":   1,
+			"tcp`close_wait":  1,
+			"tcp`syn_recv":    0,
+		}
+		for name, val := range expect {
+			if v := metrics[name].Value.(uint64); v != val {
+				t.Fatalf("%s expected %d, got %d", name, val, v)
+			}
+		}
+	}
+
+	t.Log("good (all listening ports)")
+	{
+		c, err := NewTCPCollector(filepath.Join("testdata", "config_tcp_report_ports_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+
+		// states, plus 3 listening ports with each state (less listen) and the accept queue
+		expectCount := (len(tcpStates) - 1) + 3*((len(tcpStates)-2)+1)
+		if len(metrics) != expectCount {
+			t.Fatalf("expected %d metrics, got %d (%#v)", expectCount, len(metrics), metrics)
+		}
+
+		expect := map[string]uint64{
+			"tcp`port`22`established":    2,
+			"tcp`port`22`accept_queue":   0,
+			"tcp`port`8080`time_wait":    1,
+			"tcp`port`8080`close_wait":   1,
+			"tcp`port`8080`established":  0,
+			"tcp`port`8080`accept_queue": 3,
+			"tcp`port`80`established":    1,
+			"tcp`port`80`accept_queue":   1,
+		}
+		for name, val := range expect {
+			m, ok := metrics[name]
+			if !ok {
+				t.Fatalf("expected metric %s", name)
+			}
+			if v := m.Value.(uint64); v != val {
+				t.Fatalf("%s expected %d, got %d", name, val, v)
+			}
+		}
+
+		if _, ok := metrics["tcp`port`50000`established"]; ok {
+			t.Fatal("expected no metrics for non-listening port")
+		}
+	}
+
+	t.Log("good (port allowlist)")
+	{
+		c, err := NewTCPCollector(filepath.Join("testdata", "config_tcp_ports_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+		if _, ok := metrics["tcp`port`8080`accept_queue"]; !ok {
+			t.Fatal("expected metrics for port 8080")
+		}
+		if _, ok := metrics["tcp`port`22`accept_queue"]; ok {
+			t.Fatal("expected no metrics for port 22")
+		}
+	}
+}
@@ -17,28 +17,39 @@ import (
 
 // pfscommon defines ProcFS metrics common elements
 type pfscommon struct {
-	id                  string          // OPT id of the collector (used as metric name prefix)
-	pkgID               string          // package prefix used for logging and errors
-	procFSPath          string          // OPT procfs mount point path
-	file                string          // the file in procfs
-	lastEnd             time.Time       // last collection end time
-	lastError           string          // last collection error
-	lastMetrics         cgm.Metrics     // last metrics collected
-	lastRunDuration     time.Duration   // last collection duration
-	lastStart           time.Time       // last collection start time
-	logger              zerolog.Logger  // collector logging instance
-	metricDefaultActive bool            // OPT default status for metrics NOT explicitly in metricStatus
-	metricNameChar      string          // OPT character(s) used as replacement for metricNameRegex
-	metricNameRegex     *regexp.Regexp  // OPT regex for cleaning names, may be overriden in config
-	metricStatus        map[string]bool // OPT list of metrics and whether they should be collected or not
-	running             bool            // is collector currently running
-	runTTL              time.Duration   // OPT ttl for collectors (default is for every request)
+	id                  string           // OPT id of the collector (used as metric name prefix)
+	pkgID               string           // package prefix used for logging and errors
+	procFSPath          string           // OPT procfs mount point path
+	file                string           // the file in procfs
+	lastEnd             time.Time        // last collection end time
+	lastError           string           // last collection error
+	lastMetrics         cgm.Metrics      // last metrics collected
+	lastRunDuration     time.Duration    // last collection duration
+	lastStart           time.Time        // last collection start time
+	logger              zerolog.Logger   // collector logging instance
+	metricDefaultActive bool             // OPT default status for metrics NOT explicitly in metricStatus
+	metricNameChar      string           // OPT character(s) used as replacement for metricNameRegex
+	metricNameRegex     *regexp.Regexp   // OPT regex for cleaning names, may be overriden in config
+	metricStatus        map[string]bool  // OPT list of metrics and whether they should be collected or not
+	rateCounters        *regexp.Regexp   // counter metrics of the collector (without the id prefix), rates are only computed for these
+	rateCounters32      *regexp.Regexp   // counter metrics of the collector which are 32 bits wide (wrap at 2^32)
+	rateGauges          *regexp.Regexp   // metrics matched by rateCounters which are not counters
+	rateLast            cgm.Metrics      // previous values of the counter metrics used to compute rates
+	rateLastTime        time.Time        // time the previous counter values were collected
+	rateMetrics         []*regexp.Regexp // OPT counter metrics to compute rates for (default all counters)
+	rateMode            string           // OPT compute per second rates for counter metrics (none, also, only)
+	running             bool             // is collector currently running
+	runTTL              time.Duration    // OPT ttl for collectors (default is for every request)
 	sync.Mutex
 }
 
 const (
 	metricNameSeparator = "`"        // character used to separate parts of metric names
 	metricStatusEnabled = "enabled"  // setting string indicating metrics should be made 'active'
+	rateMetricSuffix    = "_per_sec" // suffix added to counter metric names for rate metrics
+	rateModeAlso        = "also"     // setting string to emit rates in addition to counters
+	rateModeNone        = "none"     // setting string to emit only counters
+	rateModeOnly        = "only"     // setting string to emit rates instead of counters
 	regexPat            = `^(?:%s)$` // fmt pattern used compile include/exclude regular expressions
 )
 
@@ -9,6 +9,7 @@ package procfs
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -35,10 +36,15 @@ type vmOptions struct {
 	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
 	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
 	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
-	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" toml:"metrics_default_status"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
 	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
 }
 
+// vmCounters swap paging, page faults and page scans
+var vmCounters = regexp.MustCompile(fmt.Sprintf(regexPat, "vmstat`pswp.+|info`(page_fault(`(major|minor))?|page_scan)"))
+
 // NewVMCollector creates new procfs cpu collector
 func NewVMCollector(cfgBaseName string) (collector.Collector, error) {
 	procFile := "meminfo"
@@ -46,6 +52,7 @@ func NewVMCollector(cfgBaseName string) (collector.Collector, error) {
 	c := VM{}
 	c.id = "vm"
 	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = vmCounters
 	c.procFSPath = "/proc"
 	c.file = filepath.Join(c.procFSPath, procFile)
 	c.logger = log.With().Str("pkg", c.pkgID).Logger()
@@ -107,6 +114,10 @@ func NewVMCollector(cfgBaseName string) (collector.Collector, error) {
 		c.runTTL = dur
 	}
 
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
 	if _, err := os.Stat(c.file); os.IsNotExist(err) {
 		return nil, errors.Wrap(err, c.pkgID)
 	}
@@ -0,0 +1,488 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// ZFS ARC, ZIL, DMU and pool/dataset metrics from the Linux ProcFS (ZFS on Linux kstats)
+type ZFS struct {
+	pfscommon
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+	lastARC map[string]uint64 // previous arc hits and misses used to compute the hit ratios
+}
+
+// zfsOptions defines what elements can be overriden in a config file
+type zfsOptions struct {
+	// common
+	ID                   string   `json:"id" toml:"id" yaml:"id"`
+	ProcFSPath           string   `json:"procfs_path" toml:"procfs_path" yaml:"procfs_path"`
+	MetricsEnabled       []string `json:"metrics_enabled" toml:"metrics_enabled" yaml:"metrics_enabled"`
+	MetricsDisabled      []string `json:"metrics_disabled" toml:"metrics_disabled" yaml:"metrics_disabled"`
+	MetricsDefaultStatus string   `json:"metrics_default_status" toml:"metrics_default_status" yaml:"metrics_default_status"`
+	RunTTL               string   `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	RateMode             string   `json:"rate_mode" toml:"rate_mode" yaml:"rate_mode"`
+	RateMetrics          []string `json:"rate_metrics" toml:"rate_metrics" yaml:"rate_metrics"`
+
+	// collector specific
+	IncludeRegex string `json:"include_regex" toml:"include_regex" yaml:"include_regex"`
+	ExcludeRegex string `json:"exclude_regex" toml:"exclude_regex" yaml:"exclude_regex"`
+}
+
+// kstat a named kstat value
+type kstat struct {
+	name  string
+	dtype int    // kstat data type
+	val   string // raw value
+}
+
+// kstat data types (KSTAT_DATA_*)
+const (
+	kstatDataInt32  = 1
+	kstatDataUint32 = 2
+	kstatDataInt64  = 3
+	kstatDataUint64 = 4
+	kstatDataString = 7
+)
+
+// zfsPoolIONames metric names for the pool io kstat columns
+var zfsPoolIONames = map[string]string{
+	"nread":    "read_bytes",
+	"nwritten": "write_bytes",
+	"reads":    "read_ops",
+	"writes":   "write_ops",
+	"wtime":    "wait_time_ns",
+	"rtime":    "run_time_ns",
+	"wcnt":     "wait_queue",
+	"rcnt":     "run_queue",
+}
+
+// zfsObjsetNames metric names for the dataset (objset) kstats
+var zfsObjsetNames = map[string]string{
+	"nread":     "read_bytes",
+	"nwritten":  "write_bytes",
+	"reads":     "read_ops",
+	"writes":    "write_ops",
+	"nunlinks":  "unlinks",
+	"nunlinked": "unlinked",
+}
+
+// zfsCounters arc hit/miss/eviction, zil, dmu_tx, pool io and dataset counters
+var zfsCounters = regexp.MustCompile(fmt.Sprintf(regexPat, "arcstats`(.*hits|.*misses|deleted|mutex_miss|access_skip|evict_.+|hash_collisions|memory_(throttle|direct|indirect)_count|l2_(read|write)_bytes|l2_writes_.+|l2_evict_.+|l2_abort_lowmem|l2_cksum_bad|l2_io_error|l2_free_on_write|l2_rw_clash)|(zil|dmu_tx)`.+|pool`((read|write)_(bytes|ops)|(wait|run)_time_ns)|dataset`.+"))
+
+// NewZFSCollector creates new procfs zfs collector
+func NewZFSCollector(cfgBaseName string) (collector.Collector, error) {
+	procFile := filepath.Join("spl", "kstat", "zfs")
+
+	c := ZFS{}
+	c.id = "zfs"
+	c.pkgID = "builtins.linux.procfs." + c.id
+	c.rateCounters = zfsCounters
+	c.procFSPath = "/proc"
+	c.file = filepath.Join(c.procFSPath, procFile)
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+	c.metricStatus = map[string]bool{}
+	c.metricDefaultActive = true
+	c.lastARC = make(map[string]uint64)
+
+	c.include = defaultIncludeRegex
+	c.exclude = defaultExcludeRegex
+
+	if cfgBaseName == "" {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil, errors.Wrap(err, c.pkgID)
+		}
+		return &c, nil
+	}
+
+	var opts zfsOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "no config found matching") {
+			return &c, nil
+		}
+		c.logger.Warn().Err(err).Str("file", cfgBaseName).Msg("loading config file")
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if opts.IncludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.IncludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling include regex", c.pkgID)
+		}
+		c.include = rx
+	}
+
+	if opts.ExcludeRegex != "" {
+		rx, err := regexp.Compile(fmt.Sprintf(regexPat, opts.ExcludeRegex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s compiling exclude regex", c.pkgID)
+		}
+		c.exclude = rx
+	}
+
+	if opts.ID != "" {
+		c.id = opts.ID
+	}
+
+	if opts.ProcFSPath != "" {
+		c.procFSPath = opts.ProcFSPath
+		c.file = filepath.Join(c.procFSPath, procFile)
+	}
+
+	if len(opts.MetricsEnabled) > 0 {
+		for _, name := range opts.MetricsEnabled {
+			c.metricStatus[name] = true
+		}
+	}
+	if len(opts.MetricsDisabled) > 0 {
+		for _, name := range opts.MetricsDisabled {
+			c.metricStatus[name] = false
+		}
+	}
+
+	if opts.MetricsDefaultStatus != "" {
+		if ok, _ := regexp.MatchString(`^(enabled|disabled)$`, strings.ToLower(opts.MetricsDefaultStatus)); ok {
+			c.metricDefaultActive = strings.ToLower(opts.MetricsDefaultStatus) == metricStatusEnabled
+		} else {
+			return nil, errors.Errorf("%s invalid metric default status (%s)", c.pkgID, opts.MetricsDefaultStatus)
+		}
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	if err := c.setRateOptions(opts.RateMode, opts.RateMetrics); err != nil {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return nil, errors.Wrap(err, c.pkgID)
+	}
+
+	return &c, nil
+}
+
+// Collect metrics from the procfs resource
+func (c *ZFS) Collect() error {
+	metrics := cgm.Metrics{}
+
+	c.Lock()
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	if err := c.arcCollect(&metrics); err != nil {
+		c.setStatus(metrics, err)
+		return errors.Wrap(err, c.pkgID)
+	}
+
+	for _, name := range []string{"zil", "dmu_tx"} {
+		stats, err := c.parseNamedKstat(filepath.Join(c.file, name))
+		if err != nil {
+			if !os.IsNotExist(errors.Cause(err)) {
+				c.logger.Warn().Err(err).Str("kstat", name).Msg("parsing, ignoring")
+			}
+			continue
+		}
+		c.addKstatMetrics(&metrics, c.id+metricNameSeparator+name, stats)
+	}
+
+	if err := c.poolsCollect(&metrics); err != nil {
+		c.logger.Warn().Err(err).Msg("pools")
+	}
+
+	c.setStatus(metrics, nil)
+	return nil
+}
+
+// arcCollect gets metrics from arcstats, along with the hit ratios for the
+// interval since the previous collection (not emitted on the first collection)
+func (c *ZFS) arcCollect(metrics *cgm.Metrics) error {
+	stats, err := c.parseNamedKstat(filepath.Join(c.file, "arcstats"))
+	if err != nil {
+		return errors.Wrap(err, "arcstats")
+	}
+
+	pfx := c.id + metricNameSeparator + "arcstats"
+	c.addKstatMetrics(metrics, pfx, stats)
+
+	vals := make(map[string]uint64)
+	for _, s := range stats {
+		if v, err := strconv.ParseUint(s.val, 10, 64); err == nil {
+			vals[s.name] = v
+		}
+	}
+
+	// the since boot counters barely move after some uptime, the ratios
+	// reflect the cache behaviour over the interval
+	ratios := []struct {
+		name   string
+		hits   string
+		misses string
+	}{
+		{"hit_ratio", "hits", "misses"},
+		{"demand_data_hit_ratio", "demand_data_hits", "demand_data_misses"},
+		{"l2_hit_ratio", "l2_hits", "l2_misses"},
+	}
+	last := make(map[string]uint64)
+	for _, r := range ratios {
+		hits, hok := vals[r.hits]
+		misses, mok := vals[r.misses]
+		if !hok || !mok {
+			continue
+		}
+		last[r.hits], last[r.misses] = hits, misses
+
+		lastHits, hok := c.lastARC[r.hits]
+		lastMisses, mok := c.lastARC[r.misses]
+		if !hok || !mok || hits < lastHits || misses < lastMisses {
+			continue
+		}
+		dHits, dMisses := hits-lastHits, misses-lastMisses
+		if dHits+dMisses == 0 {
+			continue
+		}
+		c.addMetric(metrics, pfx, r.name, "n", float64(dHits)/float64(dHits+dMisses))
+	}
+	c.lastARC = last
+
+	return nil
+}
+
+// poolsCollect gets per pool io and per dataset metrics from the pool directories
+func (c *ZFS) poolsCollect(metrics *cgm.Metrics) error {
+	entries, err := ioutil.ReadDir(c.file)
+	if err != nil {
+		return errors.Wrap(err, "reading pools")
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pool := entry.Name()
+		poolDir := filepath.Join(c.file, pool)
+
+		if c.exclude.MatchString(pool) || !c.include.MatchString(pool) {
+			c.logger.Debug().Str("pool", pool).Msg("excluded pool, skipping")
+			continue
+		}
+
+		// io kstat is not present in newer releases (2.x)
+		if err := c.poolIOCollect(metrics, pool, filepath.Join(poolDir, "io")); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			c.logger.Warn().Err(err).Str("pool", pool).Msg("pool io")
+		}
+
+		objsets, err := filepath.Glob(filepath.Join(poolDir, "objset-*"))
+		if err != nil {
+			continue
+		}
+		for _, objset := range objsets {
+			stats, err := c.parseNamedKstat(objset)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("objset", objset).Msg("parsing, ignoring")
+				continue
+			}
+			c.objsetCollect(metrics, pool, stats)
+		}
+	}
+
+	return nil
+}
+
+// poolIOCollect gets metrics from a pool io kstat, format:
+//
+//	12 3 0x00 1 80 2184169766 113346880768
+//	nread    nwritten   reads    writes   wtime    wlentime   wupdate  rtime    rlentime   rupdate  wcnt     rcnt
+//	1234     5678       12       34       ...
+func (c *ZFS) poolIOCollect(metrics *cgm.Metrics, pool, fn string) error {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return errors.Wrap(err, "reading")
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		return errors.Errorf("invalid io kstat, expected 3 lines found %d", len(lines))
+	}
+	names := strings.Fields(lines[1])
+	values := strings.Fields(lines[2])
+	if len(names) != len(values) {
+		return errors.Errorf("invalid io kstat, %d names %d values", len(names), len(values))
+	}
+
+	streamTags, err := tags.PrepStreamTags("pool" + tags.Delimiter + cleanTagValue(pool))
+	if err != nil {
+		return errors.Wrap(err, "prep stream tags")
+	}
+
+	pfx := c.id + metricNameSeparator + "pool"
+	for i, name := range names {
+		mname, ok := zfsPoolIONames[name]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseUint(values[i], 10, 64)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("pool", pool).Msg("parsing field " + name)
+			continue
+		}
+		c.addTaggedMetric(metrics, pfx, mname, streamTags, "L", v)
+	}
+
+	return nil
+}
+
+// objsetCollect adds the metrics for a dataset (objset kstat)
+func (c *ZFS) objsetCollect(metrics *cgm.Metrics, pool string, stats []kstat) {
+	dataset := ""
+	for _, s := range stats {
+		if s.name == "dataset_name" {
+			dataset = s.val
+			break
+		}
+	}
+	if dataset == "" {
+		return
+	}
+	if c.exclude.MatchString(dataset) {
+		c.logger.Debug().Str("dataset", dataset).Msg("excluded dataset, skipping")
+		return
+	}
+
+	streamTags, err := tags.PrepStreamTags(strings.Join([]string{
+		"dataset" + tags.Delimiter + cleanTagValue(dataset),
+		"pool" + tags.Delimiter + cleanTagValue(pool),
+	}, tags.Separator))
+	if err != nil {
+		c.logger.Warn().Err(err).Str("dataset", dataset).Msg("prep stream tags")
+		return
+	}
+
+	pfx := c.id + metricNameSeparator + "dataset"
+	for _, s := range stats {
+		mname, ok := zfsObjsetNames[s.name]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseUint(s.val, 10, 64)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("dataset", dataset).Msg("parsing field " + s.name)
+			continue
+		}
+		c.addTaggedMetric(metrics, pfx, mname, streamTags, "L", v)
+	}
+}
+
+// addKstatMetrics adds the numeric named kstat values as metrics
+func (c *ZFS) addKstatMetrics(metrics *cgm.Metrics, prefix string, stats []kstat) {
+	for _, s := range stats {
+		switch s.dtype {
+		case kstatDataUint32, kstatDataUint64:
+			v, err := strconv.ParseUint(s.val, 10, 64)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("prefix", prefix).Msg("parsing field " + s.name)
+				continue
+			}
+			c.addMetric(metrics, prefix, s.name, "L", v)
+		case kstatDataInt32, kstatDataInt64:
+			v, err := strconv.ParseInt(s.val, 10, 64)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("prefix", prefix).Msg("parsing field " + s.name)
+				continue
+			}
+			c.addMetric(metrics, prefix, s.name, "l", v)
+		}
+	}
+}
+
+// parseNamedKstat parses a named kstat file, format:
+//
+//	13 1 0x01 96 26112 3936727024 1232124125
+//	name                            type data
+//	hits                            4    1234567
+//	misses                          4    8910
+func (c *ZFS) parseNamedKstat(fn string) ([]kstat, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening")
+	}
+	defer f.Close()
+
+	stats := []kstat{}
+	lineNum := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNum++
+		if lineNum <= 2 {
+			continue // kstat header and column names
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		dtype, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		val := fields[2]
+		if dtype == kstatDataString {
+			val = strings.Join(fields[2:], " ")
+		}
+		stats = append(stats, kstat{name: fields[0], dtype: dtype, val: val})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading")
+	}
+
+	if lineNum < 2 {
+		return nil, errors.Errorf("invalid kstat %s", fn)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,239 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build linux
+
+package procfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNewZFSCollector(t *testing.T) {
+	t.Log("Testing NewZFSCollector")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("config (missing)")
+	{
+		_, err := NewZFSCollector(filepath.Join("testdata", "missing"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("config (bad syntax)")
+	{
+		_, err := NewZFSCollector(filepath.Join("testdata", "bad_syntax"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (procfs path setting)")
+	{
+		c, err := NewZFSCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := filepath.Join("testdata", "spl", "kstat", "zfs")
+		if c.(*ZFS).file != expect {
+			t.Fatalf("expected (%s), got (%s)", expect, c.(*ZFS).file)
+		}
+	}
+
+	t.Log("config (procfs path setting invalid)")
+	{
+		_, err := NewZFSCollector(filepath.Join("testdata", "config_procfs_path_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (include regex)")
+	{
+		c, err := NewZFSCollector(filepath.Join("testdata", "config_include_regex_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := fmt.Sprintf(regexPat, `^foo`)
+		if c.(*ZFS).include.String() != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, c.(*ZFS).include.String())
+		}
+	}
+
+	t.Log("config (include regex invalid)")
+	{
+		_, err := NewZFSCollector(filepath.Join("testdata", "config_include_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (exclude regex invalid)")
+	{
+		_, err := NewZFSCollector(filepath.Join("testdata", "config_exclude_regex_invalid_setting"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := NewZFSCollector(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*ZFS).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+	}
+}
+
+func TestZFSCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := NewZFSCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*ZFS).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good")
+	{
+		c, err := NewZFSCollector(filepath.Join("testdata", "config_procfs_path_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+
+		home := "|ST[dataset:tank/home,pool:tank]"
+		root := "|ST[dataset:rpool/ROOT/ubuntu,pool:rpool]"
+
+		tests := []struct {
+			name string
+			val  uint64
+		}{
+			{"zfs`arcstats`size", 4294967296},
+			{"zfs`arcstats`c", 8589934592},
+			{"zfs`arcstats`l2_size", 107374182400},
+			{"zfs`zil`zil_commit_count", 1200},
+			{"zfs`dmu_tx`dmu_tx_delay", 3},
+			{"zfs`pool`read_bytes|ST[pool:tank]", 1073741824},
+			{"zfs`pool`write_ops|ST[pool:tank]", 4096},
+			{"zfs`dataset`read_bytes" + home, 4194304},
+			{"zfs`dataset`write_ops" + home, 310},
+			{"zfs`dataset`unlinked" + root, 299},
+		}
+		for _, test := range tests {
+			m, ok := metrics[test.name]
+			if !ok {
+				t.Fatalf("expected metric %s", test.name)
+			}
+			if v := m.Value.(uint64); v != test.val {
+				t.Fatalf("%s expected %d, got %d", test.name, test.val, v)
+			}
+		}
+
+		for _, name := range []string{"hit_ratio", "demand_data_hit_ratio", "l2_hit_ratio"} {
+			if _, ok := metrics["zfs`arcstats`"+name]; ok {
+				t.Fatalf("expected no %s on first collection", name)
+			}
+		}
+
+		// previous sample, ratios are for the interval
+		c.(*ZFS).lastARC = map[string]uint64{
+			"hits":               500,
+			"misses":             0,
+			"demand_data_hits":   400,
+			"demand_data_misses": 150,
+			"l2_hits":            20,
+			"l2_misses":          30,
+		}
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		metrics = c.Flush()
+
+		ratios := []struct {
+			name string
+			val  float64
+		}{
+			{"zfs`arcstats`hit_ratio", 0.8},
+			{"zfs`arcstats`demand_data_hit_ratio", 0.8},
+			{"zfs`arcstats`l2_hit_ratio", 0.2},
+		}
+		for _, test := range ratios {
+			m, ok := metrics[test.name]
+			if !ok {
+				t.Fatalf("expected metric %s", test.name)
+			}
+			if v := m.Value.(float64); v != test.val {
+				t.Fatalf("%s expected %f, got %f", test.name, test.val, v)
+			}
+		}
+
+		m, ok := metrics["zfs`arcstats`memory_available_bytes"]
+		if !ok {
+			t.Fatal("expected metric zfs`arcstats`memory_available_bytes")
+		}
+		if v := m.Value.(int64); v != -134217728 {
+			t.Fatalf("expected -134217728, got %d", v)
+		}
+
+		if _, ok := metrics["zfs`arcstats`dataset_name"]; ok {
+			t.Fatal("expected no string kstat metrics")
+		}
+	}
+
+	t.Log("good (exclude)")
+	{
+		c, err := NewZFSCollector(filepath.Join("testdata", "config_zfs_exclude_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+
+		if _, ok := metrics["zfs`dataset`read_bytes|ST[dataset:tank/home,pool:tank]"]; !ok {
+			t.Fatal("expected tank/home dataset metrics")
+		}
+		for name := range metrics {
+			if strings.Contains(name, "tank/scratch") || strings.Contains(name, "rpool") {
+				t.Fatalf("unexpected excluded metric %s", name)
+			}
+		}
+	}
+}
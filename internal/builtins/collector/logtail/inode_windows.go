@@ -0,0 +1,16 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build windows
+
+package logtail
+
+import "os"
+
+// fileInode is not available on windows, rotation is detected as
+// truncation (a new file is smaller than the offset or starts differently)
+func fileInode(fi os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,191 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// Package logtail provides a builtin collector which tails log files and
+// produces metrics from lines matching configured patterns.
+package logtail
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// New creates new log tail collector
+func New(cfgBaseName string) (collector.Collector, error) {
+	c := LogTail{
+		maxReadBytes: defaultMaxReadBytes,
+		startAtEnd:   true,
+	}
+	c.pkgID = "builtins.logtail"
+	c.logger = log.With().Str("pkg", c.pkgID).Logger()
+
+	// LogTail requires a configuration file, there is nothing to tail
+	// without a list of files. The default config is a file named
+	// logtail_collector.(json|toml|yaml) located in the agent's
+	// default etc path. (e.g. /opt/circonus/agent/etc/logtail_collector.yaml)
+	if cfgBaseName == "" {
+		cfgBaseName = path.Join(defaults.EtcPath, "logtail_collector")
+	}
+
+	var opts logtailOptions
+	err := config.LoadConfigFile(cfgBaseName, &opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s config", c.pkgID)
+	}
+
+	c.logger.Debug().Str("base", cfgBaseName).Interface("config", opts).Msg("loaded config")
+
+	if len(opts.Files) == 0 {
+		return nil, errors.New("'files' is REQUIRED in configuration")
+	}
+
+	ids := make(map[string]bool, len(opts.Files))
+	for i, fd := range opts.Files {
+		if !idRx.MatchString(fd.ID) {
+			return nil, errors.Errorf("%s files item %d, invalid id (%s)", c.pkgID, i, fd.ID)
+		}
+		if ids[fd.ID] {
+			return nil, errors.Errorf("%s files item %d, duplicate id (%s)", c.pkgID, i, fd.ID)
+		}
+		ids[fd.ID] = true
+		if fd.Path == "" {
+			return nil, errors.Errorf("%s file %s, path is REQUIRED", c.pkgID, fd.ID)
+		}
+		if len(fd.Rules) == 0 {
+			return nil, errors.Errorf("%s file %s, rules are REQUIRED", c.pkgID, fd.ID)
+		}
+
+		tf := &tailedFile{id: fd.ID, path: filepath.Clean(fd.Path)}
+		names := make(map[string]bool, len(fd.Rules))
+		for _, rd := range fd.Rules {
+			if names[rd.Name] {
+				return nil, errors.Errorf("%s file %s, duplicate rule (%s)", c.pkgID, fd.ID, rd.Name)
+			}
+			names[rd.Name] = true
+			r, err := newRule(rd)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s file %s", c.pkgID, fd.ID)
+			}
+			tf.rules = append(tf.rules, r)
+		}
+		c.files = append(c.files, tf)
+	}
+
+	if opts.StartPosition != "" {
+		switch strings.ToLower(opts.StartPosition) {
+		case startPositionBegin:
+			c.startAtEnd = false
+		case startPositionEnd:
+			c.startAtEnd = true
+		default:
+			return nil, errors.Errorf("%s invalid start_position (%s)", c.pkgID, opts.StartPosition)
+		}
+	}
+
+	if opts.MaxReadBytes < 0 {
+		return nil, errors.Errorf("%s invalid max_read_bytes (%d)", c.pkgID, opts.MaxReadBytes)
+	}
+	if opts.MaxReadBytes > 0 {
+		c.maxReadBytes = opts.MaxReadBytes
+	}
+
+	if opts.RunTTL != "" {
+		dur, err := time.ParseDuration(opts.RunTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s parsing run_ttl", c.pkgID)
+		}
+		c.runTTL = dur
+	}
+
+	stateDir := opts.StateDir
+	if stateDir == "" {
+		stateDir = viper.GetString(config.KeyCheckMetricStateDir)
+	}
+	if stateDir == "" {
+		stateDir = defaults.CheckMetricStatePath
+	}
+	if stateDir != "" {
+		if fi, err := os.Stat(stateDir); err != nil || !fi.IsDir() {
+			c.logger.Warn().Err(err).Str("state_dir", stateDir).Msg("invalid state directory, read offsets will not be persisted")
+		} else {
+			c.stateFile = filepath.Join(stateDir, stateFileName)
+		}
+	}
+
+	if err := c.loadState(); err != nil {
+		c.logger.Warn().Err(err).Str("file", c.stateFile).Msg("loading state, ignoring")
+	}
+
+	return &c, nil
+}
+
+// Collect reads new lines from the log files and returns collector metrics
+func (c *LogTail) Collect() error {
+	metrics := cgm.Metrics{}
+	c.Lock()
+
+	if c.running {
+		c.logger.Warn().Msg(collector.ErrAlreadyRunning.Error())
+		c.Unlock()
+		return collector.ErrAlreadyRunning
+	}
+
+	if c.runTTL > time.Duration(0) {
+		if time.Since(c.lastEnd) < c.runTTL {
+			c.logger.Warn().Msg(collector.ErrTTLNotExpired.Error())
+			c.Unlock()
+			return collector.ErrTTLNotExpired
+		}
+	}
+
+	c.running = true
+	c.lastStart = time.Now()
+	c.Unlock()
+
+	// the first error is reported as the collector status, the
+	// other files are still read
+	var collectErr error
+
+	for _, tf := range c.files {
+		err := c.tail(tf)
+		if err == nil && tf.file == nil {
+			err = errors.New("file not found")
+		}
+		if err != nil {
+			c.logger.Error().Err(err).Str("id", tf.id).Str("path", tf.path).Msg("tailing log file")
+			if collectErr == nil {
+				collectErr = errors.Wrapf(err, "%s file %s (%s)", c.pkgID, tf.id, tf.path)
+			}
+		}
+		for _, r := range tf.rules {
+			if r.dropped > 0 {
+				c.logger.Warn().Str("id", tf.id).Str("rule", r.name).Int("max_tag_sets", r.maxSets).Uint64("dropped", r.dropped).Msg("too many tag sets, values dropped")
+				r.dropped = 0
+			}
+			r.addMetrics(metrics, tf.id+metricNameSeparator+r.name)
+		}
+	}
+
+	if err := c.saveState(); err != nil {
+		c.logger.Warn().Err(err).Str("file", c.stateFile).Msg("saving state")
+		if collectErr == nil {
+			collectErr = errors.Wrapf(err, "%s saving state", c.pkgID)
+		}
+	}
+
+	c.setStatus(metrics, collectErr)
+	return collectErr
+}
@@ -0,0 +1,227 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package logtail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/rs/zerolog"
+)
+
+func TestNew(t *testing.T) {
+	t.Log("Testing New")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("default config (not found)")
+	{
+		_, err := New("")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	tt := []struct {
+		desc string
+		cfg  string
+	}{
+		{"config (missing)", "missing"},
+		{"config (no files)", "no_files"},
+		{"config (run ttl invalid)", "config_run_ttl_invalid_setting"},
+		{"config (start position invalid)", "config_start_position_invalid_setting"},
+		{"config (rule type invalid)", "config_rule_type_invalid_setting"},
+		{"config (rule value missing)", "config_rule_value_missing_setting"},
+		{"config (rule macro invalid)", "config_rule_macro_invalid_setting"},
+		{"config (file id invalid)", "config_file_id_invalid_setting"},
+	}
+	for _, tst := range tt {
+		t.Log(tst.desc)
+		_, err := New(filepath.Join("testdata", tst.cfg))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("config (run ttl 5m)")
+	{
+		c, err := New(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.(*LogTail).runTTL != 5*time.Minute {
+			t.Fatal("expected 5m")
+		}
+		if !c.(*LogTail).startAtEnd {
+			t.Fatal("expected start at end (default)")
+		}
+	}
+
+	t.Log("config (valid)")
+	{
+		c, err := New(filepath.Join("testdata", "valid"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		lt := c.(*LogTail)
+		if len(lt.files) != 1 {
+			t.Fatalf("expected 1 file, got %d", len(lt.files))
+		}
+		if len(lt.files[0].rules) != 5 {
+			t.Fatalf("expected 5 rules, got %d", len(lt.files[0].rules))
+		}
+		if lt.startAtEnd {
+			t.Fatal("expected start at beginning")
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	t.Log("Testing Collect")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("already running")
+	{
+		c, err := New(filepath.Join("testdata", "valid"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*LogTail).running = true
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrAlreadyRunning.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrAlreadyRunning, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("ttl not expired")
+	{
+		c, err := New(filepath.Join("testdata", "config_run_ttl_valid_setting"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		c.(*LogTail).lastEnd = time.Now()
+
+		if err := c.Collect(); err != nil {
+			if err.Error() != collector.ErrTTLNotExpired.Error() {
+				t.Fatalf("expected (%s) got (%s)", collector.ErrTTLNotExpired, err)
+			}
+		} else {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("good")
+	{
+		c, err := New(filepath.Join("testdata", "valid"))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		c.(*LogTail).stateFile = ""
+
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		metrics := c.Flush()
+
+		counters := []struct {
+			name string
+			val  uint64
+		}{
+			{"nginx`requests|ST[method:GET,status:200]", 2},
+			{"nginx`requests|ST[method:GET,status:500]", 1},
+			{"nginx`requests|ST[method:POST,status:502]", 1},
+			{"nginx`http_5xx", 2},
+		}
+		for _, test := range counters {
+			m, ok := metrics[test.name]
+			if !ok {
+				t.Fatalf("expected metric %s, got %#v", test.name, metrics)
+			}
+			if v := m.Value.(uint64); v != test.val {
+				t.Fatalf("%s expected %d, got %d", test.name, test.val, v)
+			}
+		}
+
+		values := []struct {
+			name string
+			val  float64
+		}{
+			{"nginx`bytes", 1216},
+			{"nginx`last_bytes", 512},
+		}
+		for _, test := range values {
+			m, ok := metrics[test.name]
+			if !ok {
+				t.Fatalf("expected metric %s, got %#v", test.name, metrics)
+			}
+			if v := m.Value.(float64); v != test.val {
+				t.Fatalf("%s expected %f, got %f", test.name, test.val, v)
+			}
+		}
+
+		m, ok := metrics["nginx`latency_ms"]
+		if !ok {
+			t.Fatalf("expected histogram metric, got %#v", metrics)
+		}
+		if samples := m.Value.([]string); len(samples) != 4 {
+			t.Fatalf("expected 4 histogram bins, got %v", samples)
+		}
+
+		t.Log("\tno new lines")
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		metrics = c.Flush()
+		if _, ok := metrics["nginx`latency_ms"]; ok {
+			t.Fatal("expected no histogram samples")
+		}
+		if m := metrics["nginx`http_5xx"]; m.Value.(uint64) != 2 {
+			t.Fatalf("expected counter to be retained, got %v", m)
+		}
+	}
+
+	t.Log("missing file")
+	{
+		dir, err := ioutil.TempDir("", "logtail")
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		defer os.RemoveAll(dir)
+
+		c, tf := newTestTail(t, dir, false)
+		defer tf.close()
+
+		if err := c.Collect(); err == nil {
+			t.Fatal("expected error")
+		}
+		if c.Inventory().LastError == "" {
+			t.Fatal("expected last error in inventory")
+		}
+
+		appendLog(t, tf.path, "ERROR one\n")
+		if err := c.Collect(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if c.Inventory().LastError != "" {
+			t.Fatalf("expected last error to be cleared, got (%s)", c.Inventory().LastError)
+		}
+		if m := c.Flush()["app`errors"]; m.Value.(uint64) != 1 {
+			t.Fatalf("expected 1, got %v", m)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package logtail
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/circonus-labs/circonusllhist"
+	"github.com/pkg/errors"
+)
+
+// newRule validates and compiles a rule definition
+func newRule(rd RuleDef) (*rule, error) {
+	if !idRx.MatchString(rd.Name) {
+		return nil, errors.Errorf("invalid rule name (%s)", rd.Name)
+	}
+
+	pattern, err := expandPattern(rd.Pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rule %s", rd.Name)
+	}
+	rx, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rule %s, compiling pattern", rd.Name)
+	}
+
+	r := &rule{
+		name:    rd.Name,
+		rx:      rx,
+		mtype:   strings.ToLower(rd.Type),
+		value:   -1,
+		scale:   rd.Scale,
+		maxSets: defaultMaxTagSets,
+		counts:  make(map[string]uint64),
+		sums:    make(map[string]float64),
+		gauges:  make(map[string]float64),
+		hists:   make(map[string]*circonusllhist.Histogram),
+	}
+
+	if r.mtype == "" {
+		r.mtype = ruleTypeCounter
+	}
+
+	if rd.MaxTagSets < 0 {
+		return nil, errors.Errorf("rule %s, invalid max_tag_sets (%d)", rd.Name, rd.MaxTagSets)
+	}
+	if rd.MaxTagSets > 0 {
+		r.maxSets = rd.MaxTagSets
+	}
+	switch r.mtype {
+	case ruleTypeCounter:
+	case ruleTypeGauge, ruleTypeHistogram:
+		if rd.Value == "" {
+			return nil, errors.Errorf("rule %s, value capture is REQUIRED for %s", rd.Name, r.mtype)
+		}
+	default:
+		return nil, errors.Errorf("rule %s, invalid type (%s)", rd.Name, rd.Type)
+	}
+
+	if rd.Value != "" {
+		r.value = subexpIndex(rx, rd.Value)
+		if r.value == -1 {
+			return nil, errors.Errorf("rule %s, value capture (%s) not found in pattern", rd.Name, rd.Value)
+		}
+	}
+
+	for _, tn := range rd.Tags {
+		idx := subexpIndex(rx, tn)
+		if idx == -1 {
+			return nil, errors.Errorf("rule %s, tag capture (%s) not found in pattern", rd.Name, tn)
+		}
+		r.tags = append(r.tags, idx)
+		r.tagNames = append(r.tagNames, tn)
+	}
+
+	return r, nil
+}
+
+// subexpIndex returns the index of a named capture, -1 if not found
+func subexpIndex(rx *regexp.Regexp, name string) int {
+	for i, n := range rx.SubexpNames() {
+		if i > 0 && n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// expandPattern replaces %{NAME} and %{NAME:capture} macros with the
+// corresponding regular expression (non-capturing or named capture)
+func expandPattern(pattern string) (string, error) {
+	if pattern == "" {
+		return "", errors.New("pattern is REQUIRED")
+	}
+
+	var err error
+	expanded := grokRx.ReplaceAllStringFunc(pattern, func(m string) string {
+		parts := grokRx.FindStringSubmatch(m)
+		p, ok := grokPatterns[parts[1]]
+		if !ok {
+			err = errors.Errorf("unknown pattern macro (%s)", parts[1])
+			return m
+		}
+		if parts[2] == "" {
+			return "(?:" + p + ")"
+		}
+		return "(?P<" + parts[2] + ">" + p + ")"
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return expanded, nil
+}
+
+// process applies the rule to a line, returns an error if the line
+// matched but the value could not be parsed
+func (r *rule) process(line string) error {
+	m := r.rx.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+
+	key := r.tagSpec(m)
+	if !r.tagSetAllowed(key) {
+		r.dropped++
+		return nil
+	}
+
+	if r.value == -1 {
+		r.counts[key]++
+		return nil
+	}
+
+	v, err := strconv.ParseFloat(m[r.value], 64)
+	if err != nil {
+		return errors.Wrapf(err, "rule %s, parsing value", r.name)
+	}
+	if r.scale != 0 {
+		v *= r.scale
+	}
+
+	switch r.mtype {
+	case ruleTypeCounter:
+		r.sums[key] += v
+	case ruleTypeGauge:
+		r.gauges[key] = v
+	case ruleTypeHistogram:
+		h, ok := r.hists[key]
+		if !ok {
+			h = circonusllhist.New()
+			r.hists[key] = h
+		}
+		if err := h.RecordValue(v); err != nil {
+			return errors.Wrapf(err, "rule %s, recording value", r.name)
+		}
+	}
+
+	return nil
+}
+
+// tagSetAllowed determines if a value may be recorded for a tag set, a rule
+// keeps at most maxSets tag sets - values for new tag sets beyond the limit
+// are dropped (e.g. a tag capture with unbounded values)
+func (r *rule) tagSetAllowed(key string) bool {
+	var ok bool
+	var n int
+	switch {
+	case r.value == -1:
+		_, ok = r.counts[key]
+		n = len(r.counts)
+	case r.mtype == ruleTypeCounter:
+		_, ok = r.sums[key]
+		n = len(r.sums)
+	case r.mtype == ruleTypeGauge:
+		_, ok = r.gauges[key]
+		n = len(r.gauges)
+	case r.mtype == ruleTypeHistogram:
+		_, ok = r.hists[key]
+		n = len(r.hists)
+	}
+	return ok || n < r.maxSets
+}
+
+// tagSpec returns the stream tag spec for the tag captures of a match
+func (r *rule) tagSpec(m []string) string {
+	if len(r.tags) == 0 {
+		return ""
+	}
+
+	tagList := make([]string, 0, len(r.tags))
+	for i, idx := range r.tags {
+		tv := tagValueCleaner.ReplaceAllString(m[idx], "_")
+		if tv == "" {
+			continue
+		}
+		tagList = append(tagList, r.tagNames[i]+tags.Delimiter+tv)
+	}
+
+	spec, err := tags.PrepStreamTags(strings.Join(tagList, tags.Separator))
+	if err != nil {
+		return ""
+	}
+
+	return spec
+}
+
+// addMetrics adds the current values of the rule to metrics, counters and
+// gauges are cumulative, histogram samples are reset after each collection
+func (r *rule) addMetrics(metrics cgm.Metrics, prefix string) {
+	for key, v := range r.counts {
+		metrics[prefix+key] = cgm.Metric{Type: "L", Value: v}
+	}
+	for key, v := range r.sums {
+		metrics[prefix+key] = cgm.Metric{Type: "n", Value: v}
+	}
+	for key, v := range r.gauges {
+		metrics[prefix+key] = cgm.Metric{Type: "n", Value: v}
+	}
+	for key, h := range r.hists {
+		// histograms are sent to the broker as encoded 'n' metrics
+		metrics[prefix+key] = cgm.Metric{Type: "n", Value: h.DecStrings()}
+	}
+	r.hists = make(map[string]*circonusllhist.Histogram)
+}
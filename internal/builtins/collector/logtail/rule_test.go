@@ -0,0 +1,106 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package logtail
+
+import (
+	"testing"
+
+	cgm "github.com/circonus-labs/circonus-gometrics"
+)
+
+func TestExpandPattern(t *testing.T) {
+	t.Log("Testing expandPattern")
+
+	tt := []struct {
+		pattern     string
+		expect      string
+		shouldError bool
+	}{
+		{"", "", true},
+		{"foo", "foo", false},
+		{"%{INT}", "(?:" + grokPatterns["INT"] + ")", false},
+		{"%{WORD:method} x", "(?P<method>" + grokPatterns["WORD"] + ") x", false},
+		{"%{FOO:bar}", "", true},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.pattern)
+		p, err := expandPattern(tst.pattern)
+		if tst.shouldError {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if p != tst.expect {
+			t.Fatalf("expected (%s) got (%s)", tst.expect, p)
+		}
+	}
+}
+
+func TestRule(t *testing.T) {
+	t.Log("Testing rule")
+
+	t.Log("invalid tag capture")
+	{
+		if _, err := newRule(RuleDef{Name: "foo", Pattern: "%{INT:code}", Tags: []string{"status"}}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("gauge, tag value cleaned")
+	{
+		r, err := newRule(RuleDef{Name: "queue", Pattern: `queue=%{NOTSPACE:queue} depth=%{INT:depth}`, Type: "Gauge", Value: "depth", Tags: []string{"queue"}})
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		for _, line := range []string{"queue=a:b depth=5", "queue=a:b depth=7", "queue=c depth=x", "nothing"} {
+			r.process(line)
+		}
+		metrics := cgm.Metrics{}
+		r.addMetrics(metrics, "app`queue")
+		if len(metrics) != 1 {
+			t.Fatalf("expected 1 metric, got %#v", metrics)
+		}
+		m, ok := metrics["app`queue|ST[queue:a_b]"]
+		if !ok {
+			t.Fatalf("expected metric, got %#v", metrics)
+		}
+		if v := m.Value.(float64); v != 7 {
+			t.Fatalf("expected 7, got %f", v)
+		}
+	}
+
+	t.Log("invalid max tag sets")
+	{
+		if _, err := newRule(RuleDef{Name: "foo", Pattern: "%{INT:code}", Tags: []string{"code"}, MaxTagSets: -1}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("max tag sets")
+	{
+		r, err := newRule(RuleDef{Name: "requests", Pattern: `path=%{NOTSPACE:path}`, Tags: []string{"path"}, MaxTagSets: 2})
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		for _, line := range []string{"path=/a", "path=/b", "path=/c", "path=/a", "path=/d"} {
+			r.process(line)
+		}
+		if len(r.counts) != 2 {
+			t.Fatalf("expected 2 tag sets, got %#v", r.counts)
+		}
+		if r.counts["|ST[path:/a]"] != 2 {
+			t.Fatalf("expected existing tag set to be counted, got %#v", r.counts)
+		}
+		if r.dropped != 2 {
+			t.Fatalf("expected 2 dropped, got %d", r.dropped)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package logtail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// tail reads lines appended to a log file since the last collection. A file
+// which has been rotated (the path refers to a different inode) is drained
+// before the new file is read from the beginning. A file which has been
+// truncated (e.g. logrotate copytruncate) is read from the beginning, it is
+// truncated if it is smaller than the read offset or if the first bytes of
+// the file changed (truncated and written past the offset since the last
+// collection).
+func (c *LogTail) tail(tf *tailedFile) error {
+	fi, err := os.Stat(tf.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return errors.Wrap(err, "stat")
+		}
+		fi = nil // missing, may be in the middle of rotation
+	}
+
+	if tf.file != nil {
+		switch {
+		case fi == nil || fileInode(fi) != tf.inode:
+			c.logger.Debug().Str("id", tf.id).Str("path", tf.path).Msg("rotated")
+			more, err := c.readLines(tf)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("id", tf.id).Msg("draining rotated file")
+			} else if more {
+				return nil // continue draining the rotated file in the next collection
+			}
+			tf.close()
+			tf.offset = 0
+			tf.head = nil
+		case fi.Size() < tf.offset || headChanged(tf.file, tf.head):
+			c.logger.Debug().Str("id", tf.id).Str("path", tf.path).Msg("truncated")
+			tf.close()
+			tf.offset = 0
+			tf.head = nil
+		}
+	}
+
+	if fi == nil {
+		return nil // wait for the file to (re)appear
+	}
+
+	if tf.file == nil {
+		f, err := os.Open(tf.path)
+		if err != nil {
+			return errors.Wrap(err, "open")
+		}
+		ofi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return errors.Wrap(err, "stat")
+		}
+		tf.file = f
+		tf.inode = fileInode(ofi)
+		if !tf.opened {
+			tf.offset = c.startOffset(tf, ofi)
+			tf.opened = true
+		}
+	}
+
+	if _, err := c.readLines(tf); err != nil {
+		return err
+	}
+	recordHead(tf)
+	return nil
+}
+
+// startOffset determines where to start reading a file the first time it
+// is opened. A saved offset for the same file is resumed, a different file
+// (rotated or truncated while the agent was not running) is read from the
+// beginning.
+func (c *LogTail) startOffset(tf *tailedFile, fi os.FileInfo) int64 {
+	if tf.saved != nil && tf.saved.Path == tf.path {
+		if tf.saved.Inode == fileInode(fi) && tf.saved.Offset <= fi.Size() && !headChanged(tf.file, tf.saved.Head) {
+			tf.head = tf.saved.Head
+			return tf.saved.Offset
+		}
+		return 0
+	}
+	if c.startAtEnd {
+		return fi.Size()
+	}
+	return 0
+}
+
+// readLines processes complete lines from the current offset, a partial
+// line (no trailing newline) is left for the next collection. At most
+// maxReadBytes are read in a collection, returns true if the limit was
+// reached, the remaining lines are read in the next collection.
+func (c *LogTail) readLines(tf *tailedFile) (bool, error) {
+	if _, err := tf.file.Seek(tf.offset, io.SeekStart); err != nil {
+		return false, errors.Wrap(err, "seek")
+	}
+
+	read := int64(0)
+	r := bufio.NewReader(tf.file)
+	for {
+		if c.maxReadBytes > 0 && read >= c.maxReadBytes {
+			c.logger.Debug().Str("id", tf.id).Int64("offset", tf.offset).Msg("read limit reached, continuing next collection")
+			return true, nil
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, errors.Wrap(err, "read")
+		}
+		read += int64(len(line))
+		tf.offset += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+		for _, rl := range tf.rules {
+			if err := rl.process(line); err != nil {
+				c.logger.Debug().Err(err).Str("id", tf.id).Str("line", line).Msg("ignoring")
+			}
+		}
+	}
+}
+
+// recordHead keeps the first headSize bytes of the file which have been read,
+// used to detect a file which was truncated and written past the read offset
+func recordHead(tf *tailedFile) {
+	if len(tf.head) >= headSize || int64(len(tf.head)) >= tf.offset {
+		return
+	}
+	n := tf.offset
+	if n > headSize {
+		n = headSize
+	}
+	buf := make([]byte, n)
+	if _, err := tf.file.ReadAt(buf, 0); err != nil {
+		return
+	}
+	tf.head = buf
+}
+
+// headChanged returns true if the first bytes of the file differ from head
+func headChanged(f *os.File, head []byte) bool {
+	if len(head) == 0 {
+		return false
+	}
+	buf := make([]byte, len(head))
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return false
+	}
+	return !bytes.Equal(buf[:n], head)
+}
+
+// close the file handle
+func (tf *tailedFile) close() {
+	if tf.file != nil {
+		tf.file.Close()
+		tf.file = nil
+	}
+}
+
+// loadState reads the persisted read offsets
+func (c *LogTail) loadState() error {
+	if c.stateFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(c.stateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "reading state")
+	}
+
+	var state map[string]fileState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return errors.Wrap(err, "parsing state")
+	}
+
+	for _, tf := range c.files {
+		if fs, ok := state[tf.id]; ok {
+			s := fs
+			tf.saved = &s
+		}
+	}
+
+	return nil
+}
+
+// saveState persists the read offsets, written to a temporary file
+// and renamed so that a partially written state file is never read
+func (c *LogTail) saveState() error {
+	if c.stateFile == "" {
+		return nil
+	}
+
+	state := make(map[string]fileState, len(c.files))
+	for _, tf := range c.files {
+		if !tf.opened {
+			if tf.saved != nil {
+				state[tf.id] = *tf.saved // not opened yet, keep previous state
+			}
+			continue
+		}
+		state[tf.id] = fileState{Path: tf.path, Inode: tf.inode, Offset: tf.offset, Head: tf.head}
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "encoding state")
+	}
+
+	tmp := c.stateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrap(err, "writing state")
+	}
+
+	return errors.Wrap(os.Rename(tmp, c.stateFile), "writing state")
+}
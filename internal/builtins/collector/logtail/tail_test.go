@@ -0,0 +1,257 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package logtail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func newTestTail(t *testing.T, dir string, startAtEnd bool) (*LogTail, *tailedFile) {
+	r, err := newRule(RuleDef{Name: "errors", Pattern: `ERROR`})
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	tf := &tailedFile{id: "app", path: filepath.Join(dir, "app.log"), rules: []*rule{r}}
+	c := &LogTail{
+		files:      []*tailedFile{tf},
+		startAtEnd: startAtEnd,
+		stateFile:  filepath.Join(dir, stateFileName),
+	}
+	return c, tf
+}
+
+func appendLog(t *testing.T, file, data string) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	f.Close()
+}
+
+func TestTail(t *testing.T) {
+	t.Log("Testing tail")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir, err := ioutil.TempDir("", "logtail")
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, tf := newTestTail(t, dir, true)
+	defer tf.close()
+	errors := tf.rules[0]
+
+	t.Log("missing file")
+	{
+		if err := c.tail(tf); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if tf.opened {
+			t.Fatal("expected file to not be opened")
+		}
+	}
+
+	t.Log("start at end")
+	{
+		appendLog(t, tf.path, "ERROR before start\n")
+		if err := c.tail(tf); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if errors.counts[""] != 0 {
+			t.Fatalf("expected 0, got %d", errors.counts[""])
+		}
+	}
+
+	t.Log("appended lines, partial line")
+	{
+		appendLog(t, tf.path, "INFO ok\nERROR one\nERROR par")
+		if err := c.tail(tf); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if errors.counts[""] != 1 {
+			t.Fatalf("expected 1, got %d", errors.counts[""])
+		}
+		appendLog(t, tf.path, "tial\n")
+		if err := c.tail(tf); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if errors.counts[""] != 2 {
+			t.Fatalf("expected 2, got %d", errors.counts[""])
+		}
+	}
+
+	t.Log("copytruncate")
+	{
+		if err := os.Truncate(tf.path, 0); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		appendLog(t, tf.path, "ERROR after truncate\n")
+		if err := c.tail(tf); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if errors.counts[""] != 3 {
+			t.Fatalf("expected 3, got %d", errors.counts[""])
+		}
+	}
+
+	t.Log("copytruncate, written past the offset before the next collection")
+	{
+		if err := os.Truncate(tf.path, 0); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		appendLog(t, tf.path, "ERROR regrown one\nERROR regrown two\n")
+		if err := c.tail(tf); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if errors.counts[""] != 5 {
+			t.Fatalf("expected 5, got %d", errors.counts[""])
+		}
+	}
+
+	if runtime.GOOS != "windows" {
+		t.Log("rotation (rename, create)")
+		{
+			appendLog(t, tf.path, "ERROR before rotate\n")
+			if err := os.Rename(tf.path, tf.path+".1"); err != nil {
+				t.Fatalf("expected NO error, got (%s)", err)
+			}
+			appendLog(t, tf.path+".1", "ERROR written to rotated file\n")
+
+			t.Log("\tnew file not created yet")
+			if err := c.tail(tf); err != nil {
+				t.Fatalf("expected NO error, got (%s)", err)
+			}
+			if errors.counts[""] != 7 {
+				t.Fatalf("expected 7, got %d", errors.counts[""])
+			}
+
+			appendLog(t, tf.path, "ERROR new file\nERROR new file\n")
+			if err := c.tail(tf); err != nil {
+				t.Fatalf("expected NO error, got (%s)", err)
+			}
+			if errors.counts[""] != 9 {
+				t.Fatalf("expected 9, got %d", errors.counts[""])
+			}
+		}
+	}
+}
+
+func TestTailReadLimit(t *testing.T) {
+	t.Log("Testing tail read limit")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir, err := ioutil.TempDir("", "logtail")
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, tf := newTestTail(t, dir, false)
+	defer tf.close()
+	c.maxReadBytes = 20
+	errors := tf.rules[0]
+
+	appendLog(t, tf.path, "ERROR 1\nERROR 2\nERROR 3\nERROR 4\nERROR 5\n")
+
+	if err := c.tail(tf); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	if errors.counts[""] != 3 {
+		t.Fatalf("expected 3 (limit reached), got %d", errors.counts[""])
+	}
+
+	if err := c.tail(tf); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	if errors.counts[""] != 5 {
+		t.Fatalf("expected 5 (continued), got %d", errors.counts[""])
+	}
+}
+
+func TestState(t *testing.T) {
+	t.Log("Testing state")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir, err := ioutil.TempDir("", "logtail")
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, tf := newTestTail(t, dir, false)
+	appendLog(t, filepath.Join(dir, "app.log"), "ERROR one\n")
+
+	if err := c.tail(tf); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	if err := c.saveState(); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	tf.close()
+
+	appendLog(t, tf.path, "ERROR while stopped\n")
+
+	t.Log("resume from saved offset")
+	{
+		c2, tf2 := newTestTail(t, dir, true)
+		defer tf2.close()
+		if err := c2.loadState(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if tf2.saved == nil || tf2.saved.Offset != tf.offset {
+			t.Fatalf("expected saved offset %d, got %#v", tf.offset, tf2.saved)
+		}
+		if err := c2.tail(tf2); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if n := tf2.rules[0].counts[""]; n != 1 {
+			t.Fatalf("expected 1 (line written while stopped), got %d", n)
+		}
+	}
+
+	t.Log("truncated and rewritten while stopped")
+	{
+		c2, tf2 := newTestTail(t, dir, true)
+		defer tf2.close()
+		if err := c2.loadState(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if err := os.Truncate(tf.path, 0); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		appendLog(t, tf.path, "ERROR rewritten one\nERROR rewritten two\n")
+		if err := c2.tail(tf2); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if n := tf2.rules[0].counts[""]; n != 2 {
+			t.Fatalf("expected 2 (read from beginning), got %d", n)
+		}
+	}
+
+	t.Log("invalid state file")
+	{
+		if err := ioutil.WriteFile(c.stateFile, []byte("{"), 0644); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		c3, _ := newTestTail(t, dir, true)
+		if err := c3.loadState(); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package logtail
+
+import (
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/circonus-labs/circonusllhist"
+	"github.com/rs/zerolog"
+)
+
+// FileDef defines a log file to tail and the rules applied to each line
+type FileDef struct {
+	ID    string    `json:"id" toml:"id" yaml:"id"`
+	Path  string    `json:"path" toml:"path" yaml:"path"`
+	Rules []RuleDef `json:"rules" toml:"rules" yaml:"rules"`
+}
+
+// RuleDef defines a pattern and the metric produced from lines matching the pattern
+type RuleDef struct {
+	Name       string   `json:"name" toml:"name" yaml:"name"`                         // metric name
+	Pattern    string   `json:"pattern" toml:"pattern" yaml:"pattern"`                // regular expression, may contain %{NAME:capture} macros
+	Type       string   `json:"type" toml:"type" yaml:"type"`                         // counter, gauge or histogram
+	Value      string   `json:"value" toml:"value" yaml:"value"`                      // named capture with value (required for gauge and histogram)
+	Scale      float64  `json:"scale" toml:"scale" yaml:"scale"`                      // multiply captured value (e.g. 1000, seconds to milliseconds)
+	Tags       []string `json:"tags" toml:"tags" yaml:"tags"`                         // named captures to use as stream tags
+	MaxTagSets int      `json:"max_tag_sets" toml:"max_tag_sets" yaml:"max_tag_sets"` // maximum number of distinct tag sets (metric streams)
+}
+
+// LogTail defines log tailing collector
+type LogTail struct {
+	pkgID           string         // package prefix used for logging and errors
+	files           []*tailedFile  // log files being tailed
+	lastEnd         time.Time      // last collection end time
+	lastError       string         // last collection error
+	lastMetrics     cgm.Metrics    // last metrics collected
+	lastRunDuration time.Duration  // last collection duration
+	lastStart       time.Time      // last collection start time
+	logger          zerolog.Logger // collector logging instance
+	maxReadBytes    int64          // OPT maximum bytes read from a file in a collection
+	running         bool           // is collector currently running
+	runTTL          time.Duration  // OPT ttl for collector (default is for every request)
+	startAtEnd      bool           // OPT start reading new files (no saved offset) at the end
+	stateFile       string         // file where read offsets are persisted (empty, not persisted)
+	sync.Mutex
+}
+
+// logtailOptions defines what elements can be overridden in a config file
+type logtailOptions struct {
+	RunTTL        string    `json:"run_ttl" toml:"run_ttl" yaml:"run_ttl"`
+	StateDir      string    `json:"state_dir" toml:"state_dir" yaml:"state_dir"`
+	StartPosition string    `json:"start_position" toml:"start_position" yaml:"start_position"`
+	MaxReadBytes  int64     `json:"max_read_bytes" toml:"max_read_bytes" yaml:"max_read_bytes"`
+	Files         []FileDef `json:"files" toml:"files" yaml:"files"`
+}
+
+// tailedFile tracks the read position of a log file across collections
+type tailedFile struct {
+	id     string
+	path   string
+	rules  []*rule
+	file   *os.File // open handle, kept to drain the remainder of a rotated file
+	inode  uint64
+	offset int64
+	head   []byte // first bytes of the file, to detect truncation (see recordHead)
+	opened bool   // file has been opened at least once, initial position determined
+	saved  *fileState
+}
+
+// fileState defines the persisted read position of a log file
+type fileState struct {
+	Path   string `json:"path"`
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+	Head   []byte `json:"head,omitempty"`
+}
+
+// rule defines a compiled rule and the values accumulated for each tag set
+type rule struct {
+	name     string
+	rx       *regexp.Regexp
+	mtype    string
+	value    int   // index of value capture, -1 none
+	tags     []int // indexes of tag captures
+	tagNames []string
+	scale    float64
+	maxSets  int                                  // maximum number of tag sets, values for new tag sets are dropped beyond it
+	dropped  uint64                               // values dropped since last collection, maxSets reached
+	counts   map[string]uint64                    // counter (no value), lines matched
+	sums     map[string]float64                   // counter (value), sum of values
+	gauges   map[string]float64                   // gauge, last value
+	hists    map[string]*circonusllhist.Histogram // histogram, samples since last collection
+}
+
+const (
+	defaultMaxReadBytes = 10 * 1024 * 1024 // default maximum bytes read from a file in a collection
+	defaultMaxTagSets   = 1000             // default maximum number of tag sets of a rule
+	headSize            = 512              // bytes at the start of a file kept to detect truncation
+	metricNameSeparator = "`"              // character used to separate parts of metric names
+	ruleTypeCounter     = "counter"
+	ruleTypeGauge       = "gauge"
+	ruleTypeHistogram   = "histogram"
+	startPositionBegin  = "beginning"
+	startPositionEnd    = "end"
+	stateFileName       = "logtail_state.json"
+)
+
+var (
+	idRx   = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+	grokRx = regexp.MustCompile(`%\{([A-Z]+)(?::([a-zA-Z_][a-zA-Z0-9_]*))?\}`)
+
+	// grokPatterns common patterns available as %{NAME} or %{NAME:capture} in rule patterns
+	grokPatterns = map[string]string{
+		"DATA":         `.*?`,
+		"GREEDYDATA":   `.*`,
+		"HTTPDATE":     `\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+		"INT":          `[+-]?\d+`,
+		"IP":           `(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f]*:[0-9A-Fa-f:.]+`,
+		"NOTSPACE":     `\S+`,
+		"NUMBER":       `[+-]?(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][+-]?\d+)?`,
+		"QUOTEDSTRING": `"(?:[^"\\]|\\.)*"`,
+		"SPACE":        `\s*`,
+		"WORD":         `\w+`,
+	}
+
+	// tagValueCleaner removes characters with special meaning in stream tags
+	tagValueCleaner = regexp.MustCompile(`[:,|\s]`)
+)
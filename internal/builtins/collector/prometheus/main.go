@@ -188,7 +188,7 @@ func (c *Prom) fetchPromMetrics(u URLDef, metrics *cgm.Metrics) error {
 	req = req.WithContext(ctx)
 	defer cancel()
 
-	err = c.httpDoRequest(ctx, req, func(resp *http.Response, err error) error {
+	err = collector.HTTPDoRequest(ctx, req, func(resp *http.Response, err error) error {
 		if err != nil {
 			return err
 		}
@@ -201,21 +201,6 @@ func (c *Prom) fetchPromMetrics(u URLDef, metrics *cgm.Metrics) error {
 	return err
 }
 
-func (c *Prom) httpDoRequest(ctx context.Context, req *http.Request, respHandler func(*http.Response, error) error) error {
-	client := &http.Client{Transport: &http.Transport{DisableCompression: false, DisableKeepAlives: true, MaxIdleConnsPerHost: 1}}
-	ec := make(chan error, 1)
-
-	go func() { ec <- respHandler(client.Do(req)) }()
-
-	select {
-	case <-ctx.Done():
-		<-ec
-		return ctx.Err()
-	case err := <-ec:
-		return err
-	}
-}
-
 func (c *Prom) parse(id string, data io.ReadCloser, metrics *cgm.Metrics) error {
 	var parser expfmt.TextParser
 
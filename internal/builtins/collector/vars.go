@@ -37,4 +37,7 @@ var (
 
 	// ErrTTLNotExpired collector run ttl has not expired
 	ErrTTLNotExpired = errors.New("TTL not expired")
+
+	// ErrUnknownCollector collector name is not a builtin collector on this os
+	ErrUnknownCollector = errors.New("Unknown collector")
 )
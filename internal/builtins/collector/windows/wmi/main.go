@@ -15,6 +15,7 @@ import (
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
 	"github.com/circonus-labs/circonus-agent/internal/config"
 	"github.com/circonus-labs/circonus-agent/internal/config/defaults"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
@@ -31,9 +32,10 @@ func initialize() error {
 	return nil
 }
 
-// New creates new WMI collector
-func New() ([]collector.Collector, error) {
-	none := []collector.Collector{}
+// New creates new WMI collectors, for each builtin collector enabled in
+// the configuration, keyed by collector name
+func New() (map[string]collector.Collector, error) {
+	none := map[string]collector.Collector{}
 	l := log.With().Str("pkg", "builtins.wmi").Logger()
 
 	if runtime.GOOS != "windows" {
@@ -51,111 +53,57 @@ func New() ([]collector.Collector, error) {
 		return none, nil
 	}
 
-	logError := func(name string, err error) {
-		l.Error().
-			Str("name", name).
-			Err(err).
-			Msg("initializing builtin collector")
-	}
-
-	collectors := make([]collector.Collector, 0, len(enbledCollectors))
+	collectors := make(map[string]collector.Collector, len(enbledCollectors))
 	for _, name := range enbledCollectors {
-		cfgBase := name + "_collector"
-		switch name {
-		case "cache":
-			c, err := NewCacheCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "disk":
-			c, err := NewDiskCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "memory":
-			c, err := NewMemoryCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "interface":
-			c, err := NewNetInterfaceCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "ip":
-			c, err := NewNetIPCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "tcp":
-			c, err := NewNetTCPCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "udp":
-			c, err := NewNetUDPCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "objects":
-			c, err := NewObjectsCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "paging_file":
-			c, err := NewPagingFileCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		case "processes":
-			c, err := NewProcessesCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
+		c, err := NewCollector(name)
+		if err != nil {
+			if errors.Cause(err) == collector.ErrUnknownCollector {
+				l.Warn().
+					Str("name", name).
+					Msg("unknown builtin collector for this OS, ignoring")
+			} else {
+				l.Error().
+					Str("name", name).
+					Err(err).
+					Msg("initializing builtin collector")
 			}
-			collectors = append(collectors, c)
-
-		case "processor":
-			c, err := NewProcessorCollector(path.Join(defaults.EtcPath, cfgBase))
-			if err != nil {
-				logError(name, err)
-				continue
-			}
-			collectors = append(collectors, c)
-
-		default:
-			l.Warn().
-				Str("name", name).
-				Msg("unknown builtin collector for this OS, ignoring")
+			continue
 		}
+		collectors[name] = c
 	}
 
 	return collectors, nil
 }
+
+// NewCollector creates a WMI collector by name (e.g. processor), using the
+// collector config file (<name>_collector) in the agent etc path
+func NewCollector(name string) (collector.Collector, error) {
+	cfgBase := path.Join(defaults.EtcPath, name+"_collector")
+
+	switch name {
+	case "cache":
+		return NewCacheCollector(cfgBase)
+	case "disk":
+		return NewDiskCollector(cfgBase)
+	case "memory":
+		return NewMemoryCollector(cfgBase)
+	case "interface":
+		return NewNetInterfaceCollector(cfgBase)
+	case "ip":
+		return NewNetIPCollector(cfgBase)
+	case "tcp":
+		return NewNetTCPCollector(cfgBase)
+	case "udp":
+		return NewNetUDPCollector(cfgBase)
+	case "objects":
+		return NewObjectsCollector(cfgBase)
+	case "paging_file":
+		return NewPagingFileCollector(cfgBase)
+	case "processes":
+		return NewProcessesCollector(cfgBase)
+	case "processor":
+		return NewProcessorCollector(cfgBase)
+	default:
+		return nil, collector.ErrUnknownCollector
+	}
+}
@@ -8,6 +8,9 @@
 package builtins
 
 import (
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector/jsonhttp"
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector/logtail"
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector/prometheus"
 	appstats "github.com/maier/go-appstats"
 )
@@ -19,7 +22,38 @@ func (b *Builtins) configure() error {
 		b.logger.Warn().Err(err).Msg("prom collector, disabling")
 	} else {
 		b.collectors[prom.ID()] = prom
+		b.names[prom.ID()] = promCollectorName
+		appstats.MapIncrementInt("builtins", "total")
+	}
+	lt, err := logtail.New("")
+	if err != nil {
+		b.logger.Warn().Err(err).Msg("logtail collector, disabling")
+	} else {
+		b.collectors[lt.ID()] = lt
+		b.names[lt.ID()] = logtailCollectorName
+		appstats.MapIncrementInt("builtins", "total")
+	}
+	jh, err := jsonhttp.New("")
+	if err != nil {
+		b.logger.Warn().Err(err).Msg("json_http collector, disabling")
+	} else {
+		b.collectors[jh.ID()] = jh
+		b.names[jh.ID()] = jsonHTTPCollectorName
 		appstats.MapIncrementInt("builtins", "total")
 	}
 	return nil
 }
+
+// newCollector creates a builtin collector by name, used to reload a collector
+func (b *Builtins) newCollector(name string) (collector.Collector, error) {
+	if name == promCollectorName {
+		return prometheus.New("")
+	}
+	if name == logtailCollectorName {
+		return logtail.New("")
+	}
+	if name == jsonHTTPCollectorName {
+		return jsonhttp.New("")
+	}
+	return nil, collector.ErrUnknownCollector
+}
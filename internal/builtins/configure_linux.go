@@ -8,7 +8,10 @@
 package builtins
 
 import (
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector/jsonhttp"
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector/linux/procfs"
+	"github.com/circonus-labs/circonus-agent/internal/builtins/collector/logtail"
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector/prometheus"
 	appstats "github.com/maier/go-appstats"
 	"github.com/rs/zerolog/log"
@@ -22,10 +25,11 @@ func (b *Builtins) configure() error {
 	if err != nil {
 		return err
 	}
-	for _, c := range collectors {
+	for name, c := range collectors {
 		appstats.MapIncrementInt("builtins", "total")
 		b.logger.Info().Str("id", c.ID()).Msg("enabled builtin")
 		b.collectors[c.ID()] = c
+		b.names[c.ID()] = name
 	}
 	prom, err := prometheus.New("")
 	if err != nil {
@@ -33,6 +37,37 @@ func (b *Builtins) configure() error {
 	} else {
 		appstats.MapIncrementInt("builtins", "total")
 		b.collectors[prom.ID()] = prom
+		b.names[prom.ID()] = promCollectorName
+	}
+	lt, err := logtail.New("")
+	if err != nil {
+		b.logger.Warn().Err(err).Msg("logtail collector, disabling")
+	} else {
+		appstats.MapIncrementInt("builtins", "total")
+		b.collectors[lt.ID()] = lt
+		b.names[lt.ID()] = logtailCollectorName
+	}
+	jh, err := jsonhttp.New("")
+	if err != nil {
+		b.logger.Warn().Err(err).Msg("json_http collector, disabling")
+	} else {
+		appstats.MapIncrementInt("builtins", "total")
+		b.collectors[jh.ID()] = jh
+		b.names[jh.ID()] = jsonHTTPCollectorName
 	}
 	return nil
 }
+
+// newCollector creates a builtin collector by name, used to reload a collector
+func (b *Builtins) newCollector(name string) (collector.Collector, error) {
+	if name == promCollectorName {
+		return prometheus.New("")
+	}
+	if name == logtailCollectorName {
+		return logtail.New("")
+	}
+	if name == jsonHTTPCollectorName {
+		return jsonhttp.New("")
+	}
+	return procfs.NewCollector(name)
+}
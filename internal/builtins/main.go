@@ -7,21 +7,44 @@
 package builtins
 
 import (
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
 	cgm "github.com/circonus-labs/circonus-gometrics"
 	appstats "github.com/maier/go-appstats"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
 )
 
 // New creates a new builtins manager
 func New() (*Builtins, error) {
 	b := Builtins{
-		collectors: make(map[string]collector.Collector),
-		logger:     log.With().Str("pkg", "builtins").Logger(),
+		categories:   make(map[string]string),
+		categoryTags: viper.GetBool(config.KeyCollectorCategoryTags),
+		collectors:   make(map[string]collector.Collector),
+		disabled:     make(map[string]collector.Collector),
+		names:        make(map[string]string),
+		logger:       log.With().Str("pkg", "builtins").Logger(),
+	}
+
+	for name, category := range defaultCategories {
+		b.categories[name] = category
+	}
+
+	for _, entry := range viper.GetStringSlice(config.KeyCollectorCategories) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("Invalid collector category (%s), expected <collector>=<category>", entry)
+		}
+		if strings.ContainsAny(parts[1], idSeparator+tags.Delimiter+"[]`") {
+			return nil, errors.Errorf("Invalid collector category for %s (%s)", parts[0], parts[1])
+		}
+		b.categories[parts[0]] = parts[1] // empty category removes the collector from its default category
 	}
 
 	b.logger.Info().Msg("configuring builtins")
@@ -34,7 +57,9 @@ func New() (*Builtins, error) {
 	return &b, nil
 }
 
-// Run triggers internal collectors to gather metrics
+// Run triggers internal collectors to gather metrics. The id may be a single
+// collector id, a comma separated list of collector ids and/or categories
+// (e.g. cpu,collector:network) or blank for all collectors.
 func (b *Builtins) Run(id string) error {
 	b.Lock()
 
@@ -50,40 +75,30 @@ func (b *Builtins) Run(id string) error {
 	}
 
 	b.running = true
+
+	// collectors may be enabled, disabled or reloaded (admin api) while running
+	collectors := b.selectCollectors(id)
 	b.Unlock()
 
+	if len(collectors) == 0 {
+		b.logger.Warn().Str("id", id).Msg("unknown builtin")
+	}
+
 	start := time.Now()
 	appstats.MapSet("builtins", "last_start", start)
 
 	var wg sync.WaitGroup
 
-	if id == "" {
-		wg.Add(len(b.collectors))
-		for id, c := range b.collectors {
-			b.logger.Debug().Str("builtin", id).Msg("collecting")
-			go func(id string, c collector.Collector) {
-				err := c.Collect()
-				if err != nil {
-					b.logger.Error().Err(err).Msg(id)
-				}
-				wg.Done()
-			}(id, c)
-		}
-	} else {
-		c, ok := b.collectors[id]
-		if ok {
-			wg.Add(1)
-			b.logger.Debug().Str("builtin", id).Msg("collecting")
-			go func(id string, c collector.Collector) {
-				err := c.Collect()
-				if err != nil {
-					b.logger.Error().Err(err).Msg(id)
-				}
-				wg.Done()
-			}(id, c)
-		} else {
-			b.logger.Warn().Str("id", id).Msg("unknown builtin")
-		}
+	wg.Add(len(collectors))
+	for id, c := range collectors {
+		b.logger.Debug().Str("builtin", id).Msg("collecting")
+		go func(id string, c collector.Collector) {
+			err := c.Collect()
+			if err != nil {
+				b.logger.Error().Err(err).Msg(id)
+			}
+			wg.Done()
+		}(id, c)
 	}
 
 	wg.Wait()
@@ -100,7 +115,8 @@ func (b *Builtins) Run(id string) error {
 	return nil
 }
 
-// IsBuiltin determines if an id is a builtin or not
+// IsBuiltin determines if an id is a builtin or not, the id may also
+// be a category (e.g. collector:network) containing at least one builtin
 func (b *Builtins) IsBuiltin(id string) bool {
 	if id == "" {
 		return false
@@ -113,12 +129,11 @@ func (b *Builtins) IsBuiltin(id string) bool {
 		return false
 	}
 
-	_, ok := b.collectors[id]
-
-	return ok
+	return len(b.selectCollectors(id)) > 0
 }
 
-// Flush returns current metrics for all collectors
+// Flush returns current metrics for the collector(s) identified by id, see
+// Run for the id format. A blank id returns metrics for all collectors.
 func (b *Builtins) Flush(id string) *cgm.Metrics {
 	b.Lock()
 	defer b.Unlock()
@@ -131,11 +146,66 @@ func (b *Builtins) Flush(id string) *cgm.Metrics {
 		return &metrics // nothing to do
 	}
 
-	for _, c := range b.collectors {
+	for cid, c := range b.selectCollectors(id) {
+		tag := ""
+		if b.categoryTags {
+			if category := b.category(cid); category != "" {
+				tag = CategoryTag + tags.Delimiter + category
+			}
+		}
 		for name, val := range c.Flush() {
+			if tag != "" {
+				name = tags.AddStreamTag(name, tag)
+			}
 			metrics[name] = val
 		}
 	}
 
 	return &metrics
 }
+
+// selectCollectors returns the enabled collectors identified by id (blank
+// for all), caller must hold the lock
+func (b *Builtins) selectCollectors(id string) map[string]collector.Collector {
+	collectors := make(map[string]collector.Collector, len(b.collectors))
+
+	if id == "" {
+		for cid, c := range b.collectors {
+			collectors[cid] = c
+		}
+		return collectors
+	}
+
+	for _, item := range strings.Split(id, idSeparator) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.HasPrefix(item, CategoryTag+tags.Delimiter) {
+			category := strings.TrimPrefix(item, CategoryTag+tags.Delimiter)
+			if category == "" {
+				continue
+			}
+			for cid, c := range b.collectors {
+				if b.category(cid) == category {
+					collectors[cid] = c
+				}
+			}
+			continue
+		}
+		if c, ok := b.collectors[item]; ok {
+			collectors[item] = c
+		}
+	}
+
+	return collectors
+}
+
+// category returns the category of a collector, a category configured
+// for the collector id takes precedence over one for the collector name
+func (b *Builtins) category(id string) string {
+	if category, ok := b.categories[id]; ok {
+		return category
+	}
+	return b.categories[b.names[id]]
+}
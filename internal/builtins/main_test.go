@@ -11,8 +11,10 @@ import (
 	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
+	"github.com/circonus-labs/circonus-agent/internal/config"
 	cgm "github.com/circonus-labs/circonus-gometrics"
 	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
 )
 
 // fake collector stub
@@ -34,7 +36,7 @@ func (f *foo) Collect() error {
 	f.Lock()
 	defer f.Unlock()
 	f.lastStart = time.Now()
-	f.lastMetrics = cgm.Metrics{"bar": cgm.Metric{Type: "i", Value: 1}}
+	f.lastMetrics = cgm.Metrics{f.id + "`bar": cgm.Metric{Type: "i", Value: 1}}
 	f.lastEnd = time.Now()
 	f.lastRunDuration = time.Since(f.lastStart)
 	return nil
@@ -299,3 +301,111 @@ func TestFlush(t *testing.T) {
 		}
 	}
 }
+
+func TestFlushSelection(t *testing.T) {
+	t.Log("Testing Flush (selection)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	b, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	b.collectors = make(map[string]collector.Collector)
+	for _, id := range []string{"cpu", "if", "tcp"} {
+		b.collectors[id] = &foo{id: id}
+		b.names[id] = id
+	}
+
+	t.Log("single id")
+	{
+		if err := b.Run("cpu"); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if err := b.Run(""); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		metrics := b.Flush("cpu")
+		if len(*metrics) != 1 {
+			t.Fatalf("expected 1 metric, got %#v", *metrics)
+		}
+		if _, ok := (*metrics)["cpu`bar"]; !ok {
+			t.Fatalf("expected cpu`bar, got %#v", *metrics)
+		}
+	}
+
+	t.Log("multiple ids")
+	{
+		metrics := b.Flush("cpu,if,invalid")
+		if len(*metrics) != 2 {
+			t.Fatalf("expected 2 metrics, got %#v", *metrics)
+		}
+	}
+
+	t.Log("category")
+	{
+		if !b.IsBuiltin("collector:network") {
+			t.Fatal("expected collector:network to be a builtin")
+		}
+		if b.IsBuiltin("collector:invalid") {
+			t.Fatal("expected collector:invalid to not be a builtin")
+		}
+		metrics := b.Flush("collector:network")
+		if len(*metrics) != 2 {
+			t.Fatalf("expected 2 metrics, got %#v", *metrics)
+		}
+		if _, ok := (*metrics)["cpu`bar"]; ok {
+			t.Fatalf("expected no cpu metrics, got %#v", *metrics)
+		}
+	}
+
+	t.Log("category tags")
+	{
+		b.categoryTags = true
+		metrics := b.Flush("if,cpu")
+		for _, name := range []string{"if`bar|ST[collector:network]", "cpu`bar|ST[collector:cpu]"} {
+			if _, ok := (*metrics)[name]; !ok {
+				t.Fatalf("expected %s, got %#v", name, *metrics)
+			}
+		}
+	}
+}
+
+func TestCollectorCategories(t *testing.T) {
+	t.Log("Testing collector categories")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("invalid")
+	{
+		viper.Set(config.KeyCollectorCategories, []string{"if"})
+		if _, err := New(); err == nil {
+			t.Fatal("expected error")
+		}
+		viper.Set(config.KeyCollectorCategories, []string{"if=net:work"})
+		if _, err := New(); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("valid")
+	{
+		viper.Set(config.KeyCollectorCategories, []string{"if=interfaces", "foo=bar"})
+		b, err := New()
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		b.names["if"] = "if"
+		b.names["foo"] = "foo"
+		if c := b.category("if"); c != "interfaces" {
+			t.Fatalf("expected interfaces, got (%s)", c)
+		}
+		if c := b.category("foo"); c != "bar" {
+			t.Fatalf("expected bar, got (%s)", c)
+		}
+		if c := b.category("baz"); c != "" {
+			t.Fatalf("expected no category for unknown id, got (%s)", c)
+		}
+	}
+
+	viper.Set(config.KeyCollectorCategories, []string{})
+}
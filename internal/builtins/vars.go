@@ -6,6 +6,7 @@
 package builtins
 
 import (
+	"errors"
 	"sync"
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins/collector"
@@ -14,8 +15,74 @@ import (
 
 // Builtins defines the internal metric collector manager
 type Builtins struct {
-	collectors map[string]collector.Collector
-	logger     zerolog.Logger
-	running    bool
+	categories   map[string]string // category for each collector name (or id)
+	categoryTags bool              // add collector:<category> stream tag to metrics
+	collectors   map[string]collector.Collector
+	disabled     map[string]collector.Collector // collectors disabled at runtime (admin api)
+	names        map[string]string              // collector name (e.g. cpu) for each id, used to reload
+	logger       zerolog.Logger
+	running      bool
 	sync.Mutex
 }
+
+// CollectorState defines the state of a builtin collector, exposed via the admin api
+type CollectorState struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+	Enabled  bool   `json:"enabled"`
+}
+
+const (
+	promCollectorName     = "prometheus"
+	logtailCollectorName  = "logtail"
+	jsonHTTPCollectorName = "json_http"
+
+	// CategoryTag is the stream tag category used for builtin collector
+	// categories, also used to select collectors by category (e.g. collector:network)
+	CategoryTag = "collector"
+
+	// idSeparator separates multiple ids (and categories) in a selection
+	idSeparator = ","
+)
+
+// defaultCategories groups builtin collectors (by name) into logical categories
+var defaultCategories = map[string]string{
+	// procfs
+	"cgroup":     "process",
+	"cpu":        "cpu",
+	"diskstats":  "disk",
+	"fs":         "disk",
+	"hwmon":      "hardware",
+	"if":         "network",
+	"interrupts": "cpu",
+	"loadavg":    "cpu",
+	"mdraid":     "disk",
+	"nfs":        "disk",
+	"pressure":   "cpu",
+	"proc":       "process",
+	"schedstat":  "cpu",
+	"softirqs":   "cpu",
+	"tcp":        "network",
+	"vm":         "memory",
+	"zfs":        "disk",
+	// wmi
+	"cache":       "memory",
+	"disk":        "disk",
+	"interface":   "network",
+	"ip":          "network",
+	"memory":      "memory",
+	"objects":     "system",
+	"paging_file": "memory",
+	"processes":   "process",
+	"processor":   "cpu",
+	"udp":         "network",
+	// common
+	"json_http": "application",
+	"logtail":   "log",
+}
+
+var (
+	// ErrNotFound id is not a builtin collector
+	ErrNotFound = errors.New("builtin collector not found")
+)
@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"strings"
 
+	"github.com/circonus-labs/circonus-agent/internal/tags"
 	cgm "github.com/circonus-labs/circonus-gometrics"
 	"github.com/circonus-labs/circonus-gometrics/api"
 	"github.com/pkg/errors"
@@ -83,7 +84,11 @@ func (c *Check) configMetric(mn string, mv cgm.Metric) api.CheckBundleMetric {
 	mtype := "numeric" // default
 	switch mv.Type {
 	case "n":
-		vt := reflect.TypeOf(mv.Value).Kind().String()
+		val := mv.Value
+		if tv, ok := val.(tags.TimestampedValue); ok {
+			val = tv.Value
+		}
+		vt := reflect.TypeOf(val).Kind().String()
 		c.logger.Debug().Str("mn", mn).Interface("mv", mv).Str("reflect_type", vt).Msg("circ type n")
 		if vt == "slice" || vt == "array" {
 			mtype = "histogram"
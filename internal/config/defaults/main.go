@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/release"
 )
@@ -78,6 +79,32 @@ const (
 	// e.g. plugin_ttl30s.sh (30s ttl) plugin_ttl45.sh (would get default ttl units, e.g. 45s)
 	PluginTTLUnits = "s" // seconds
 
+	// PluginHistorySize defines the number of stderr lines and runs retained for each plugin
+	PluginHistorySize = 10
+
+	// PluginLivenessTimeout defines how long a supervised long running plugin may go
+	// without producing output before it is restarted (0s disables)
+	PluginLivenessTimeout = "0s"
+
+	// PluginMaxConcurrency defines the maximum number of plugins run at the same time (0 is unlimited)
+	PluginMaxConcurrency = 0
+
+	// PluginRecursive defines whether plugin subdirectories are scanned
+	PluginRecursive = false
+
+	// PluginStalePolicy defines what is returned for a plugin which has not
+	// produced new output (keep the previous metrics indefinitely)
+	PluginStalePolicy = "keep"
+
+	// PluginStderrLogLevel defines the level at which plugin stderr is forwarded to the agent log
+	PluginStderrLogLevel = "disabled"
+
+	// PluginTestLongRunningTimeout defines how long `plugin test` runs a long running plugin
+	PluginTestLongRunningTimeout = 10 * time.Second
+
+	// CollectorCategoryTags defines whether builtin collector metrics are tagged with their category
+	CollectorCategoryTags = false
+
 	// DisableGzip disables gzip compression on responses
 	DisableGzip = false
 
@@ -84,20 +84,32 @@ type StatsD struct {
 
 // Config defines the running config structure
 type Config struct {
-	API              API      `json:"api" yaml:"api" toml:"api"`
-	Check            Check    `json:"check" yaml:"check" toml:"check"`
-	Collectors       []string `json:"collectors" yaml:"collectors" toml:"collectors"`
-	Debug            bool     `json:"debug" yaml:"debug" toml:"debug"`
-	DebugCGM         bool     `mapstructure:"debug_cgm" json:"debug_cgm" yaml:"debug_cgm" toml:"debug_cgm"`
-	DebugDumpMetrics string   `mapstructure:"debug_dump_metrics" json:"debug_dump_metrics" yaml:"debug_dump_metrics" toml:"debug_dump_metrics"`
-	Listen           []string `json:"listen" yaml:"listen" toml:"listen"`
-	ListenSocket     []string `mapstructure:"listen_socket" json:"listen_socket" yaml:"listen_socket" toml:"listen_socket"`
-	Log              Log      `json:"log" yaml:"log" toml:"log"`
-	PluginDir        string   `mapstructure:"plugin_dir" json:"plugin_dir" yaml:"plugin_dir" toml:"plugin_dir"`
-	PluginTTLUnits   string   `mapstructure:"plugin_ttl_units" json:"plugin_ttl_units" yaml:"plugin_ttl_units" toml:"plugin_ttl_units"`
-	Reverse          Reverse  `json:"reverse" yaml:"reverse" toml:"reverse"`
-	SSL              SSL      `json:"ssl" yaml:"ssl" toml:"ssl"`
-	StatsD           StatsD   `json:"statsd" yaml:"statsd" toml:"statsd"`
+	AdminSocket           string   `mapstructure:"admin_socket" json:"admin_socket" yaml:"admin_socket" toml:"admin_socket"`
+	API                   API      `json:"api" yaml:"api" toml:"api"`
+	Check                 Check    `json:"check" yaml:"check" toml:"check"`
+	CollectorCategories   []string `mapstructure:"collector_categories" json:"collector_categories" yaml:"collector_categories" toml:"collector_categories"`
+	CollectorCategoryTags bool     `mapstructure:"collector_category_tags" json:"collector_category_tags" yaml:"collector_category_tags" toml:"collector_category_tags"`
+	Collectors            []string `json:"collectors" yaml:"collectors" toml:"collectors"`
+	Debug                 bool     `json:"debug" yaml:"debug" toml:"debug"`
+	DebugCGM              bool     `mapstructure:"debug_cgm" json:"debug_cgm" yaml:"debug_cgm" toml:"debug_cgm"`
+	DebugDumpMetrics      string   `mapstructure:"debug_dump_metrics" json:"debug_dump_metrics" yaml:"debug_dump_metrics" toml:"debug_dump_metrics"`
+	Listen                []string `json:"listen" yaml:"listen" toml:"listen"`
+	ListenSocket          []string `mapstructure:"listen_socket" json:"listen_socket" yaml:"listen_socket" toml:"listen_socket"`
+	Log                   Log      `json:"log" yaml:"log" toml:"log"`
+	PluginDir             string   `mapstructure:"plugin_dir" json:"plugin_dir" yaml:"plugin_dir" toml:"plugin_dir"`
+	PluginHistorySize     int      `mapstructure:"plugin_history_size" json:"plugin_history_size" yaml:"plugin_history_size" toml:"plugin_history_size"`
+	PluginLivenessTimeout string   `mapstructure:"plugin_liveness_timeout" json:"plugin_liveness_timeout" yaml:"plugin_liveness_timeout" toml:"plugin_liveness_timeout"`
+	PluginLongRunning     []string `mapstructure:"plugin_long_running" json:"plugin_long_running" yaml:"plugin_long_running" toml:"plugin_long_running"`
+	PluginMaxConcurrency  int      `mapstructure:"plugin_max_concurrency" json:"plugin_max_concurrency" yaml:"plugin_max_concurrency" toml:"plugin_max_concurrency"`
+	PluginPriorities      []string `mapstructure:"plugin_priorities" json:"plugin_priorities" yaml:"plugin_priorities" toml:"plugin_priorities"`
+	PluginRecursive       bool     `mapstructure:"plugin_recursive" json:"plugin_recursive" yaml:"plugin_recursive" toml:"plugin_recursive"`
+	PluginStalePolicies   []string `mapstructure:"plugin_stale_policies" json:"plugin_stale_policies" yaml:"plugin_stale_policies" toml:"plugin_stale_policies"`
+	PluginStalePolicy     string   `mapstructure:"plugin_stale_policy" json:"plugin_stale_policy" yaml:"plugin_stale_policy" toml:"plugin_stale_policy"`
+	PluginStderrLogLevel  string   `mapstructure:"plugin_stderr_log_level" json:"plugin_stderr_log_level" yaml:"plugin_stderr_log_level" toml:"plugin_stderr_log_level"`
+	PluginTTLUnits        string   `mapstructure:"plugin_ttl_units" json:"plugin_ttl_units" yaml:"plugin_ttl_units" toml:"plugin_ttl_units"`
+	Reverse               Reverse  `json:"reverse" yaml:"reverse" toml:"reverse"`
+	SSL                   SSL      `json:"ssl" yaml:"ssl" toml:"ssl"`
+	StatsD                StatsD   `json:"statsd" yaml:"statsd" toml:"statsd"`
 }
 
 type cosiCheckConfig struct {
@@ -108,6 +120,10 @@ type cosiCheckConfig struct {
 // NOTE: adding a Key* MUST be reflected in the Config structures above
 //
 const (
+	// KeyAdminSocket unix socket file to create for the admin api (list,
+	// enable, disable and reload builtin collectors and plugins)
+	KeyAdminSocket = "admin_socket"
+
 	// KeyAPICAFile custom ca for circonus api (e.g. inside)
 	KeyAPICAFile = "api.ca_file"
 
@@ -146,6 +162,33 @@ const (
 	// KeyPluginDir plugin directory
 	KeyPluginDir = "plugin_dir"
 
+	// KeyPluginHistorySize number of stderr lines and runs to keep for each plugin
+	KeyPluginHistorySize = "plugin_history_size"
+
+	// KeyPluginLivenessTimeout restart a supervised long running plugin if no output is received within this duration
+	KeyPluginLivenessTimeout = "plugin_liveness_timeout"
+
+	// KeyPluginLongRunning list of long running plugins to supervise
+	KeyPluginLongRunning = "plugin_long_running"
+
+	// KeyPluginMaxConcurrency maximum number of plugins to run at the same time (0 is unlimited)
+	KeyPluginMaxConcurrency = "plugin_max_concurrency"
+
+	// KeyPluginPriorities list of plugin run priorities (<plugin>=<priority>), higher priority plugins run first
+	KeyPluginPriorities = "plugin_priorities"
+
+	// KeyPluginRecursive scan plugin directory recursively, plugins in subdirectories are namespaced (e.g. mysql`replication)
+	KeyPluginRecursive = "plugin_recursive"
+
+	// KeyPluginStalePolicies list of per-plugin stale metric policies (<plugin>=<policy>)
+	KeyPluginStalePolicies = "plugin_stale_policies"
+
+	// KeyPluginStalePolicy default stale metric policy (keep, expire:<duration>, failures:<count>, null)
+	KeyPluginStalePolicy = "plugin_stale_policy"
+
+	// KeyPluginStderrLogLevel log level to forward plugin stderr to agent log (error, warn, info, debug, disabled)
+	KeyPluginStderrLogLevel = "plugin_stderr_log_level"
+
 	// KeyPluginTTLUnits plugin run ttl units
 	KeyPluginTTLUnits = "plugin_ttl_units"
 
@@ -203,6 +246,12 @@ const (
 	// KeyCollectors defines the builtin collectors to enable
 	KeyCollectors = "collectors"
 
+	// KeyCollectorCategories list of builtin collector categories (<collector>=<category>), overrides the default categories
+	KeyCollectorCategories = "collector_categories"
+
+	// KeyCollectorCategoryTags add a collector:<category> stream tag to builtin collector metrics
+	KeyCollectorCategoryTags = "collector_category_tags"
+
 	// KeyDisableGzip disables gzip on http responses
 	KeyDisableGzip = "server.disable_gzip"
 
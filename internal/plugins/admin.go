@@ -0,0 +1,167 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins"
+	"github.com/maier/go-appstats"
+	"github.com/pkg/errors"
+)
+
+// List returns the state of the active plugins (and plugin instances)
+func (p *Plugins) List() []PluginState {
+	p.RLock()
+	defer p.RUnlock()
+
+	states := make([]PluginState, 0, len(p.active))
+	for id, plug := range p.active {
+		states = append(states, PluginState{
+			ID:          id,
+			Name:        plug.id,
+			Instance:    plug.instanceID,
+			Enabled:     !p.isDisabled(id, plug),
+			LongRunning: plug.longRunning,
+		})
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].ID < states[j].ID })
+
+	return states
+}
+
+// Enable a plugin (or plugin instance) which was disabled
+func (p *Plugins) Enable(pluginName string) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.matchActive(pluginName) {
+		return errors.Wrap(ErrNotFound, pluginName)
+	}
+
+	delete(p.disabled, pluginName)
+	p.logger.Info().Str("plugin", pluginName).Msg("enabled plugin")
+
+	return nil
+}
+
+// Disable a plugin (or plugin instance), it will not be run and its metrics
+// will not be flushed until it is enabled again. A long running plugin
+// continues to run, its metrics are discarded.
+func (p *Plugins) Disable(pluginName string) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.matchActive(pluginName) {
+		return errors.Wrap(ErrNotFound, pluginName)
+	}
+
+	if p.disabled == nil {
+		p.disabled = make(map[string]bool)
+	}
+	p.disabled[pluginName] = true
+	p.logger.Info().Str("plugin", pluginName).Msg("disabled plugin")
+
+	return nil
+}
+
+// Reload a plugin, re-reading its config file (instances) and directory
+// defaults. The plugin directory is scanned again, new plugins found are
+// activated as well, the other active plugins are not changed. The reloaded
+// and new plugins are run once, in the background, as they are by Scan. Long
+// running plugins cannot be reloaded. If the scan fails, the plugin is left
+// as it was.
+func (p *Plugins) Reload(pluginName string, b *builtins.Builtins) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.pluginDir == "" {
+		return errors.Wrap(ErrNotFound, pluginName)
+	}
+
+	var ids []string
+	for id, plug := range p.active {
+		if id == pluginName || plug.id == pluginName {
+			if plug.longRunning {
+				return errors.Errorf("unable to reload long running plugin (%s), restart agent", pluginName)
+			}
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return errors.Wrap(ErrNotFound, pluginName)
+	}
+
+	removed := make(map[string]*plugin, len(ids))
+	for _, id := range ids {
+		removed[id] = p.active[id]
+		delete(p.active, id)
+		appstats.MapAddInt("plugins", "total", -1)
+	}
+
+	existing := make(map[string]bool, len(p.active))
+	for id := range p.active {
+		existing[id] = true
+	}
+
+	if err := p.scanPluginDirectory(b); err != nil {
+		// restore the active plugins as they were before the reload
+		for id := range p.active {
+			if !existing[id] {
+				delete(p.active, id)
+				appstats.MapAddInt("plugins", "total", -1)
+			}
+		}
+		for id, plug := range removed {
+			p.active[id] = plug
+			appstats.MapIncrementInt("plugins", "total")
+		}
+		return errors.Wrap(err, "plugin directory scan")
+	}
+
+	// new plugins are run once (like Scan), so they have metrics
+	// and their stale policy applies before the next /run
+	var plugs []*plugin
+	for id, plug := range p.active {
+		if existing[id] {
+			continue
+		}
+		p.logger.Info().Str("plugin", id).Msg("reloaded plugin")
+		if plug.longRunning {
+			go plug.supervise()
+			continue
+		}
+		plugs = append(plugs, plug)
+	}
+	go p.runQueue(plugs)
+
+	return nil
+}
+
+// matchActive determines if a plugin name matches an active plugin (or
+// plugin instance), caller must hold the lock
+func (p *Plugins) matchActive(pluginName string) bool {
+	if pluginName == "" {
+		return false
+	}
+	for id := range p.active {
+		if id == pluginName || strings.HasPrefix(id, pluginName+metricDelimiter) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDisabled determines if a plugin (or the plugin of an instance) was
+// disabled, caller must hold the lock
+func (p *Plugins) isDisabled(id string, plug *plugin) bool {
+	if len(p.disabled) == 0 {
+		return false
+	}
+	return p.disabled[id] || p.disabled[plug.id]
+}
@@ -0,0 +1,202 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestAdmin(t *testing.T) {
+	t.Log("Testing admin (List/Enable/Disable)")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPluginDir, "testdata")
+
+	p, nerr := New(context.Background())
+	if nerr != nil {
+		t.Fatalf("new err %s", nerr)
+	}
+
+	p.active["foo"] = &plugin{id: "foo", metrics: &cgm.Metrics{"m": cgm.Metric{Type: "i", Value: 1}}}
+	p.active["bar`a"] = &plugin{id: "bar", instanceID: "a", metrics: &cgm.Metrics{"m": cgm.Metric{Type: "i", Value: 1}}}
+	p.active["bar`b"] = &plugin{id: "bar", instanceID: "b", metrics: &cgm.Metrics{"m": cgm.Metric{Type: "i", Value: 1}}}
+
+	t.Log("list")
+	{
+		states := p.List()
+		if len(states) != 3 {
+			t.Fatalf("expected 3 plugins, got %#v", states)
+		}
+		for _, s := range states {
+			if !s.Enabled {
+				t.Fatalf("expected enabled, got %#v", s)
+			}
+		}
+	}
+
+	t.Log("not found")
+	{
+		if err := p.Disable("baz"); errors.Cause(err) != ErrNotFound {
+			t.Fatalf("expected (%s) got (%v)", ErrNotFound, err)
+		}
+		if err := p.Enable("baz"); errors.Cause(err) != ErrNotFound {
+			t.Fatalf("expected (%s) got (%v)", ErrNotFound, err)
+		}
+	}
+
+	t.Log("disable plugin w/instances")
+	{
+		if err := p.Disable("bar"); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		for _, s := range p.List() {
+			if s.Name == "bar" && s.Enabled {
+				t.Fatalf("expected disabled, got %#v", s)
+			}
+			if s.Name == "foo" && !s.Enabled {
+				t.Fatalf("expected enabled, got %#v", s)
+			}
+		}
+		metrics := p.Flush("")
+		if _, ok := (*metrics)["bar`a`m"]; ok {
+			t.Fatalf("expected no metrics for disabled plugin, got %#v", *metrics)
+		}
+		if _, ok := (*metrics)["foo`m"]; !ok {
+			t.Fatalf("expected metrics for foo, got %#v", *metrics)
+		}
+	}
+
+	t.Log("enable plugin w/instances")
+	{
+		if err := p.Enable("bar"); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		for _, s := range p.List() {
+			if !s.Enabled {
+				t.Fatalf("expected enabled, got %#v", s)
+			}
+		}
+	}
+}
+
+func TestAdminReload(t *testing.T) {
+	t.Log("Testing admin (Reload)")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPluginDir, "testdata")
+
+	p, nerr := New(context.Background())
+	if nerr != nil {
+		t.Fatalf("new err %s", nerr)
+	}
+
+	b, berr := builtins.New()
+	if berr != nil {
+		t.Fatalf("expected NO error, got (%s)", berr)
+	}
+
+	if err := p.Scan(b); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	t.Log("not found")
+	{
+		if err := p.Reload("baz", b); errors.Cause(err) != ErrNotFound {
+			t.Fatalf("expected (%s) got (%v)", ErrNotFound, err)
+		}
+	}
+
+	t.Log("valid")
+	{
+		before := len(p.List())
+		p.RLock()
+		others := make(map[string]*plugin)
+		for id, plug := range p.active {
+			if plug.id != "goodcfg" {
+				others[id] = plug
+			}
+		}
+		p.RUnlock()
+		if err := p.Reload("goodcfg", b); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !p.IsValid("goodcfg") {
+			t.Fatal("expected goodcfg to be active after reload")
+		}
+		if after := len(p.List()); after != before {
+			t.Fatalf("expected %d plugins after reload, got %d", before, after)
+		}
+		p.RLock()
+		for id, plug := range others {
+			if p.active[id] != plug {
+				t.Fatalf("expected %s to be left untouched by reload", id)
+			}
+		}
+		var reloaded []*plugin
+		for _, plug := range p.active {
+			if plug.id == "goodcfg" {
+				reloaded = append(reloaded, plug)
+			}
+		}
+		p.RUnlock()
+		// reloaded plugins are run once in the background
+		for _, plug := range reloaded {
+			ran := false
+			for i := 0; i < 50 && !ran; i++ {
+				plug.Lock()
+				ran = !plug.lastEnd.IsZero()
+				plug.Unlock()
+				if !ran {
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+			if !ran {
+				t.Fatalf("expected %s to run after reload", plug.name)
+			}
+		}
+	}
+
+	t.Log("scan error")
+	{
+		before := len(p.List())
+		p.RLock()
+		prev := make(map[string]*plugin)
+		for id, plug := range p.active {
+			if plug.id == "goodcfg" {
+				prev[id] = plug
+			}
+		}
+		p.RUnlock()
+
+		p.Lock()
+		p.pluginDir = "testdata/missing"
+		p.Unlock()
+		if err := p.Reload("goodcfg", b); err == nil {
+			t.Fatal("expected error")
+		}
+		if after := len(p.List()); after != before {
+			t.Fatalf("expected %d plugins after failed reload, got %d", before, after)
+		}
+		p.RLock()
+		for id, plug := range prev {
+			if p.active[id] != plug {
+				t.Fatalf("expected %s to be restored after failed reload", id)
+			}
+		}
+		p.RUnlock()
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+// stderrWriter receives stderr from a running plugin, splits it into
+// lines and records each complete line in the plugin's stderr history
+type stderrWriter struct {
+	plugin  *plugin
+	partial bytes.Buffer
+}
+
+// Write records complete lines, any partial line is held until
+// more output arrives or the writer is flushed
+func (w *stderrWriter) Write(b []byte) (int, error) {
+	w.partial.Write(b)
+	for {
+		data := w.partial.Bytes()
+		idx := bytes.IndexByte(data, '\n')
+		if idx == -1 {
+			break
+		}
+		line := string(data[:idx])
+		w.partial.Next(idx + 1)
+		w.plugin.recordStderr(line)
+	}
+	return len(b), nil
+}
+
+// flush records any remaining partial line
+func (w *stderrWriter) flush() {
+	if w.partial.Len() > 0 {
+		w.plugin.recordStderr(w.partial.String())
+		w.partial.Reset()
+	}
+}
+
+// recordStderr adds a line of stderr output to the plugin's history
+// and, optionally, forwards it to the agent log
+func (p *plugin) recordStderr(line string) {
+	line = strings.TrimRight(line, "\r")
+	if line == "" {
+		return
+	}
+
+	switch p.stderrLogLevel {
+	case "error":
+		p.logger.Error().Str("stderr", line).Msg("plugin stderr")
+	case "warn":
+		p.logger.Warn().Str("stderr", line).Msg("plugin stderr")
+	case "info":
+		p.logger.Info().Str("stderr", line).Msg("plugin stderr")
+	case "debug":
+		p.logger.Debug().Str("stderr", line).Msg("plugin stderr")
+	}
+
+	if p.historySize <= 0 {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.stderrHistory = append(p.stderrHistory, line)
+	if len(p.stderrHistory) > p.historySize {
+		p.stderrHistory = p.stderrHistory[len(p.stderrHistory)-p.historySize:]
+	}
+}
+
+// recordRun adds the details of a completed run to the plugin's history.
+// note: caller must hold the plugin lock
+func (p *plugin) recordRun(start time.Time, duration time.Duration, exitCode int, err error) {
+	if p.historySize <= 0 {
+		return
+	}
+
+	run := pluginRun{
+		Start:         start.Format(time.RFC3339Nano),
+		Duration:      duration.String(),
+		ExitCode:      exitCode,
+		LinesParsed:   p.runStats.linesParsed,
+		MetricsParsed: p.runStats.metricsParsed,
+		ParseErrors:   p.runStats.parseErrors,
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	p.runHistory = append(p.runHistory, run)
+	if len(p.runHistory) > p.historySize {
+		p.runHistory = p.runHistory[len(p.runHistory)-p.historySize:]
+	}
+}
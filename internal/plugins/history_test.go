@@ -0,0 +1,116 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestStderrWriter(t *testing.T) {
+	t.Log("Testing stderrWriter")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("history disabled")
+	{
+		p := &plugin{id: "test", name: "test"}
+		w := &stderrWriter{plugin: p}
+		w.Write([]byte("foo\nbar\n"))
+		w.flush()
+		if len(p.stderrHistory) != 0 {
+			t.Fatalf("expected 0 lines, got (%#v)", p.stderrHistory)
+		}
+	}
+
+	t.Log("partial lines")
+	{
+		p := &plugin{id: "test", name: "test", historySize: 5}
+		w := &stderrWriter{plugin: p}
+		w.Write([]byte("fo"))
+		w.Write([]byte("o\nba"))
+		if len(p.stderrHistory) != 1 {
+			t.Fatalf("expected 1 line, got (%#v)", p.stderrHistory)
+		}
+		w.Write([]byte("r\n\nbaz"))
+		w.flush()
+		expect := []string{"foo", "bar", "baz"}
+		if len(p.stderrHistory) != len(expect) {
+			t.Fatalf("expected (%#v) got (%#v)", expect, p.stderrHistory)
+		}
+		for i, line := range expect {
+			if p.stderrHistory[i] != line {
+				t.Fatalf("expected (%#v) got (%#v)", expect, p.stderrHistory)
+			}
+		}
+	}
+
+	t.Log("bounded")
+	{
+		p := &plugin{id: "test", name: "test", historySize: 2, stderrLogLevel: "debug"}
+		w := &stderrWriter{plugin: p}
+		w.Write([]byte("1\n2\n3\n4\n"))
+		expect := []string{"3", "4"}
+		if len(p.stderrHistory) != len(expect) {
+			t.Fatalf("expected (%#v) got (%#v)", expect, p.stderrHistory)
+		}
+		for i, line := range expect {
+			if p.stderrHistory[i] != line {
+				t.Fatalf("expected (%#v) got (%#v)", expect, p.stderrHistory)
+			}
+		}
+	}
+}
+
+func TestRecordRun(t *testing.T) {
+	t.Log("Testing recordRun")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("history disabled")
+	{
+		p := &plugin{id: "test", name: "test"}
+		p.recordRun(time.Now(), time.Second, 0, nil)
+		if len(p.runHistory) != 0 {
+			t.Fatalf("expected 0 runs, got (%#v)", p.runHistory)
+		}
+	}
+
+	t.Log("bounded")
+	{
+		p := &plugin{id: "test", name: "test", historySize: 2}
+		for i := 0; i < 3; i++ {
+			p.runStats.linesParsed = i
+			p.recordRun(time.Now(), time.Second, i, nil)
+		}
+		if len(p.runHistory) != 2 {
+			t.Fatalf("expected 2 runs, got (%#v)", p.runHistory)
+		}
+		if p.runHistory[0].ExitCode != 1 || p.runHistory[1].ExitCode != 2 {
+			t.Fatalf("expected oldest run dropped, got (%#v)", p.runHistory)
+		}
+	}
+
+	t.Log("w/error")
+	{
+		p := &plugin{id: "test", name: "test", historySize: 2}
+		p.runStats = runStats{linesParsed: 3, metricsParsed: 2, parseErrors: 1}
+		p.recordRun(time.Now(), time.Second, 1, errors.New("foo"))
+		if len(p.runHistory) != 1 {
+			t.Fatalf("expected 1 run, got (%#v)", p.runHistory)
+		}
+		run := p.runHistory[0]
+		if run.Error != "foo" {
+			t.Fatalf("expected (foo) got (%s)", run.Error)
+		}
+		if run.LinesParsed != 3 || run.MetricsParsed != 2 || run.ParseErrors != 1 {
+			t.Fatalf("unexpected run stats (%#v)", run)
+		}
+	}
+}
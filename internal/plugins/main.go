@@ -10,8 +10,8 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/config"
@@ -25,11 +25,70 @@ import (
 // New returns a new instance of the plugins manager
 func New(ctx context.Context) (*Plugins, error) {
 	p := Plugins{
-		ctx:           ctx,
-		running:       false,
-		logger:        log.With().Str("pkg", "plugins").Logger(),
-		reservedNames: map[string]bool{"prom": true, "write": true, "statsd": true},
-		active:        make(map[string]*plugin),
+		ctx:            ctx,
+		running:        false,
+		logger:         log.With().Str("pkg", "plugins").Logger(),
+		reservedNames:  map[string]bool{"prom": true, "write": true, "statsd": true},
+		active:         make(map[string]*plugin),
+		disabled:       make(map[string]bool),
+		historySize:    viper.GetInt(config.KeyPluginHistorySize),
+		longRunning:    make(map[string]bool),
+		recursive:      viper.GetBool(config.KeyPluginRecursive),
+		stalePolicies:  make(map[string]stalePolicy),
+		maxConcurrency: viper.GetInt(config.KeyPluginMaxConcurrency),
+		priorities:     make(map[string]int),
+	}
+
+	for _, entry := range viper.GetStringSlice(config.KeyPluginPriorities) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("Invalid plugin priority (%s), expected <plugin>=<priority>", entry)
+		}
+		priority, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid plugin priority for %s", parts[0])
+		}
+		p.priorities[parts[0]] = priority
+	}
+
+	sp, err := parseStalePolicy(viper.GetString(config.KeyPluginStalePolicy))
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid plugin stale policy")
+	}
+	p.stalePolicy = sp
+
+	for _, entry := range viper.GetStringSlice(config.KeyPluginStalePolicies) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("Invalid plugin stale policy (%s), expected <plugin>=<policy>", entry)
+		}
+		sp, err := parseStalePolicy(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid plugin stale policy for %s", parts[0])
+		}
+		p.stalePolicies[parts[0]] = sp
+	}
+
+	for _, name := range viper.GetStringSlice(config.KeyPluginLongRunning) {
+		p.longRunning[name] = true
+	}
+
+	if timeout := viper.GetString(config.KeyPluginLivenessTimeout); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid plugin liveness timeout")
+		}
+		p.livenessTimeout = d
+	}
+
+	stderrLogLevel := viper.GetString(config.KeyPluginStderrLogLevel)
+	switch stderrLogLevel {
+	case "", "disabled":
+		p.stderrLogLevel = ""
+	case "error", "warn", "info", "debug":
+		p.stderrLogLevel = stderrLogLevel
+	default:
+		return nil, errors.Errorf("Invalid plugin stderr log level (%s)", stderrLogLevel)
 	}
 
 	errMsg := "Invalid plugin directory"
@@ -74,7 +133,7 @@ func New(ctx context.Context) (*Plugins, error) {
 	return &p, nil
 }
 
-// Flush plugin metrics
+// Flush plugin metrics, see Run for the pluginName format
 func (p *Plugins) Flush(pluginName string) *cgm.Metrics {
 	p.RLock()
 	defer p.RUnlock()
@@ -82,16 +141,22 @@ func (p *Plugins) Flush(pluginName string) *cgm.Metrics {
 	appstats.MapSet("plugins", "last_flush", time.Now())
 
 	metrics := cgm.Metrics{}
+	names := splitPluginNames(pluginName)
 
 	for pluginID, plug := range p.active {
-		if pluginName == "" || // all plugins
-			pluginID == pluginName || // specific plugin
-			strings.HasPrefix(pluginID, pluginName+metricDelimiter) { // specific plugin with instances
+		if p.isDisabled(pluginID, plug) {
+			continue
+		}
+		if len(names) == 0 || matchPluginName(pluginID, names) != "" {
 
 			m := plug.drain()
 			for mn, mv := range *m {
 				metrics[pluginID+metricDelimiter+mn] = mv
 			}
+
+			for mn, mv := range plug.selfMetrics() {
+				metrics[selfMetricsPrefix+pluginID+metricDelimiter+mn] = mv
+			}
 		}
 	}
 
@@ -104,7 +169,9 @@ func (p *Plugins) Stop() error {
 	return nil
 }
 
-// Run one or all plugins
+// Run plugins concurrently. The pluginName may be a single plugin, a comma
+// separated list of plugins or blank for all plugins. Unknown plugins in a
+// list are logged, an error is returned only if none of them are known.
 func (p *Plugins) Run(pluginName string) error {
 	p.Lock()
 
@@ -119,41 +186,54 @@ func (p *Plugins) Run(pluginName string) error {
 	appstats.MapSet("plugins", "last_run_start", start)
 
 	p.running = true
-	p.Unlock()
 
-	var wg sync.WaitGroup
+	// plugins may be disabled or reloaded (admin api), select
+	// the plugins to run while holding the lock
+	var plugs []*plugin
 
-	if pluginName != "" {
-		numFound := 0
+	if names := splitPluginNames(pluginName); len(names) > 0 {
+		found := make(map[string]bool, len(names))
 		for pluginID, pluginRef := range p.active {
-			if pluginID == pluginName || // specific plugin
-				strings.HasPrefix(pluginID, pluginName+"`") { // specific plugin with instances
-				numFound++
-				wg.Add(1)
-				go func(id string, plug *plugin) {
-					plug.exec()
-					wg.Done()
-				}(pluginID, pluginRef)
+			name := matchPluginName(pluginID, names)
+			if name == "" {
+				continue
+			}
+			found[name] = true
+			if pluginRef.longRunning {
+				continue // started and restarted by supervise
+			}
+			if p.isDisabled(pluginID, pluginRef) {
+				continue
+			}
+			plugs = append(plugs, pluginRef)
+		}
+		for _, name := range names {
+			if !found[name] {
+				p.logger.Error().
+					Str("plugin", name).
+					Msg("Invalid/Unknown")
 			}
 		}
-		if numFound == 0 {
-			p.logger.Error().
-				Str("plugin", pluginName).
-				Msg("Invalid/Unknown")
+		if len(found) == 0 {
 			p.running = false
+			p.Unlock()
 			return errors.Errorf("invalid plugin (%s)", pluginName)
 		}
 	} else {
 		for pluginID, pluginRef := range p.active {
-			wg.Add(1)
-			go func(id string, plug *plugin) {
-				plug.exec()
-				wg.Done()
-			}(pluginID, pluginRef)
+			if pluginRef.longRunning {
+				continue // started and restarted by supervise
+			}
+			if p.isDisabled(pluginID, pluginRef) {
+				continue
+			}
+			plugs = append(plugs, pluginRef)
 		}
 	}
 
-	wg.Wait()
+	p.Unlock()
+
+	p.runQueue(plugs)
 
 	appstats.MapSet("plugins", "last_run_end", time.Now())
 	appstats.MapSet("plugins", "last_run_duration", time.Since(start))
@@ -185,6 +265,30 @@ func (p *Plugins) IsValid(pluginName string) bool {
 	return false
 }
 
+// splitPluginNames splits a comma separated list of plugin names, returns
+// an empty list for a blank pluginName (all plugins)
+func splitPluginNames(pluginName string) []string {
+	var names []string
+	for _, name := range strings.Split(pluginName, pluginNameSeparator) {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// matchPluginName returns the first name identifying the plugin, either the
+// specific plugin or a plugin with instances, blank if none of them do
+func matchPluginName(pluginID string, names []string) string {
+	for _, name := range names {
+		if pluginID == name || strings.HasPrefix(pluginID, name+metricDelimiter) {
+			return name
+		}
+	}
+	return ""
+}
+
 // IsInternal checks to see if the plugin is one of the internal plugins (write|statsd)
 func (p *Plugins) IsInternal(pluginName string) bool {
 	if pluginName == "" {
@@ -195,12 +299,20 @@ func (p *Plugins) IsInternal(pluginName string) bool {
 	return reserved
 }
 
-// Inventory returns list of active plugins
-func (p *Plugins) Inventory() []byte {
+// Inventory returns list of active plugins. If a plugin name is specified,
+// only that plugin (and its instances) are returned, including the recent
+// stderr output and run history for each.
+func (p *Plugins) Inventory(pluginName string) []byte {
 	p.Lock()
 	defer p.Unlock()
 	inventory := make(map[string]*pluginDetails, len(p.active))
 	for id, plug := range p.active {
+		if pluginName != "" &&
+			id != pluginName && // specific plugin
+			!strings.HasPrefix(id, pluginName+metricDelimiter) { // specific plugin with instances
+			continue
+		}
+
 		plug.Lock()
 		inventory[id] = &pluginDetails{
 			Name:            plug.id,
@@ -210,12 +322,33 @@ func (p *Plugins) Inventory() []byte {
 			LastRunStart:    plug.lastStart.Format(time.RFC3339Nano),
 			LastRunEnd:      plug.lastEnd.Format(time.RFC3339Nano),
 			LastRunDuration: plug.lastRunDuration.String(),
+			User:            plug.runUser,
+			StalePolicy:     plug.stalePolicy.String(),
+			Stale:           plug.stale,
+			Priority:        plug.priority,
+			LastQueueWait:   plug.lastQueueWait.String(),
+			Disabled:        p.isDisabled(id, plug),
+		}
+
+		if plug.timeout > 0 {
+			inventory[id].Timeout = plug.timeout.String()
 		}
 
 		if plug.lastError != nil {
 			inventory[id].LastError = plug.lastError.Error()
 		}
 
+		if plug.longRunning {
+			inventory[id].LongRunning = true
+			inventory[id].Restarts = plug.restarts
+			inventory[id].LastExitReason = plug.lastExitReason
+		}
+
+		if pluginName != "" {
+			inventory[id].Runs = append([]pluginRun{}, plug.runHistory...)
+			inventory[id].Stderr = append([]string{}, plug.stderrHistory...)
+		}
+
 		plug.Unlock()
 	}
 	data, err := json.Marshal(inventory)
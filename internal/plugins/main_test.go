@@ -11,6 +11,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -128,6 +129,30 @@ func TestRun(t *testing.T) {
 			t.Fatalf("expected NO error, got (%s)", err)
 		}
 	}
+
+	t.Log("Valid (list)")
+	{
+		err := p.Run("test,error")
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("Valid (list, with unknown plugin)")
+	{
+		err := p.Run("test,invalid")
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("Invalid (list, all unknown plugins)")
+	{
+		err := p.Run("invalid,foo")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
 }
 
 func TestFlush(t *testing.T) {
@@ -197,6 +222,30 @@ func TestFlush(t *testing.T) {
 			t.Fatalf("expected value 22.1 got %#v", mv)
 		}
 	}
+
+	t.Log("Valid (list)")
+	{
+		id := "test"
+		if runtime.GOOS == "windows" {
+			id = "testwin"
+		}
+		if err := p.Run(id + ",invalid"); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		data := p.Flush(id + ",invalid")
+		if data == nil {
+			t.Fatal("expected not nil")
+		}
+		name := id + metricDelimiter + "metric"
+		if _, ok := (*data)[name]; !ok {
+			t.Fatalf("expected metric named (%s) got (%#v)", name, *data)
+		}
+		for mn := range *data {
+			if !strings.HasPrefix(mn, id+metricDelimiter) && !strings.HasPrefix(mn, selfMetricsPrefix+id+metricDelimiter) {
+				t.Fatalf("unexpected metric (%s)", mn)
+			}
+		}
+	}
 }
 
 func TestIsValid(t *testing.T) {
@@ -306,6 +355,7 @@ func TestInventory(t *testing.T) {
 	zerolog.SetGlobalLevel(zerolog.Disabled)
 
 	viper.Set(config.KeyPluginDir, "testdata")
+	viper.Set(config.KeyPluginHistorySize, 10)
 
 	p, nerr := New(context.Background())
 	if nerr != nil {
@@ -319,13 +369,14 @@ func TestInventory(t *testing.T) {
 
 	p.pluginDir = "testdata" // set it back to relative so absolute path does not make test fail below
 
-	if err := p.Scan(b); err != nil {
+	// scan without the (asynchronous) initial run of Scan, plugins are run below
+	if err := p.scanPluginDirectory(b); err != nil {
 		t.Fatalf("expected no error, got %s", err)
 	}
 
 	t.Log("Valid")
 	{
-		data := p.Inventory()
+		data := p.Inventory("")
 		if data == nil {
 			t.Fatalf("expected not nil")
 		}
@@ -335,4 +386,21 @@ func TestInventory(t *testing.T) {
 			t.Fatalf("expected (%s) got (%s)", string(expect), string(data))
 		}
 	}
+
+	t.Log("Valid, specific plugin")
+	{
+		if err := p.Run("test"); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+
+		data := p.Inventory("test")
+		if data == nil {
+			t.Fatalf("expected not nil")
+		}
+
+		expect := []byte(`"runs":[{"start":"`)
+		if !bytes.Contains(data, expect) {
+			t.Fatalf("expected (%s) got (%s)", string(expect), string(data))
+		}
+	}
 }
@@ -10,14 +10,17 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/tags"
 	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/circonus-labs/circonusllhist"
 	"github.com/pkg/errors"
 )
 
@@ -26,20 +29,23 @@ func (p *plugin) drain() *cgm.Metrics {
 	p.Lock()
 	defer p.Unlock()
 
-	var metrics *cgm.Metrics
-	if p.metrics == nil {
-		if p.prevMetrics == nil {
-			metrics = &cgm.Metrics{}
-		} else {
-			metrics = p.prevMetrics
+	fresh := p.metrics != nil
+	if fresh {
+		// a failed run which produced no metrics (e.g. no output) does
+		// not replace the previous metrics, the stale policy decides
+		// what is returned for them
+		if len(*p.metrics) > 0 || !p.lastRunFailed() {
+			p.prevMetrics = p.metrics
 		}
-	} else {
-		metrics = p.metrics
 		p.metrics = nil
-		p.prevMetrics = metrics
 	}
 
-	return metrics
+	if !fresh || p.lastRunFailed() {
+		return p.staleMetrics()
+	}
+
+	p.stale = false
+	return p.prevMetrics
 }
 
 // parsePluginOutput handles json and tab delimited output from plugins.
@@ -57,6 +63,8 @@ func (p *plugin) parsePluginOutput(output []string) error {
 		return errors.Errorf("Zero lines of output")
 	}
 
+	p.runStats.linesParsed += len(output)
+
 	metrics := cgm.Metrics{}
 	numDuplicates := 0
 
@@ -70,6 +78,8 @@ func (p *plugin) parsePluginOutput(output []string) error {
 				Str("output", strings.Join(output, "\n")).
 				Msg("parsing json")
 			p.metrics = &cgm.Metrics{}
+			p.runStats.parseErrors++
+			p.reject(strings.Join(output, "\n"), errors.Wrap(err, "parsing json").Error())
 			return errors.Wrap(err, "parsing json")
 		}
 		for mn, md := range jm {
@@ -80,35 +90,64 @@ func (p *plugin) parsePluginOutput(output []string) error {
 				}
 				mn += st
 			}
-			metrics[mn] = cgm.Metric{Type: md.Type, Value: md.Value}
+			metric := cgm.Metric{Type: md.Type, Value: md.Value}
+			// same as the /write receiver, an array of values for a
+			// 'n' metric is treated as a list of histogram samples
+			if values, ok := md.Value.([]interface{}); ok && md.Type == "n" {
+				samples := make([]string, 0, len(values))
+				for _, v := range values {
+					samples = append(samples, fmt.Sprintf("%v", v))
+				}
+				hist, err := p.parseHistogram(mn, samples)
+				if err != nil {
+					p.logger.Error().
+						Err(err).
+						Str("metric", mn).
+						Msg("parsing histogram")
+					p.reject(mn, errors.Wrap(err, "parsing histogram").Error())
+					continue
+				}
+				metric.Value = hist
+			}
+			if md.Timestamp > 0 {
+				metric.Value = tags.TimestampedValue{Timestamp: md.Timestamp, Value: metric.Value}
+			}
+			metrics[mn] = metric
 		}
+		p.runStats.metricsParsed += len(metrics)
+		p.runStats.parseErrors += len(jm) - len(metrics)
 		p.metrics = &metrics
+		p.lastOutput = time.Now()
 		return nil
 	}
 
 	// otherwise, assume it is delimited fields:
 	//  fieldDelimiter is current TAB
-	//  metric_name<TAB>metric_type[<TAB>metric_value<TAB>tags]
+	//  metric_name<TAB>metric_type[<TAB>metric_value[<TAB>tags[<TAB>timestamp]]]
 	//  foo\ti\t10  - int32 foo w/value 10
 	//  bar\tL      - uint64 bar w/o value (null, metric is present but has no value)
+	//  baz\th\t1,2,H[3]=4 - histogram baz w/samples 1, 2 and four samples in bucket 3
 	// note: tags is a comma separated list of key:value pairs (e.g. foo:bar,cat:dog)
-	metricTypes := regexp.MustCompile("^[iIlLnOs]$")
+	// note: timestamp is when the sample was observed, in milliseconds since epoch
+	metricTypes := regexp.MustCompile("^[hiIlLnOs]$")
 	for _, line := range output {
 		delimCount := strings.Count(line, fieldDelimiter)
 		if delimCount == 0 {
 			p.logger.Error().
 				Str("line", line).
 				Msg("invalid format, zero field delimiters found")
+			p.reject(line, "invalid format, zero field delimiters found")
 			continue
 		}
 
 		fields := strings.Split(line, fieldDelimiter)
-		if len(fields) <= 1 || len(fields) > 4 {
+		if len(fields) <= 1 || len(fields) > 5 {
 			p.logger.Error().
 				Str("line", line).
 				Int("fields", len(fields)).
 				Int("delimiters", delimCount).
-				Msg("invalid number of fields - expect 2, 3, or 4")
+				Msg("invalid number of fields - expect 2, 3, 4, or 5")
+			p.reject(line, "invalid number of fields - expect 2, 3, 4, or 5")
 			continue
 		}
 
@@ -118,6 +157,7 @@ func (p *plugin) parsePluginOutput(output []string) error {
 		if _, ok := metrics[metricName]; ok {
 			p.logger.Warn().Str("name", metricName).Msg("duplicate name, skipping")
 			numDuplicates++
+			p.reject(line, "duplicate name, skipping")
 			continue
 		}
 
@@ -126,13 +166,20 @@ func (p *plugin) parsePluginOutput(output []string) error {
 				Str("line", line).
 				Str("type", metricType).
 				Msg("invalid metric type")
+			p.reject(line, "invalid metric type")
 			continue
 		}
 
+		// histograms are sent to the broker as encoded 'n' metrics
+		nullType := metricType
+		if metricType == "h" {
+			nullType = "n"
+		}
+
 		// only received a name and type (intentionally null value)
 		if len(fields) == 2 {
 			metrics[metricName] = cgm.Metric{
-				Type:  metricType,
+				Type:  nullType,
 				Value: nullMetricValue,
 			}
 			continue
@@ -141,7 +188,7 @@ func (p *plugin) parsePluginOutput(output []string) error {
 		metricValue := fields[2]
 
 		// add stream tags to metric name
-		if len(fields) == 4 {
+		if len(fields) >= 4 {
 			metricTags := fields[3]
 			t, err := tags.PrepStreamTags(metricTags)
 			if err != nil {
@@ -152,10 +199,25 @@ func (p *plugin) parsePluginOutput(output []string) error {
 			}
 		}
 
+		// sample timestamp
+		var metricTS uint64
+		if len(fields) == 5 {
+			ts, err := strconv.ParseUint(fields[4], 10, 64)
+			if err != nil {
+				p.logger.Error().
+					Err(err).
+					Str("line", line).
+					Msg("unable to parse timestamp")
+				p.reject(line, errors.Wrap(err, "unable to parse timestamp").Error())
+				continue
+			}
+			metricTS = ts
+		}
+
 		// intentionally null value, explicit syntax
 		if strings.ToLower(metricValue) == nullMetricValue {
 			metrics[metricName] = cgm.Metric{
-				Type:  metricType,
+				Type:  nullType,
 				Value: nullMetricValue,
 			}
 			continue
@@ -172,6 +234,7 @@ func (p *plugin) parsePluginOutput(output []string) error {
 					Err(err).
 					Str("line", line).
 					Msg("unable to parse int32")
+				p.reject(line, errors.Wrap(err, "unable to parse int32").Error())
 				continue
 			}
 			metric.Value = int32(i)
@@ -183,6 +246,7 @@ func (p *plugin) parsePluginOutput(output []string) error {
 					Err(err).
 					Str("line", line).
 					Msg("unable to parse uint32")
+				p.reject(line, errors.Wrap(err, "unable to parse uint32").Error())
 				continue
 			}
 			metric.Value = uint32(u)
@@ -194,6 +258,7 @@ func (p *plugin) parsePluginOutput(output []string) error {
 					Err(err).
 					Str("line", line).
 					Msg("unable to parse int64")
+				p.reject(line, errors.Wrap(err, "unable to parse int64").Error())
 				continue
 			}
 			metric.Value = i
@@ -205,6 +270,7 @@ func (p *plugin) parsePluginOutput(output []string) error {
 					Err(err).
 					Str("line", line).
 					Msg("unable to parse uint64")
+				p.reject(line, errors.Wrap(err, "unable to parse uint64").Error())
 				continue
 			}
 			metric.Value = u
@@ -216,6 +282,7 @@ func (p *plugin) parsePluginOutput(output []string) error {
 					Err(err).
 					Str("line", line).
 					Msg("unable to parse double/float")
+				p.reject(line, errors.Wrap(err, "unable to parse double/float").Error())
 				continue
 			}
 			metric.Value = f
@@ -225,14 +292,31 @@ func (p *plugin) parsePluginOutput(output []string) error {
 		case "O": // have Circonus automatically detect
 			metric.Type = metricType
 			metric.Value = metricValue
+		case "h": // histogram, comma separated list of samples
+			metric.Type = "n"
+			hist, err := p.parseHistogram(metricName, strings.Split(metricValue, ","))
+			if err != nil {
+				p.logger.Error().
+					Err(err).
+					Str("line", line).
+					Msg("unable to parse histogram")
+				p.reject(line, errors.Wrap(err, "unable to parse histogram").Error())
+				continue
+			}
+			metric.Value = hist
 		default:
 			p.logger.Error().
 				Str("line", line).
 				Str("type", metricType).
 				Msg("unknown metric type")
+			p.reject(line, "unknown metric type")
 			continue
 		}
 
+		if metricTS > 0 {
+			metric.Value = tags.TimestampedValue{Timestamp: metricTS, Value: metric.Value}
+		}
+
 		metrics[metricName] = metric
 	}
 
@@ -243,11 +327,61 @@ func (p *plugin) parsePluginOutput(output []string) error {
 		Int("tot_error", len(output)-(len(metrics)+numDuplicates)).
 		Msg("done processing plugin output")
 
+	p.runStats.duplicates += numDuplicates
+	p.runStats.metricsParsed += len(metrics)
+	p.runStats.parseErrors += len(output) - (len(metrics) + numDuplicates)
 	p.metrics = &metrics
+	p.lastOutput = time.Now()
 
 	return nil
 }
 
+// reject records a line of plugin output which did not result in a
+// metric, when rejected lines are being collected (e.g. plugin test).
+// note: caller must hold the plugin lock
+func (p *plugin) reject(line, reason string) {
+	if !p.collectRejects {
+		return
+	}
+	p.rejects = append(p.rejects, rejectedLine{Line: line, Reason: reason})
+}
+
+// parseHistogram accepts a list of histogram samples, using the same encodings
+// as the /write receiver - either raw values (e.g. 1.2) or encoded histogram
+// buckets (e.g. H[1.2]=3). Invalid samples are logged and skipped. Returns the
+// encoded histogram.
+func (p *plugin) parseHistogram(metricName string, samples []string) ([]string, error) {
+	hist := circonusllhist.New()
+	numSamples := 0
+
+	for idx, sample := range samples {
+		hs, err := tags.ParseHistogramSample(sample)
+		if err == nil {
+			if hs.Bucket {
+				err = hist.RecordValues(hs.Value, hs.Count)
+			} else {
+				err = hist.RecordValue(hs.Value)
+			}
+		}
+		if err != nil {
+			p.logger.Warn().
+				Err(err).
+				Str("metric", metricName).
+				Str("sample", sample).
+				Int("position", idx).
+				Msg("histogram sample, ignoring")
+			continue
+		}
+		numSamples++
+	}
+
+	if numSamples == 0 {
+		return nil, errors.New("no valid histogram samples")
+	}
+
+	return hist.DecStrings(), nil
+}
+
 // exec runs a specific plugin and saves plugin output
 func (p *plugin) exec() error {
 	// NOTE: !! IMPORTANT !!
@@ -259,7 +393,7 @@ func (p *plugin) exec() error {
 
 	plog.Debug().Msg("Running")
 
-	if p.runTTL > time.Duration(0) {
+	if p.runTTL > time.Duration(0) && !p.longRunning {
 		if time.Since(p.lastEnd) < p.runTTL {
 			msg := "TTL not expired"
 			plog.Info().Msg(msg)
@@ -277,33 +411,60 @@ func (p *plugin) exec() error {
 
 	p.running = true
 	p.lastStart = time.Now()
+	p.runStats = runStats{}
+	p.rejects = nil
+	p.livenessExceeded = false
+	p.timedOut = false
 	p.cmd = exec.CommandContext(p.ctx, p.command)
 	p.cmd.Dir = p.runDir
 	if p.instanceArgs != nil {
 		p.cmd.Args = append(p.cmd.Args, p.instanceArgs...)
 	}
+	var userErr error
+	if p.runUser != "" {
+		userErr = setRunUser(p.cmd, p.runUser)
+	}
 
 	var errOut bytes.Buffer
-	p.cmd.Stderr = &errOut
+	errHistory := &stderrWriter{plugin: p}
+	p.cmd.Stderr = io.MultiWriter(&errOut, errHistory)
 
 	p.Unlock()
 
-	resetStatus := func(err error) {
+	resetStatus := func(err error, exitCode int) {
 		p.Lock()
 		p.lastEnd = time.Now()
 		p.lastRunDuration = time.Since(p.lastStart)
 		p.lastError = err
+		p.lastExitCode = exitCode
+		p.lastRunStats = p.runStats
 		p.running = false
+		if err != nil {
+			p.failedRuns++
+		} else {
+			p.failedRuns = 0
+		}
+		p.recordRun(p.lastStart, p.lastRunDuration, exitCode, err)
 		p.Unlock()
 	}
 
+	if userErr != nil {
+		msg := "run as user"
+		plog.Error().
+			Err(userErr).
+			Str("user", p.runUser).
+			Msg(msg)
+		resetStatus(userErr, -1)
+		return errors.Wrap(userErr, msg)
+	}
+
 	stdout, err := p.cmd.StdoutPipe()
 	if err != nil {
 		msg := "stdout pipe"
 		plog.Error().
 			Err(err).
 			Msg(msg)
-		resetStatus(err)
+		resetStatus(err, -1)
 		return errors.Wrap(err, msg)
 	}
 
@@ -316,10 +477,50 @@ func (p *plugin) exec() error {
 			Err(err).
 			Str("cmd", p.command).
 			Msg(msg)
-		resetStatus(err)
+		resetStatus(err, -1)
 		return errors.Wrap(err, msg)
 	}
 
+	// supervised long running plugins are killed (and restarted) if
+	// a block of output is not received within the liveness timeout
+	var liveness *time.Timer
+	if p.longRunning && p.livenessTimeout > time.Duration(0) {
+		liveness = time.AfterFunc(p.livenessTimeout, func() {
+			p.Lock()
+			p.livenessExceeded = true
+			p.timeouts++
+			p.Unlock()
+			plog.Warn().
+				Str("timeout", p.livenessTimeout.String()).
+				Msg("liveness deadline exceeded, killing")
+			if err := p.cmd.Process.Kill(); err != nil {
+				plog.Error().
+					Err(err).
+					Msg("killing plugin")
+			}
+		})
+	}
+
+	// plugins (other than long running plugins) are killed if
+	// they do not complete within the directory default timeout
+	var deadline *time.Timer
+	if !p.longRunning && p.timeout > time.Duration(0) {
+		deadline = time.AfterFunc(p.timeout, func() {
+			p.Lock()
+			p.timedOut = true
+			p.timeouts++
+			p.Unlock()
+			plog.Warn().
+				Str("timeout", p.timeout.String()).
+				Msg("execution timeout exceeded, killing")
+			if err := p.cmd.Process.Kill(); err != nil {
+				plog.Error().
+					Err(err).
+					Msg("killing plugin")
+			}
+		})
+	}
+
 	for scanner.Scan() {
 		line := scanner.Text()
 
@@ -328,6 +529,9 @@ func (p *plugin) exec() error {
 		if line == "" {
 			p.parsePluginOutput(lines)
 			lines = []string{}
+			if liveness != nil {
+				liveness.Reset(p.livenessTimeout)
+			}
 			continue
 		}
 
@@ -335,6 +539,10 @@ func (p *plugin) exec() error {
 		lines = append(lines, line)
 	}
 
+	if liveness != nil {
+		liveness.Stop()
+	}
+
 	var runErr error
 
 	if err := scanner.Err(); err != nil {
@@ -347,9 +555,27 @@ func (p *plugin) exec() error {
 
 	// parse lines if there are any in the buffer
 	// or, in case of long running plugin, any left in buffer on exit
-	p.parsePluginOutput(lines)
+	// (a supervised long running plugin keeps the metrics from its
+	// last complete block if nothing is left in the buffer)
+	if len(lines) > 0 || !p.longRunning {
+		p.parsePluginOutput(lines)
+	}
+
+	err = p.cmd.Wait()
+	errHistory.flush()
 
-	if err := p.cmd.Wait(); err != nil {
+	if deadline != nil {
+		deadline.Stop()
+	}
+
+	exitCode := -1
+	if p.cmd.ProcessState != nil {
+		if status, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+			exitCode = status.ExitStatus()
+		}
+	}
+
+	if err != nil {
 		var stderr string
 		if errOut.Len() > 0 {
 			stderr = strings.Replace(errOut.String(), "\n", "", -1)
@@ -380,6 +606,17 @@ func (p *plugin) exec() error {
 		}
 	}
 
-	resetStatus(runErr)
+	p.Lock()
+	timedOut := p.timedOut
+	p.Unlock()
+	if timedOut {
+		if runErr != nil {
+			runErr = errors.Wrapf(runErr, "execution timeout exceeded (%s)", p.timeout)
+		} else {
+			runErr = errors.Errorf("execution timeout exceeded (%s)", p.timeout)
+		}
+	}
+
+	resetStatus(runErr, exitCode)
 	return runErr
 }
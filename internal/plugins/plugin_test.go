@@ -14,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/circonus-labs/circonus-agent/internal/tags"
 	cgm "github.com/circonus-labs/circonus-gometrics"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -107,6 +108,88 @@ func TestParsePluginOutput(t *testing.T) {
 		}
 	}
 
+	t.Log("json histogram metric")
+	{
+		p.metrics = nil
+		err := p.parsePluginOutput([]string{`{"metric": {"_type": "n", "_value": [1, 2.5, "H[3.0e+00]=4"]}}`})
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		m, ok := (*p.metrics)["metric"]
+		if !ok {
+			t.Fatalf("expected metric, have (%#v)", p.metrics)
+		}
+		hist, ok := m.Value.([]string)
+		if !ok {
+			t.Fatalf("expected []string, got (%T)", m.Value)
+		}
+		if len(hist) != 3 {
+			t.Fatalf("expected 3 buckets, got (%#v)", hist)
+		}
+	}
+
+	t.Log("json invalid histogram metric")
+	{
+		p.metrics = nil
+		err := p.parsePluginOutput([]string{`{"metric": {"_type": "n", "_value": ["foo", "H[bar]=1"]}}`})
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(*p.metrics) != 0 {
+			t.Fatalf("expected 0 metrics, have (%#v)", p.metrics)
+		}
+	}
+
+	t.Log("json metric w/timestamp")
+	{
+		p.metrics = nil
+		err := p.parsePluginOutput([]string{`{"metric": {"_type": "L", "_value": 1, "_ts": 1530000000000}}`})
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		m, ok := (*p.metrics)["metric"]
+		if !ok {
+			t.Fatalf("expected metric, have (%#v)", p.metrics)
+		}
+		tv, ok := m.Value.(tags.TimestampedValue)
+		if !ok {
+			t.Fatalf("expected timestamped value, got (%T)", m.Value)
+		}
+		if tv.Timestamp != 1530000000000 {
+			t.Fatalf("expected 1530000000000, got (%d)", tv.Timestamp)
+		}
+	}
+
+	t.Log("tab delimited histogram w/timestamp")
+	{
+		p.metrics = nil
+		err := p.parsePluginOutput([]string{"metric\th\t1,2,H[3.0e+00]=4\tfoo:bar\t1530000000000"})
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		m, ok := (*p.metrics)["metric|ST[foo:bar]"]
+		if !ok {
+			t.Fatalf("expected metric, have (%#v)", p.metrics)
+		}
+		if m.Type != "n" {
+			t.Fatalf("expected type n, got (%s)", m.Type)
+		}
+		tv, ok := m.Value.(tags.TimestampedValue)
+		if !ok {
+			t.Fatalf("expected timestamped value, got (%T)", m.Value)
+		}
+		if tv.Timestamp != 1530000000000 {
+			t.Fatalf("expected 1530000000000, got (%d)", tv.Timestamp)
+		}
+		hist, ok := tv.Value.([]string)
+		if !ok {
+			t.Fatalf("expected []string, got (%T)", tv.Value)
+		}
+		if len(hist) != 3 {
+			t.Fatalf("expected 3 buckets, got (%#v)", hist)
+		}
+	}
+
 	var tabDelimTests = []struct {
 		description     string
 		output          []string
@@ -121,6 +204,11 @@ func TestParsePluginOutput(t *testing.T) {
 		{"double", []string{"metric\tn\t1.0"}, 1},
 		{"string", []string{"metric\ts\tfoo"}, 1},
 		{"auto", []string{"metric\tO\tfoo"}, 1},
+		{"histogram", []string{"metric\th\t1,2.5,H[3.0e+00]=4"}, 1},
+		{"histogram partially invalid", []string{"metric\th\t1,foo,H[bar]=1"}, 1},
+		{"histogram null", []string{"metric\th"}, 1},
+		{"timestamp", []string{"metric\tL\t1\t\t1530000000000"}, 1},
+		{"timestamp w/tags", []string{"metric\tL\t1\tfoo:bar\t1530000000000"}, 1},
 		{"invalid", []string{"metric\tQ\tfoo"}, 0},
 		{"invalid int32", []string{"metric\ti\tfoo"}, 0},
 		{"invalid uint32", []string{"metric\tI\tfoo"}, 0},
@@ -129,6 +217,9 @@ func TestParsePluginOutput(t *testing.T) {
 		{"invalid double", []string{"metric\tn\tfoo"}, 0},
 		{"invalid delimiter", []string{"metric L 1"}, 0},
 		{"invalid number of fields", []string{"metric\tL\t1\tfoo\tbar"}, 0},
+		{"invalid number of fields", []string{"metric\tL\t1\tfoo:bar\t1530000000000\tbaz"}, 0},
+		{"invalid histogram", []string{"metric\th\tfoo,H[bar]=1"}, 0},
+		{"invalid timestamp", []string{"metric\tL\t1\tfoo:bar\tbaz"}, 0},
 		{"invalid metric type", []string{"metric\tfoo\t1"}, 0},
 		{"invalid metric type", []string{"metric\t\t1"}, 0},
 	}
@@ -0,0 +1,260 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/tags"
+	"github.com/pkg/errors"
+)
+
+// Test runs a single plugin, identified by path or by name (in the plugin
+// directory), the same way it would be run by the agent. A report of the
+// parsed metrics, stream tags, and rejected output lines is written to w.
+// A long running plugin is stopped after longRunningTimeout (0 runs it until
+// it exits or is interrupted), the report covers the output received so far.
+func (p *Plugins) Test(target string, longRunningTimeout time.Duration, w io.Writer) error {
+	if err := p.loadTestPlugin(target, w); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(p.active))
+	for id := range p.active {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	numFailed := 0
+	for _, id := range ids {
+		plug := p.active[id]
+		plug.collectRejects = true
+		if plug.historySize <= 0 {
+			plug.historySize = 100 // capture stderr
+		}
+		var cancel context.CancelFunc
+		if plug.longRunning {
+			if longRunningTimeout > time.Duration(0) {
+				fmt.Fprintf(w, "NOTE: %s is a long running plugin, it will be stopped after %s\n", id, longRunningTimeout)
+				plug.ctx, cancel = context.WithTimeout(plug.ctx, longRunningTimeout)
+			} else {
+				fmt.Fprintf(w, "NOTE: %s is a long running plugin, it will run until it exits or is interrupted\n", id)
+			}
+		}
+
+		runErr := plug.exec()
+		if cancel != nil {
+			// stopping the plugin at the deadline is not a plugin error
+			if plug.ctx.Err() == context.DeadlineExceeded {
+				runErr = nil
+			}
+			cancel()
+		}
+		if runErr != nil || len(plug.rejects) > 0 {
+			numFailed++
+		}
+
+		plug.Lock()
+		plug.report(w, runErr)
+		plug.Unlock()
+	}
+
+	if numFailed > 0 {
+		return errors.Errorf("%d of %d plugin(s) had errors or rejected lines", numFailed, len(ids))
+	}
+
+	return nil
+}
+
+// loadTestPlugin activates only the plugin (and its instances) identified
+// by target - a path to a plugin or a plugin id in the plugin directory.
+// A note is written to w if the plugin would not be active in the agent
+// with the current configuration.
+func (p *Plugins) loadTestPlugin(target string, w io.Writer) error {
+	if target == "" {
+		return errors.New("invalid plugin (empty)")
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.active = make(map[string]*plugin)
+
+	// a path to a plugin, it runs in the directory where it is located
+	isPath := strings.ContainsRune(target, filepath.Separator) || strings.ContainsRune(target, '/')
+	if _, err := os.Lstat(target); err == nil {
+		isPath = true
+	}
+	if isPath {
+		pluginPath, err := filepath.Abs(target)
+		if err != nil {
+			return errors.Wrap(err, "plugin")
+		}
+		fi, err := os.Lstat(pluginPath)
+		if err != nil {
+			return errors.Wrap(err, "plugin")
+		}
+		found := newScanResult()
+		if err := p.loadPathPlugin(pluginPath, fi, found, w); err != nil {
+			return errors.Wrapf(err, "invalid plugin (%s)", pluginPath)
+		}
+		p.activate(found)
+		return nil
+	}
+
+	// a plugin id, scan the plugin directory the same way the agent does
+	// so the plugin gets the same id, directory defaults, and instances
+	if p.pluginDir == "" {
+		return errors.Errorf("plugin (%s) not found, invalid plugin directory (none)", target)
+	}
+
+	if err := p.scanPluginDirectory(nil); err != nil {
+		return errors.Wrap(err, "plugin directory scan")
+	}
+
+	for id, plug := range p.active {
+		if plug.id != target && id != target {
+			delete(p.active, id)
+		}
+	}
+
+	if len(p.active) == 0 {
+		if !p.recursive && strings.Contains(target, metricDelimiter) {
+			return errors.Errorf("plugin (%s) not found in %s, subdirectories are only scanned with --plugin-recursive", target, p.pluginDir)
+		}
+		return errors.Errorf("plugin (%s) not found in %s", target, p.pluginDir)
+	}
+
+	return nil
+}
+
+// loadPathPlugin adds the plugin at pluginPath to found. A plugin in the
+// plugin directory (or one of its subdirectories) gets the same id and
+// directory defaults as it does when the plugin directory is scanned, any
+// other plugin only gets the defaults of its own directory.
+// note: caller must hold the plugin lock
+func (p *Plugins) loadPathPlugin(pluginPath string, fi os.FileInfo, found *scanResult, w io.Writer) error {
+	dir := filepath.Dir(pluginPath)
+
+	rel := ""
+	if p.pluginDir != "" { // absolute, see New
+		if r, err := filepath.Rel(p.pluginDir, dir); err == nil && r != ".." && !strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			rel = r
+		}
+	}
+
+	if rel == "" {
+		pluginDir := p.pluginDir
+		if pluginDir == "" {
+			pluginDir = "none"
+		}
+		fmt.Fprintf(w, "NOTE: %s is not in the plugin directory (%s), it is not active in the agent with the current configuration\n", pluginPath, pluginDir)
+		defs, err := p.loadDirDefaults(dir, pluginDefaults{})
+		if err != nil {
+			return err
+		}
+		return p.loadPlugin(dir, "", defs, fi, found, nil)
+	}
+
+	// walk from the plugin directory down to the plugin's subdirectory,
+	// building the defaults and id prefix the way scanDir does
+	subDir := p.pluginDir
+	idPrefix := ""
+	defs, err := p.loadDirDefaults(subDir, pluginDefaults{})
+	if err != nil {
+		return err
+	}
+	if rel != "." {
+		if !p.recursive {
+			fmt.Fprintf(w, "NOTE: %s is in a subdirectory of the plugin directory, it is only active in the agent with --plugin-recursive\n", pluginPath)
+		}
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			subDir = filepath.Join(subDir, name)
+			idPrefix += name + metricDelimiter
+			if defs, err = p.loadDirDefaults(subDir, defs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return p.loadPlugin(subDir, idPrefix, defs, fi, found, nil)
+}
+
+// report writes the results of a plugin test run
+// note: caller must hold the plugin lock
+func (p *plugin) report(w io.Writer, runErr error) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	ttl := "none"
+	if p.runTTL > 0 {
+		ttl = p.runTTL.String()
+	}
+
+	fmt.Fprintf(tw, "Plugin:\t%s\n", p.name)
+	fmt.Fprintf(tw, "Command:\t%s\n", strings.Join(append([]string{p.command}, p.instanceArgs...), " "))
+	fmt.Fprintf(tw, "Working dir:\t%s\n", p.runDir)
+	fmt.Fprintf(tw, "TTL:\t%s\n", ttl)
+	if p.timeout > 0 {
+		fmt.Fprintf(tw, "Timeout:\t%s\n", p.timeout)
+	}
+	if p.runUser != "" {
+		fmt.Fprintf(tw, "User:\t%s\n", p.runUser)
+	}
+	fmt.Fprintf(tw, "Duration:\t%s\n", p.lastRunDuration)
+	fmt.Fprintf(tw, "Exit code:\t%d\n", p.lastExitCode)
+	if runErr != nil {
+		fmt.Fprintf(tw, "Error:\t%s\n", runErr)
+	}
+	tw.Flush()
+
+	var metrics []string
+	if p.metrics != nil {
+		for mn := range *p.metrics {
+			metrics = append(metrics, mn)
+		}
+	}
+	sort.Strings(metrics)
+
+	fmt.Fprintf(w, "\nMetrics (%d):\n", len(metrics))
+	if len(metrics) > 0 {
+		fmt.Fprint(tw, "  NAME\tTYPE\tVALUE\tSTREAM TAGS\n")
+		for _, mn := range metrics {
+			metric := (*p.metrics)[mn]
+			name := mn
+			streamTags := ""
+			if idx := strings.Index(mn, "|ST["); idx != -1 {
+				name = mn[:idx]
+				streamTags = mn[idx+1:]
+			}
+			value := fmt.Sprintf("%v", metric.Value)
+			if tv, ok := metric.Value.(tags.TimestampedValue); ok {
+				value = fmt.Sprintf("%v @ %d", tv.Value, tv.Timestamp)
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", name, metric.Type, value, streamTags)
+		}
+		tw.Flush()
+	}
+
+	fmt.Fprintf(w, "\nRejected lines (%d):\n", len(p.rejects))
+	for _, r := range p.rejects {
+		fmt.Fprintf(w, "  %q\n    %s\n", r.Line, r.Reason)
+	}
+
+	fmt.Fprintf(w, "\nStderr (%d):\n", len(p.stderrHistory))
+	for _, line := range p.stderrHistory {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+
+	fmt.Fprintln(w)
+}
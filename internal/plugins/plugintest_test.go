@@ -0,0 +1,220 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestPluginTest(t *testing.T) {
+	t.Log("Testing Test")
+
+	if runtime.GOOS == "windows" {
+		t.Skip("not applicable on windows")
+	}
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyPluginDir, "testdata")
+
+	t.Log("invalid (not found)")
+	{
+		p, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		var buf bytes.Buffer
+		err = p.Test("invalid", 0, &buf)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.HasPrefix(err.Error(), "plugin (invalid) not found in") {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+
+	t.Log("invalid (config file)")
+	{
+		p, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		var buf bytes.Buffer
+		err = p.Test(filepath.Join("testdata", "goodcfg.json"), 0, &buf)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.HasSuffix(err.Error(), "config file") {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+
+	t.Log("valid (by name)")
+	{
+		p, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		var buf bytes.Buffer
+		if err := p.Test("test", 0, &buf); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !strings.Contains(buf.String(), "Metrics (1):") {
+			t.Fatalf("expected 1 metric, got (%s)", buf.String())
+		}
+	}
+
+	t.Log("invalid (by name, nested, not recursive)")
+	{
+		p, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		var buf bytes.Buffer
+		err = p.Test("recurse`mysql`replication", 0, &buf)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), "--plugin-recursive") {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+
+	t.Log("valid (by name, nested)")
+	{
+		viper.Set(config.KeyPluginTTLUnits, "s")
+		viper.Set(config.KeyPluginRecursive, true)
+		p, err := New(context.Background())
+		viper.Set(config.KeyPluginRecursive, false)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		var buf bytes.Buffer
+		_ = p.Test("recurse`mysql`replication", 0, &buf) // output is not tab delimited, lines are rejected
+		if strings.Count(buf.String(), "Plugin:") != 1 {
+			t.Fatalf("expected 1 plugin, got (%s)", buf.String())
+		}
+		if !strings.Contains(buf.String(), "recurse`mysql`replication") {
+			t.Fatalf("expected nested plugin id, got (%s)", buf.String())
+		}
+		if !strings.Contains(buf.String(), "Timeout:") || !strings.Contains(buf.String(), "5s\n") {
+			t.Fatalf("expected inherited directory defaults, got (%s)", buf.String())
+		}
+	}
+
+	t.Log("valid (by path, w/instances)")
+	{
+		p, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		var buf bytes.Buffer
+		if err := p.Test(filepath.Join("testdata", "goodcfg.sh"), 0, &buf); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if strings.Count(buf.String(), "Plugin:") != 2 {
+			t.Fatalf("expected 2 instances, got (%s)", buf.String())
+		}
+	}
+
+	t.Log("valid (by path, nested)")
+	{
+		p, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		var buf bytes.Buffer
+		_ = p.Test(filepath.Join("testdata", "recurse", "mysql", "replication.sh"), 0, &buf) // output is not tab delimited, lines are rejected
+		if !strings.Contains(buf.String(), "recurse`mysql`replication") {
+			t.Fatalf("expected nested plugin id, got (%s)", buf.String())
+		}
+		if !strings.Contains(buf.String(), "1m0s\n") || !strings.Contains(buf.String(), "5s\n") {
+			t.Fatalf("expected directory defaults from the plugin directory down, got (%s)", buf.String())
+		}
+		if !strings.Contains(buf.String(), "only active in the agent with --plugin-recursive") {
+			t.Fatalf("expected note about recursive setting, got (%s)", buf.String())
+		}
+	}
+
+	t.Log("valid (long running, stopped)")
+	{
+		viper.Set(config.KeyPluginLongRunning, []string{"supervise`longrun"})
+		viper.Set(config.KeyPluginRecursive, true)
+		p, err := New(context.Background())
+		viper.Set(config.KeyPluginRecursive, false)
+		viper.Set(config.KeyPluginLongRunning, []string{})
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		var buf bytes.Buffer
+		if err := p.Test("supervise`longrun", 500*time.Millisecond, &buf); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if !strings.Contains(buf.String(), "stopped after 500ms") {
+			t.Fatalf("expected note about stopping, got (%s)", buf.String())
+		}
+		if !strings.Contains(buf.String(), "Metrics (1):") {
+			t.Fatalf("expected 1 metric, got (%s)", buf.String())
+		}
+	}
+
+	t.Log("error (exit)")
+	{
+		p, err := New(context.Background())
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		var buf bytes.Buffer
+		if err := p.Test("error", 0, &buf); err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(buf.String(), "foo bar") {
+			t.Fatalf("expected stderr in report, got (%s)", buf.String())
+		}
+	}
+}
+
+func TestReject(t *testing.T) {
+	t.Log("Testing reject")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	p := &plugin{id: "test", name: "test"}
+
+	t.Log("not collecting")
+	{
+		p.parsePluginOutput([]string{"foo\tQ\t1"})
+		if len(p.rejects) != 0 {
+			t.Fatalf("expected no rejects, got (%#v)", p.rejects)
+		}
+	}
+
+	t.Log("collecting")
+	{
+		p.collectRejects = true
+		p.parsePluginOutput([]string{"foo\tQ\t1", "bar\tL\t1", "bar\tL\t2", "baz L 1"})
+		expect := []string{"invalid metric type", "duplicate name, skipping", "invalid format, zero field delimiters found"}
+		if len(p.rejects) != len(expect) {
+			t.Fatalf("expected (%#v) got (%#v)", expect, p.rejects)
+		}
+		for i, reason := range expect {
+			if p.rejects[i].Reason != reason {
+				t.Fatalf("expected (%s) got (%s)", reason, p.rejects[i].Reason)
+			}
+		}
+	}
+}
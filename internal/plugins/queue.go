@@ -0,0 +1,73 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// runQueue runs plugins, at most maxConcurrency at a time (0 is unlimited),
+// and waits for them to finish. Plugins are started in order of priority
+// (highest first), plugins with the same priority are started in the order
+// they last ran (least recently first) so each gets a fair turn.
+func (p *Plugins) runQueue(plugs []*plugin) {
+	if len(plugs) == 0 {
+		return
+	}
+
+	type queuedPlugin struct {
+		plug      *plugin
+		priority  int
+		lastStart time.Time
+	}
+
+	queued := make([]queuedPlugin, 0, len(plugs))
+	for _, plug := range plugs {
+		plug.Lock()
+		queued = append(queued, queuedPlugin{plug: plug, priority: plug.priority, lastStart: plug.lastStart})
+		plug.Unlock()
+	}
+
+	sort.SliceStable(queued, func(i, j int) bool {
+		if queued[i].priority != queued[j].priority {
+			return queued[i].priority > queued[j].priority
+		}
+		if !queued[i].lastStart.Equal(queued[j].lastStart) {
+			return queued[i].lastStart.Before(queued[j].lastStart)
+		}
+		return queued[i].plug.name < queued[j].plug.name
+	})
+
+	workers := p.maxConcurrency
+	if workers <= 0 || workers > len(queued) {
+		workers = len(queued)
+	}
+
+	queuedAt := time.Now()
+	queue := make(chan *plugin, len(queued))
+	for _, q := range queued {
+		queue <- q.plug
+	}
+	close(queue)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for plug := range queue {
+				plug.Lock()
+				plug.lastQueueWait = time.Since(queuedAt)
+				plug.Unlock()
+				plug.exec()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
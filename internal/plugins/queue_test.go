@@ -0,0 +1,80 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRunQueue(t *testing.T) {
+	t.Log("Testing runQueue")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	newPlugin := func(name string, priority int, lastStart time.Time) *plugin {
+		return &plugin{
+			ctx:       context.Background(),
+			id:        name,
+			name:      name,
+			command:   filepath.Join("testdata", "test.sh"),
+			priority:  priority,
+			lastStart: lastStart,
+		}
+	}
+
+	t.Log("no plugins")
+	{
+		p := &Plugins{maxConcurrency: 1}
+		p.runQueue(nil)
+	}
+
+	t.Log("priority, then least recently run first (max concurrency 1)")
+	{
+		now := time.Now()
+		low := newPlugin("low", -1, time.Time{})
+		recent := newPlugin("recent", 0, now.Add(-1*time.Minute))
+		older := newPlugin("older", 0, now.Add(-2*time.Minute))
+		high := newPlugin("high", 10, now)
+
+		p := &Plugins{maxConcurrency: 1}
+		p.runQueue([]*plugin{low, recent, older, high})
+
+		order := []*plugin{high, older, recent, low}
+		for i := 1; i < len(order); i++ {
+			if !order[i-1].lastStart.Before(order[i].lastStart) {
+				t.Fatalf("expected %s to start before %s", order[i-1].name, order[i].name)
+			}
+			if order[i-1].lastQueueWait > order[i].lastQueueWait {
+				t.Fatalf("expected %s queue wait (%s) <= %s queue wait (%s)", order[i-1].name, order[i-1].lastQueueWait, order[i].name, order[i].lastQueueWait)
+			}
+		}
+		if low.lastQueueWait <= time.Duration(0) {
+			t.Fatalf("expected queue wait > 0, got %s", low.lastQueueWait)
+		}
+		for _, plug := range order {
+			if plug.metrics == nil {
+				t.Fatalf("expected %s to have run", plug.name)
+			}
+		}
+	}
+
+	t.Log("unlimited")
+	{
+		plugs := []*plugin{newPlugin("a", 0, time.Time{}), newPlugin("b", 0, time.Time{})}
+		p := &Plugins{}
+		p.runQueue(plugs)
+		for _, plug := range plugs {
+			if plug.metrics == nil {
+				t.Fatalf("expected %s to have run", plug.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build !windows
+
+package plugins
+
+import (
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// setRunUser configures the command to run as the named user
+// note: the agent must have sufficient privileges to switch users
+func setRunUser(cmd *exec.Cmd, userName string) error {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return errors.Wrap(err, "looking up user")
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return errors.Wrapf(err, "parsing uid (%s)", u.Uid)
+	}
+
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return errors.Wrapf(err, "parsing gid (%s)", u.Gid)
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid: uint32(uid),
+			Gid: uint32(gid),
+		},
+	}
+
+	return nil
+}
@@ -0,0 +1,19 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build windows
+
+package plugins
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// setRunUser running plugins as another user is not supported on windows
+func setRunUser(cmd *exec.Cmd, userName string) error {
+	return errors.Errorf("running plugin as user (%s) not supported on windows", userName)
+}
@@ -11,8 +11,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -39,12 +39,18 @@ func (p *Plugins) Scan(b *builtins.Builtins) error {
 	// 2. starts any long running plugins without blocking
 	//
 	initialRun := func() error {
+		var plugs []*plugin
 		for id, plug := range p.active {
 			p.logger.Debug().
 				Str("plugin", id).
 				Msg("Initializing")
-			go plug.exec()
+			if plug.longRunning {
+				go plug.supervise()
+				continue
+			}
+			plugs = append(plugs, plug)
 		}
+		go p.runQueue(plugs)
 		return nil
 	}
 
@@ -74,207 +80,433 @@ func (p *Plugins) scanPluginDirectory(b *builtins.Builtins) error {
 		Str("dir", p.pluginDir).
 		Msg("Scanning plugin directory")
 
-	f, err := os.Open(p.pluginDir)
+	rootDefaults, err := p.loadDirDefaults(p.pluginDir, pluginDefaults{})
 	if err != nil {
-		return errors.Wrap(err, "open plugin directory")
+		p.logger.Warn().Err(err).Str("dir", p.pluginDir).Msg("plugin directory defaults, ignoring")
 	}
 
-	defer f.Close()
+	visited := make(map[string]bool)
+	found := newScanResult()
+	if err := p.scanDir(p.pluginDir, "", rootDefaults, visited, found, b); err != nil {
+		return err
+	}
 
-	files, err := f.Readdir(-1)
-	if err != nil {
-		return errors.Wrap(err, "reading plugin directory")
+	p.activate(found)
+
+	if len(p.active) == 0 {
+		p.logger.Warn().Msg("no active plugins found")
 	}
 
-	ttlRx, err := regexp.Compile(`_ttl(.+)$`)
+	return nil
+}
+
+// scanResult holds the plugins (and plugin instances) found by a scan of
+// the plugin directory, they are activated once the scan is complete
+type scanResult struct {
+	plugins    map[string]*plugin
+	sources    map[string]string   // id -> file the plugin (instance) was found in
+	collisions map[string][]string // id -> all files defining the same id
+}
+
+func newScanResult() *scanResult {
+	return &scanResult{
+		plugins:    make(map[string]*plugin),
+		sources:    make(map[string]string),
+		collisions: make(map[string][]string),
+	}
+}
+
+// add a plugin found in source, a second plugin with the same id (e.g.
+// mysql/replication.sh and the replication instance in mysql.json) is
+// recorded as a collision
+func (r *scanResult) add(id, source string, plug *plugin) {
+	if prev, ok := r.sources[id]; ok {
+		if len(r.collisions[id]) == 0 {
+			r.collisions[id] = []string{prev}
+		}
+		r.collisions[id] = append(r.collisions[id], source)
+		return
+	}
+	r.plugins[id] = plug
+	r.sources[id] = source
+}
+
+// activate the plugins found by a scan. Plugins already active (the
+// directory is scanned again by Reload) are left untouched, they may be
+// running. Ids defined by more than one file are ambiguous, none of the
+// plugins with the id are activated.
+// note: caller must hold the plugin lock
+func (p *Plugins) activate(found *scanResult) {
+	for id, sources := range found.collisions {
+		sort.Strings(sources)
+		p.logger.Error().
+			Str("id", id).
+			Strs("sources", sources).
+			Msg("plugin id defined by multiple files, ignoring all of them")
+	}
+
+	for id, plug := range found.plugins {
+		if _, collision := found.collisions[id]; collision {
+			continue
+		}
+		if _, ok := p.active[id]; ok {
+			p.logger.Debug().Str("id", id).Msg("plugin already active, skipping")
+			continue
+		}
+		p.active[id] = plug
+		appstats.MapIncrementInt("plugins", "total")
+		p.logger.Info().
+			Str("id", id).
+			Str("cmd", plug.command).
+			Msg("Activating plugin")
+	}
+}
+
+// scanDir loads the plugins in a directory. When recursive scanning is
+// enabled, subdirectories are scanned as well - the plugins found are
+// namespaced with the relative path of the subdirectory (e.g. the id of
+// mysql/replication.sh is mysql`replication). Directory defaults are
+// inherited by subdirectories. visited holds the resolved directories
+// already scanned, to protect against symlink cycles. The plugins found
+// are added to found.
+func (p *Plugins) scanDir(dir string, idPrefix string, defs pluginDefaults, visited map[string]bool, found *scanResult, b *builtins.Builtins) error {
+	realDir, err := filepath.EvalSymlinks(dir)
 	if err != nil {
-		return errors.Wrap(err, "compiling ttl regex")
+		return errors.Wrap(err, "resolving plugin directory")
+	}
+	if absDir, err := filepath.Abs(realDir); err == nil {
+		realDir = absDir
+	}
+	if visited[realDir] {
+		p.logger.Warn().
+			Str("dir", dir).
+			Str("resolved", realDir).
+			Msg("directory already scanned (symlink cycle?), ignoring")
+		return nil
 	}
-	ttlUnitRx, err := regexp.Compile(`(ms|s|m|h)$`)
+	visited[realDir] = true
+
+	f, err := os.Open(dir)
 	if err != nil {
-		return errors.Wrap(err, "compiling ttl unit regex")
+		return errors.Wrap(err, "open plugin directory")
 	}
 
-	for _, fi := range files {
-		fileName := fi.Name()
+	defer f.Close()
 
-		p.logger.Debug().
-			Str("path", filepath.Join(p.pluginDir, fileName)).
-			Msg("checking plugin directory entry")
+	files, err := f.Readdir(-1)
+	if err != nil {
+		return errors.Wrap(err, "reading plugin directory")
+	}
 
-		if fi.IsDir() {
-			p.logger.Debug().
-				Str("file", fileName).
-				Msg("directory, ignoring")
+	for _, fi := range files {
+		if p.recursive && isDir(dir, fi) {
+			subDir := filepath.Join(dir, fi.Name())
+			subDefs, err := p.loadDirDefaults(subDir, defs)
+			if err != nil {
+				p.logger.Warn().Err(err).Str("dir", subDir).Msg("plugin directory defaults, ignoring")
+			}
+			if err := p.scanDir(subDir, idPrefix+fi.Name()+metricDelimiter, subDefs, visited, found, b); err != nil {
+				p.logger.Warn().
+					Err(err).
+					Str("dir", subDir).
+					Msg("scanning plugin subdirectory, ignoring")
+			}
 			continue
 		}
 
-		fileBase := fileName
-		fileExt := filepath.Ext(fileName)
+		// errors are logged by loadPlugin, the directory entry is
+		// simply not activated as a plugin
+		_ = p.loadPlugin(dir, idPrefix, defs, fi, found, b)
+	}
+
+	return nil
+}
 
-		if fileExt != "" {
-			fileBase = strings.Replace(fileName, fileExt, "", -1)
+// isDir determines if a directory entry is a directory or a symlink to a directory
+func isDir(dir string, fi os.FileInfo) bool {
+	if fi.IsDir() {
+		return true
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if sfi, err := os.Stat(filepath.Join(dir, fi.Name())); err == nil {
+			return sfi.IsDir()
 		}
+	}
+	return false
+}
 
-		if fileBase == "" || fileExt == "" {
-			p.logger.Debug().
-				Str("file", fileName).
-				Msg("invalid file name format, ignoring")
-			continue
+// loadDirDefaults reads the plugin defaults file in a directory (if one exists),
+// values in the file override the parent directory's defaults
+func (p *Plugins) loadDirDefaults(dir string, parent pluginDefaults) (pluginDefaults, error) {
+	defs := parent
+
+	cfgFile := filepath.Join(dir, dirDefaultsFile)
+	data, err := ioutil.ReadFile(cfgFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return defs, nil
 		}
+		return defs, errors.Wrap(err, "reading defaults")
+	}
 
-		if fileExt == ".conf" || fileExt == ".json" {
-			p.logger.Debug().
-				Str("file", fileName).
-				Msg("config file, ignoring")
-			continue
+	var cfg dirDefaultsConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return defs, errors.Wrapf(err, "parsing defaults (%s)", cfgFile)
+	}
+
+	if cfg.TTL != "" {
+		ttl := cfg.TTL
+		if !ttlUnitRx.MatchString(ttl) {
+			ttl += viper.GetString(config.KeyPluginTTLUnits)
 		}
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return defs, errors.Wrapf(err, "parsing ttl (%s)", cfgFile)
+		}
+		defs.ttl = d
+	}
 
-		if _, reserved := p.reservedNames[fileBase]; reserved {
-			p.logger.Warn().
-				Str("file", fileName).
-				Msg("reserved plugin name, ignoring")
-			continue
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return defs, errors.Wrapf(err, "parsing timeout (%s)", cfgFile)
 		}
+		defs.timeout = d
+	}
 
-		var cmdName string
+	if cfg.User != "" {
+		defs.user = cfg.User
+	}
 
-		switch mode := fi.Mode(); {
-		case mode.IsRegular():
-			cmdName = filepath.Join(p.pluginDir, fi.Name())
-		case mode&os.ModeSymlink != 0:
-			resolvedSymlink, err := filepath.EvalSymlinks(filepath.Join(p.pluginDir, fi.Name()))
-			if err != nil {
-				p.logger.Warn().
-					Err(err).
-					Str("file", fi.Name()).
-					Msg("Error resolving symlink, ignoring")
-				continue
-			}
-			cmdName = resolvedSymlink
-		default:
-			p.logger.Debug().
-				Str("file", fileName).
-				Msg("not a regular file or symlink, ignoring")
-			continue // just ignore it
+	if cfg.Stale != "" {
+		sp, err := parseStalePolicy(cfg.Stale)
+		if err != nil {
+			return defs, errors.Wrapf(err, "parsing stale (%s)", cfgFile)
 		}
+		defs.stale = &sp
+	}
 
-		if runtime.GOOS != "windows" {
-			// windows doesn't have an e'x'ecutable bit, all files are
-			// 'potentially' executable - binary exe, interpreted scripts, etc.
-			if perm := fi.Mode().Perm() & 0111; perm != 73 {
-				p.logger.Warn().
-					Str("file", cmdName).
-					Str("perms", fmt.Sprintf("%q", fi.Mode().Perm())).
-					Msg("executable bit not set, ignoring")
-				continue
-			}
+	p.logger.Debug().
+		Str("dir", dir).
+		Str("ttl", defs.ttl.String()).
+		Str("timeout", defs.timeout.String()).
+		Str("user", defs.user).
+		Msg("loaded plugin directory defaults")
+
+	return defs, nil
+}
+
+// stalePolicyFor returns the stale policy for a plugin (or plugin instance),
+// in order of precedence: the plugin's entry in the stale policies, the
+// plugin directory default, the agent default
+func (p *Plugins) stalePolicyFor(name, id string, defs pluginDefaults) stalePolicy {
+	if sp, ok := p.stalePolicies[name]; ok {
+		return sp
+	}
+	if sp, ok := p.stalePolicies[id]; ok {
+		return sp
+	}
+	if defs.stale != nil {
+		return *defs.stale
+	}
+	return p.stalePolicy
+}
+
+// priorityFor returns the run priority for a plugin (or plugin instance),
+// the instance's priority takes precedence over the plugin's
+func (p *Plugins) priorityFor(name, id string) int {
+	if priority, ok := p.priorities[name]; ok {
+		return priority
+	}
+	return p.priorities[id]
+}
+
+// loadPlugin verifies a plugin directory entry and adds it to found as a
+// plugin (or one plugin per instance, if there is a json config for the
+// plugin). Returns an error describing why the entry was not added.
+func (p *Plugins) loadPlugin(dir string, idPrefix string, defs pluginDefaults, fi os.FileInfo, found *scanResult, b *builtins.Builtins) error {
+	fileName := fi.Name()
+
+	p.logger.Debug().
+		Str("path", filepath.Join(dir, fileName)).
+		Msg("checking plugin directory entry")
+
+	if fi.IsDir() {
+		p.logger.Debug().
+			Str("file", fileName).
+			Msg("directory, ignoring")
+		return errors.New("directory")
+	}
+
+	fileBase := fileName
+	fileExt := filepath.Ext(fileName)
+
+	if fileExt != "" {
+		fileBase = strings.Replace(fileName, fileExt, "", -1)
+	}
+
+	if fileBase == "" || fileExt == "" {
+		p.logger.Debug().
+			Str("file", fileName).
+			Msg("invalid file name format, ignoring")
+		return errors.New("invalid file name format")
+	}
+
+	if fileExt == ".conf" || fileExt == ".json" {
+		p.logger.Debug().
+			Str("file", fileName).
+			Msg("config file, ignoring")
+		return errors.New("config file")
+	}
+
+	// the instance config of a _defaults.<ext> plugin would be the directory defaults file
+	if fileBase+".json" == dirDefaultsFile {
+		p.logger.Warn().
+			Str("file", fileName).
+			Msg("directory defaults file name, ignoring")
+		return errors.New("directory defaults file name")
+	}
+
+	if _, reserved := p.reservedNames[idPrefix+fileBase]; reserved {
+		p.logger.Warn().
+			Str("file", fileName).
+			Msg("reserved plugin name, ignoring")
+		return errors.New("reserved plugin name")
+	}
+
+	var cmdName string
+
+	switch mode := fi.Mode(); {
+	case mode.IsRegular():
+		cmdName = filepath.Join(dir, fi.Name())
+	case mode&os.ModeSymlink != 0:
+		resolvedSymlink, err := filepath.EvalSymlinks(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			p.logger.Warn().
+				Err(err).
+				Str("file", fi.Name()).
+				Msg("Error resolving symlink, ignoring")
+			return errors.Wrap(err, "resolving symlink")
 		}
+		cmdName = resolvedSymlink
+	default:
+		p.logger.Debug().
+			Str("file", fileName).
+			Msg("not a regular file or symlink, ignoring")
+		return errors.New("not a regular file or symlink")
+	}
 
-		if b != nil && b.IsBuiltin(fileBase) {
-			p.logger.Warn().Str("id", fileBase).Msg("Builtin collector already enabled, skipping plugin")
-			continue
+	if runtime.GOOS != "windows" {
+		// windows doesn't have an e'x'ecutable bit, all files are
+		// 'potentially' executable - binary exe, interpreted scripts, etc.
+		if perm := fi.Mode().Perm() & 0111; perm != 73 {
+			p.logger.Warn().
+				Str("file", cmdName).
+				Str("perms", fmt.Sprintf("%q", fi.Mode().Perm())).
+				Msg("executable bit not set, ignoring")
+			return errors.New("executable bit not set")
 		}
+	}
+
+	pluginID := idPrefix + fileBase
 
-		var cfg map[string][]string
+	if b != nil && b.IsBuiltin(pluginID) {
+		p.logger.Warn().Str("id", pluginID).Msg("Builtin collector already enabled, skipping plugin")
+		return errors.New("builtin collector already enabled")
+	}
+
+	var cfg map[string][]string
 
-		// check for config file
-		cfgFile := filepath.Join(p.pluginDir, fmt.Sprintf("%s.json", fileBase))
-		if data, err := ioutil.ReadFile(cfgFile); err != nil {
-			if !os.IsNotExist(err) {
+	// check for config file
+	cfgFile := filepath.Join(dir, fmt.Sprintf("%s.json", fileBase))
+	if data, err := ioutil.ReadFile(cfgFile); err != nil {
+		if !os.IsNotExist(err) {
+			p.logger.Warn().
+				Err(err).
+				Str("config", cfgFile).
+				Str("plugin", fileBase).Msg("plugin config")
+		}
+	} else {
+		if len(data) > 0 {
+			err := json.Unmarshal(data, &cfg)
+			if err != nil {
 				p.logger.Warn().
 					Err(err).
 					Str("config", cfgFile).
-					Str("plugin", fileBase).Msg("plugin config")
+					Str("plugin", fileBase).
+					Str("data", string(data)).
+					Msg("parsing config")
 			}
-		} else {
-			if len(data) > 0 {
-				err := json.Unmarshal(data, &cfg)
-				if err != nil {
-					p.logger.Warn().
-						Err(err).
-						Str("config", cfgFile).
-						Str("plugin", fileBase).
-						Str("data", string(data)).
-						Msg("parsing config")
-				}
-
-				p.logger.Debug().
-					Str("config", fmt.Sprintf("%+v", cfg)).
-					Msg("loaded plugin config")
-			}
-		}
 
-		// parse fileBase for _ttl(.+)
-		matches := ttlRx.FindAllStringSubmatch(fileBase, -1)
-		var runTTL time.Duration
-		if len(matches) > 0 && len(matches[0]) > 1 {
-			ttl := matches[0][1]
-			if ttl != "" {
-				if !ttlUnitRx.MatchString(ttl) {
-					ttl += viper.GetString(config.KeyPluginTTLUnits)
-				}
-
-				if d, err := time.ParseDuration(ttl); err != nil {
-					p.logger.Warn().Err(err).Str("ttl", ttl).Msg("parsing plugin ttl, ignoring ttl")
-				} else {
-					runTTL = d
-				}
-			}
+			p.logger.Debug().
+				Str("config", fmt.Sprintf("%+v", cfg)).
+				Msg("loaded plugin config")
 		}
+	}
 
-		if cfg == nil {
-			plug, ok := p.active[fileBase]
-			if !ok {
-				p.active[fileBase] = &plugin{
-					ctx:    p.ctx,
-					id:     fileBase,
-					name:   fileBase,
-					logger: p.logger.With().Str("plugin", fileBase).Logger(),
-					runDir: p.pluginDir,
-					runTTL: runTTL,
-				}
-				plug = p.active[fileBase]
+	// parse fileBase for _ttl(.+), overrides directory default
+	matches := ttlRx.FindAllStringSubmatch(fileBase, -1)
+	runTTL := defs.ttl
+	if len(matches) > 0 && len(matches[0]) > 1 {
+		ttl := matches[0][1]
+		if ttl != "" {
+			if !ttlUnitRx.MatchString(ttl) {
+				ttl += viper.GetString(config.KeyPluginTTLUnits)
 			}
 
-			appstats.MapIncrementInt("plugins", "total")
-			plug.command = cmdName
-			p.logger.Info().
-				Str("id", fileBase).
-				Str("cmd", cmdName).
-				Msg("Activating plugin")
-
-		} else {
-			for inst, args := range cfg {
-				pluginName := fmt.Sprintf("%s`%s", fileBase, inst)
-				plug, ok := p.active[pluginName]
-				if !ok {
-					p.active[pluginName] = &plugin{
-						ctx:          p.ctx,
-						id:           fileBase,
-						instanceID:   inst,
-						instanceArgs: args,
-						name:         pluginName,
-						logger:       p.logger.With().Str("plugin", pluginName).Logger(),
-						runDir:       p.pluginDir,
-						runTTL:       runTTL,
-					}
-					plug = p.active[pluginName]
-				}
-
-				appstats.MapIncrementInt("plugins", "total")
-				plug.command = cmdName
-				p.logger.Info().
-					Str("id", pluginName).
-					Str("cmd", cmdName).
-					Msg("Activating plugin")
-
+			if d, err := time.ParseDuration(ttl); err != nil {
+				p.logger.Warn().Err(err).Str("ttl", ttl).Msg("parsing plugin ttl, ignoring ttl")
+			} else {
+				runTTL = d
 			}
 		}
 	}
 
-	if len(p.active) == 0 {
-		p.logger.Warn().Msg("no active plugins found")
+	longRunning := p.longRunning[pluginID]
+
+	if cfg == nil {
+		found.add(pluginID, filepath.Join(dir, fileName), &plugin{
+			command:         cmdName,
+			ctx:             p.ctx,
+			historySize:     p.historySize,
+			id:              pluginID,
+			livenessTimeout: p.livenessTimeout,
+			longRunning:     longRunning,
+			name:            pluginID,
+			logger:          p.logger.With().Str("plugin", pluginID).Logger(),
+			runDir:          dir,
+			runTTL:          runTTL,
+			runUser:         defs.user,
+			priority:        p.priorityFor(pluginID, pluginID),
+			stalePolicy:     p.stalePolicyFor(pluginID, pluginID, defs),
+			stderrLogLevel:  p.stderrLogLevel,
+			timeout:         defs.timeout,
+		})
+
+		return nil
+	}
+
+	for inst, args := range cfg {
+		pluginName := fmt.Sprintf("%s`%s", pluginID, inst)
+		found.add(pluginName, fmt.Sprintf("%s (instance %s)", cfgFile, inst), &plugin{
+			command:         cmdName,
+			ctx:             p.ctx,
+			historySize:     p.historySize,
+			id:              pluginID,
+			instanceID:      inst,
+			instanceArgs:    args,
+			livenessTimeout: p.livenessTimeout,
+			longRunning:     longRunning,
+			name:            pluginName,
+			logger:          p.logger.With().Str("plugin", pluginName).Logger(),
+			runDir:          dir,
+			runTTL:          runTTL,
+			runUser:         defs.user,
+			priority:        p.priorityFor(pluginName, pluginID),
+			stalePolicy:     p.stalePolicyFor(pluginName, pluginID, defs),
+			stderrLogLevel:  p.stderrLogLevel,
+			timeout:         defs.timeout,
+		})
 	}
 
 	return nil
@@ -7,7 +7,12 @@ package plugins
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/circonus-labs/circonus-agent/internal/builtins"
 	"github.com/circonus-labs/circonus-agent/internal/config"
@@ -96,3 +101,205 @@ func TestScanPluginDirectory(t *testing.T) {
 		}
 	}
 }
+
+func TestScanRecursive(t *testing.T) {
+	t.Log("Testing scanPluginDirectory (recursive)")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPluginDir, "testdata/recurse")
+	viper.Set(config.KeyPluginTTLUnits, "s")
+	defer viper.Set(config.KeyPluginDir, "")
+
+	t.Log("Not recursive")
+	{
+		viper.Set(config.KeyPluginRecursive, false)
+		p, nerr := New(context.Background())
+		if nerr != nil {
+			t.Fatalf("new err %s", nerr)
+		}
+		if err := p.scanPluginDirectory(nil); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(p.active) != 1 {
+			t.Fatalf("expected 1 plugin, got %d", len(p.active))
+		}
+		plug, ok := p.active["top"]
+		if !ok {
+			t.Fatal("expected 'top' plugin")
+		}
+		if plug.runTTL != 30*time.Second {
+			t.Fatalf("expected 30s ttl, got %s", plug.runTTL)
+		}
+		if plug.timeout != 5*time.Second {
+			t.Fatalf("expected 5s timeout, got %s", plug.timeout)
+		}
+	}
+
+	t.Log("Recursive (w/symlink cycle)")
+	{
+		viper.Set(config.KeyPluginRecursive, true)
+		defer viper.Set(config.KeyPluginRecursive, false)
+		p, nerr := New(context.Background())
+		if nerr != nil {
+			t.Fatalf("new err %s", nerr)
+		}
+		if err := p.scanPluginDirectory(nil); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if len(p.active) != 2 {
+			t.Fatalf("expected 2 plugins, got %d", len(p.active))
+		}
+		plug, ok := p.active["mysql`replication"]
+		if !ok {
+			t.Fatal("expected 'mysql`replication' plugin")
+		}
+		if plug.runTTL != time.Minute {
+			t.Fatalf("expected 1m ttl (override), got %s", plug.runTTL)
+		}
+		if plug.timeout != 5*time.Second {
+			t.Fatalf("expected 5s timeout (inherited), got %s", plug.timeout)
+		}
+		if filepath.Base(plug.runDir) != "mysql" {
+			t.Fatalf("expected run dir mysql, got %s", plug.runDir)
+		}
+	}
+}
+
+func TestScanIDCollision(t *testing.T) {
+	t.Log("Testing scanPluginDirectory (id collision)")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir, err := ioutil.TempDir("", "plugincollision")
+	if err != nil {
+		t.Fatalf("tempdir %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// mysql/replication.sh and the replication instance of mysql.sh
+	// both have the id mysql`replication
+	if err := os.Mkdir(filepath.Join(dir, "mysql"), 0755); err != nil {
+		t.Fatalf("mkdir %s", err)
+	}
+	script := []byte("#!/bin/sh\necho \"lag i 0\"\n")
+	for _, file := range []string{"mysql.sh", "top.sh", filepath.Join("mysql", "replication.sh")} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), script, 0755); err != nil {
+			t.Fatalf("writing plugin %s", err)
+		}
+	}
+	cfg := []byte(`{"replication": ["repl"], "status": ["status"]}`)
+	if err := ioutil.WriteFile(filepath.Join(dir, "mysql.json"), cfg, 0644); err != nil {
+		t.Fatalf("writing config %s", err)
+	}
+
+	viper.Set(config.KeyPluginDir, dir)
+	viper.Set(config.KeyPluginRecursive, true)
+	defer viper.Set(config.KeyPluginDir, "")
+	defer viper.Set(config.KeyPluginRecursive, false)
+
+	// directory order must not matter, scan several times
+	for i := 0; i < 5; i++ {
+		p, nerr := New(context.Background())
+		if nerr != nil {
+			t.Fatalf("new err %s", nerr)
+		}
+		if err := p.scanPluginDirectory(nil); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if _, ok := p.active["mysql`replication"]; ok {
+			t.Fatal("expected 'mysql`replication' to not be active")
+		}
+		for _, id := range []string{"top", "mysql`status"} {
+			if _, ok := p.active[id]; !ok {
+				t.Fatalf("expected '%s' plugin", id)
+			}
+		}
+		if len(p.active) != 2 {
+			t.Fatalf("expected 2 plugins, got %d", len(p.active))
+		}
+	}
+}
+
+func TestScanDefaultsName(t *testing.T) {
+	t.Log("Testing scanPluginDirectory (_defaults plugin name)")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir, err := ioutil.TempDir("", "plugindefaults")
+	if err != nil {
+		t.Fatalf("tempdir %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := []byte("#!/bin/sh\necho \"lag i 0\"\n")
+	for _, file := range []string{"_defaults.sh", "top.sh"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), script, 0755); err != nil {
+			t.Fatalf("writing plugin %s", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, dirDefaultsFile), []byte(`{"ttl": "1m"}`), 0644); err != nil {
+		t.Fatalf("writing defaults %s", err)
+	}
+
+	viper.Set(config.KeyPluginDir, dir)
+	defer viper.Set(config.KeyPluginDir, "")
+
+	p, err := New(context.Background())
+	if err != nil {
+		t.Fatalf("new err %s", err)
+	}
+	if err := p.scanPluginDirectory(nil); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	if _, ok := p.active["_defaults"]; ok {
+		t.Fatal("expected '_defaults' to not be active")
+	}
+	if _, ok := p.active["top"]; !ok {
+		t.Fatal("expected 'top' plugin")
+	}
+	if len(p.active) != 1 {
+		t.Fatalf("expected 1 plugin, got %d", len(p.active))
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	t.Log("Testing exec timeout")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir, err := ioutil.TempDir("", "plugintimeout")
+	if err != nil {
+		t.Fatalf("tempdir %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := filepath.Join(dir, "slow.sh")
+	if err := ioutil.WriteFile(cmd, []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatalf("writing plugin %s", err)
+	}
+
+	p := &plugin{
+		ctx:     context.Background(),
+		id:      "slow",
+		name:    "slow",
+		command: cmd,
+		runDir:  dir,
+		timeout: 100 * time.Millisecond,
+	}
+
+	start := time.Now()
+	err = p.exec()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "execution timeout exceeded") {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("expected plugin to be killed")
+	}
+	if p.timeouts != 1 {
+		t.Fatalf("expected 1 timeout, got %d", p.timeouts)
+	}
+}
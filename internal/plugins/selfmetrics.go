@@ -0,0 +1,49 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"time"
+
+	cgm "github.com/circonus-labs/circonus-gometrics"
+)
+
+// selfMetrics returns metrics describing the plugin's most recent run,
+// they are emitted under selfMetricsPrefix when the plugin is flushed
+func (p *plugin) selfMetrics() cgm.Metrics {
+	p.Lock()
+	defer p.Unlock()
+
+	// a long running plugin processes output for the duration of the run,
+	// report what it has processed so far
+	stats := p.lastRunStats
+	if p.running && p.longRunning {
+		stats = p.runStats
+	}
+
+	stale := int32(0)
+	if p.stale {
+		stale = 1
+	}
+
+	// no completed runs yet, only the stale indicator is available
+	if p.lastEnd.IsZero() && !(p.running && p.longRunning) {
+		return cgm.Metrics{
+			"stale": cgm.Metric{Type: "i", Value: stale},
+		}
+	}
+
+	return cgm.Metrics{
+		"run_duration_ms":  cgm.Metric{Type: "L", Value: uint64(p.lastRunDuration / time.Millisecond)},
+		"exit_code":        cgm.Metric{Type: "i", Value: int32(p.lastExitCode)},
+		"timeouts":         cgm.Metric{Type: "L", Value: uint64(p.timeouts)},
+		"lines_parsed":     cgm.Metric{Type: "L", Value: uint64(stats.linesParsed)},
+		"metrics_produced": cgm.Metric{Type: "L", Value: uint64(stats.metricsParsed)},
+		"parse_errors":     cgm.Metric{Type: "L", Value: uint64(stats.parseErrors)},
+		"duplicates":       cgm.Metric{Type: "L", Value: uint64(stats.duplicates)},
+		"stale":            cgm.Metric{Type: "i", Value: stale},
+	}
+}
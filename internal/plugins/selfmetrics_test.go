@@ -0,0 +1,73 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSelfMetrics(t *testing.T) {
+	t.Log("Testing selfMetrics")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	p := &plugin{
+		ctx:     context.Background(),
+		id:      "test",
+		name:    "test",
+		command: path.Join("testdata", "test.sh"),
+	}
+
+	t.Log("no runs")
+	{
+		m := p.selfMetrics()
+		if len(m) != 1 {
+			t.Fatalf("expected only stale metric, got (%#v)", m)
+		}
+		if v := m["stale"].Value.(int32); v != 0 {
+			t.Fatalf("expected stale 0, got %d", v)
+		}
+	}
+
+	t.Log("after run")
+	{
+		if err := p.exec(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		m := p.selfMetrics()
+		if len(m) != 8 {
+			t.Fatalf("expected 8 metrics, got (%#v)", m)
+		}
+		if v := m["lines_parsed"].Value.(uint64); v != 1 {
+			t.Fatalf("expected 1 line parsed, got %d", v)
+		}
+		if v := m["metrics_produced"].Value.(uint64); v != 1 {
+			t.Fatalf("expected 1 metric produced, got %d", v)
+		}
+		if v := m["exit_code"].Value.(int32); v != 0 {
+			t.Fatalf("expected exit code 0, got %d", v)
+		}
+	}
+
+	t.Log("duplicates and parse errors")
+	{
+		p.parsePluginOutput([]string{"foo\tL\t1", "foo\tL\t2", "bar\tL\tbaz"})
+		p.Lock()
+		p.lastRunStats = p.runStats
+		p.Unlock()
+		m := p.selfMetrics()
+		if v := m["duplicates"].Value.(uint64); v != 1 {
+			t.Fatalf("expected 1 duplicate, got %d", v)
+		}
+		if v := m["parse_errors"].Value.(uint64); v != 1 {
+			t.Fatalf("expected 1 parse error, got %d", v)
+		}
+	}
+}
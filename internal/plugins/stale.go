@@ -0,0 +1,130 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/pkg/errors"
+)
+
+// stalePolicy defines what is returned for a plugin when it has not
+// produced new output and the previous metrics are stale
+type stalePolicy struct {
+	action      string
+	expireAfter time.Duration
+	maxFailures int
+}
+
+// parseStalePolicy parses a policy specification:
+//
+//	keep              - return the previous metrics (default)
+//	expire:<duration> - stop returning the previous metrics once they are older than duration
+//	failures:<count>  - stop returning the previous metrics after count consecutive failed runs
+//	null              - return the previous metric names with [[null]] values while the plugin is failing
+func parseStalePolicy(spec string) (stalePolicy, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return stalePolicy{action: staleKeep}, nil
+	}
+
+	parts := strings.SplitN(spec, ":", 2)
+	action := strings.ToLower(parts[0])
+	switch action {
+	case staleKeep, staleNull:
+		if len(parts) > 1 {
+			return stalePolicy{}, errors.Errorf("invalid stale policy (%s), %s takes no argument", spec, action)
+		}
+		return stalePolicy{action: action}, nil
+	case staleExpire:
+		if len(parts) != 2 {
+			return stalePolicy{}, errors.Errorf("invalid stale policy (%s), duration required", spec)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return stalePolicy{}, errors.Wrapf(err, "invalid stale policy (%s)", spec)
+		}
+		if d <= time.Duration(0) {
+			return stalePolicy{}, errors.Errorf("invalid stale policy (%s), duration must be > 0", spec)
+		}
+		return stalePolicy{action: action, expireAfter: d}, nil
+	case staleFailures:
+		if len(parts) != 2 {
+			return stalePolicy{}, errors.Errorf("invalid stale policy (%s), count required", spec)
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return stalePolicy{}, errors.Wrapf(err, "invalid stale policy (%s)", spec)
+		}
+		if n <= 0 {
+			return stalePolicy{}, errors.Errorf("invalid stale policy (%s), count must be > 0", spec)
+		}
+		return stalePolicy{action: action, maxFailures: n}, nil
+	default:
+		return stalePolicy{}, errors.Errorf("invalid stale policy (%s)", spec)
+	}
+}
+
+// String returns the policy specification
+func (sp stalePolicy) String() string {
+	switch sp.action {
+	case staleExpire:
+		return staleExpire + ":" + sp.expireAfter.String()
+	case staleFailures:
+		return staleFailures + ":" + strconv.Itoa(sp.maxFailures)
+	case "":
+		return staleKeep
+	default:
+		return sp.action
+	}
+}
+
+// lastRunFailed is true when the most recent run of the plugin failed, a
+// supervised long running plugin which is (re)started has not failed (yet)
+// note: caller must hold the plugin lock
+func (p *plugin) lastRunFailed() bool {
+	return p.failedRuns > 0 && !(p.longRunning && p.running)
+}
+
+// staleMetrics returns the previous metrics according to the stale policy,
+// called by drain when the plugin has not produced new output or the last
+// run failed.
+// note: caller must hold the plugin lock
+func (p *plugin) staleMetrics() *cgm.Metrics {
+	expired := p.stalePolicy.action == staleExpire &&
+		!p.lastOutput.IsZero() &&
+		time.Since(p.lastOutput) > p.stalePolicy.expireAfter
+
+	p.stale = p.lastRunFailed() || expired
+
+	if p.prevMetrics == nil {
+		return &cgm.Metrics{}
+	}
+
+	switch p.stalePolicy.action {
+	case staleExpire:
+		if expired {
+			return &cgm.Metrics{}
+		}
+	case staleFailures:
+		if p.failedRuns >= p.stalePolicy.maxFailures {
+			return &cgm.Metrics{}
+		}
+	case staleNull:
+		if p.stale {
+			metrics := cgm.Metrics{}
+			for mn, mv := range *p.prevMetrics {
+				metrics[mn] = cgm.Metric{Type: mv.Type, Value: nullMetricValue}
+			}
+			return &metrics
+		}
+	}
+
+	return p.prevMetrics
+}
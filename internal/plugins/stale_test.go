@@ -0,0 +1,262 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	cgm "github.com/circonus-labs/circonus-gometrics"
+	"github.com/rs/zerolog"
+)
+
+func TestParseStalePolicy(t *testing.T) {
+	t.Log("Testing parseStalePolicy")
+
+	tests := []struct {
+		spec      string
+		expected  string
+		shouldErr bool
+	}{
+		{"", "keep", false},
+		{"keep", "keep", false},
+		{"null", "null", false},
+		{"expire:5m", "expire:5m0s", false},
+		{"failures:3", "failures:3", false},
+		{"keep:1", "", true},
+		{"expire", "", true},
+		{"expire:foo", "", true},
+		{"expire:-1s", "", true},
+		{"failures:0", "", true},
+		{"failures:x", "", true},
+		{"invalid", "", true},
+	}
+
+	for _, test := range tests {
+		sp, err := parseStalePolicy(test.spec)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("expected error for (%s)", test.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected NO error for (%s), got (%s)", test.spec, err)
+		}
+		if sp.String() != test.expected {
+			t.Fatalf("expected (%s), got (%s)", test.expected, sp.String())
+		}
+	}
+}
+
+func TestStaleMetrics(t *testing.T) {
+	t.Log("Testing drain w/stale policies")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	newPlugin := func(spec string) *plugin {
+		sp, err := parseStalePolicy(spec)
+		if err != nil {
+			t.Fatalf("policy %s", err)
+		}
+		p := &plugin{id: "test", name: "test", stalePolicy: sp}
+		p.parsePluginOutput([]string{"foo\tL\t1"})
+		if m := p.drain(); len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %#v", m)
+		}
+		return p
+	}
+
+	t.Log("keep")
+	{
+		p := newPlugin("keep")
+		p.failedRuns = 10
+		m := p.drain()
+		if len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %#v", m)
+		}
+		if !p.stale {
+			t.Fatal("expected stale")
+		}
+	}
+
+	t.Log("expire")
+	{
+		p := newPlugin("expire:1m")
+		if m := p.drain(); len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %#v", m)
+		}
+		if p.stale {
+			t.Fatal("expected NOT stale")
+		}
+		p.lastOutput = time.Now().Add(-2 * time.Minute)
+		if m := p.drain(); len(*m) != 0 {
+			t.Fatalf("expected 0 metrics, got %#v", m)
+		}
+		if !p.stale {
+			t.Fatal("expected stale")
+		}
+	}
+
+	t.Log("failures")
+	{
+		p := newPlugin("failures:2")
+		p.failedRuns = 1
+		if m := p.drain(); len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %#v", m)
+		}
+		p.failedRuns = 2
+		if m := p.drain(); len(*m) != 0 {
+			t.Fatalf("expected 0 metrics, got %#v", m)
+		}
+	}
+
+	t.Log("null")
+	{
+		p := newPlugin("null")
+		p.failedRuns = 1
+		m := p.drain()
+		if len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %#v", m)
+		}
+		expected := cgm.Metric{Type: "L", Value: nullMetricValue}
+		if (*m)["foo"] != expected {
+			t.Fatalf("expected %#v, got %#v", expected, (*m)["foo"])
+		}
+	}
+
+	t.Log("new output clears stale")
+	{
+		p := newPlugin("failures:1")
+		p.failedRuns = 1
+		p.drain()
+		p.failedRuns = 0
+		p.parsePluginOutput([]string{"foo\tL\t2"})
+		if m := p.drain(); len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %#v", m)
+		}
+		if p.stale {
+			t.Fatal("expected NOT stale")
+		}
+	}
+}
+
+func TestStaleFailingPlugin(t *testing.T) {
+	t.Log("Testing stale policies w/failing plugin")
+
+	if runtime.GOOS == "windows" {
+		t.Skip("not applicable on windows")
+	}
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir, err := ioutil.TempDir("", "pluginstale")
+	if err != nil {
+		t.Fatalf("tempdir %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// emits a metric until the 'fail' file exists, then exits 1 w/o output
+	cmd := filepath.Join(dir, "flaky.sh")
+	if err := ioutil.WriteFile(cmd, []byte("#!/bin/sh\nif [ -f fail ]; then exit 1; fi\nprintf \"foo\\tL\\t1\\n\"\n"), 0755); err != nil {
+		t.Fatalf("writing plugin %s", err)
+	}
+
+	newPlugin := func(spec string) *plugin {
+		sp, err := parseStalePolicy(spec)
+		if err != nil {
+			t.Fatalf("policy %s", err)
+		}
+		os.Remove(filepath.Join(dir, "fail"))
+		p := &plugin{
+			ctx:         context.Background(),
+			id:          "flaky",
+			name:        "flaky",
+			command:     cmd,
+			runDir:      dir,
+			stalePolicy: sp,
+		}
+		if err := p.exec(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if m := p.drain(); len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %#v", m)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "fail"), nil, 0644); err != nil {
+			t.Fatalf("writing fail file %s", err)
+		}
+		return p
+	}
+
+	staleMetric := func(p *plugin) cgm.Metric {
+		return p.selfMetrics()["stale"]
+	}
+
+	t.Log("keep")
+	{
+		p := newPlugin("keep")
+		if err := p.exec(); err == nil {
+			t.Fatal("expected error")
+		}
+		m := p.drain()
+		if len(*m) != 1 {
+			t.Fatalf("expected previous metric, got %#v", m)
+		}
+		if !p.stale {
+			t.Fatal("expected stale")
+		}
+		if sm := staleMetric(p); sm.Value != int32(1) {
+			t.Fatalf("expected stale metric 1, got %#v", sm)
+		}
+	}
+
+	t.Log("null")
+	{
+		p := newPlugin("null")
+		if err := p.exec(); err == nil {
+			t.Fatal("expected error")
+		}
+		m := p.drain()
+		expected := cgm.Metric{Type: "L", Value: nullMetricValue}
+		if (*m)["foo"] != expected {
+			t.Fatalf("expected %#v, got %#v", expected, (*m)["foo"])
+		}
+	}
+
+	t.Log("failures")
+	{
+		p := newPlugin("failures:2")
+		if err := p.exec(); err == nil {
+			t.Fatal("expected error")
+		}
+		if m := p.drain(); len(*m) != 1 {
+			t.Fatalf("expected previous metric, got %#v", m)
+		}
+		if err := p.exec(); err == nil {
+			t.Fatal("expected error")
+		}
+		if m := p.drain(); len(*m) != 0 {
+			t.Fatalf("expected 0 metrics, got %#v", m)
+		}
+
+		t.Log("\trecovered")
+		os.Remove(filepath.Join(dir, "fail"))
+		if err := p.exec(); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if m := p.drain(); len(*m) != 1 {
+			t.Fatalf("expected 1 metric, got %#v", m)
+		}
+		if p.stale {
+			t.Fatal("expected NOT stale")
+		}
+	}
+}
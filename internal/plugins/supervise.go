@@ -0,0 +1,71 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"fmt"
+	"time"
+)
+
+// supervise runs a long running plugin, restarting it with an
+// exponential backoff each time it exits, until the context is done
+func (p *plugin) supervise() {
+	var backoff time.Duration
+
+	for {
+		start := time.Now()
+		err := p.exec()
+
+		select {
+		case <-p.ctx.Done():
+			return
+		default:
+		}
+
+		// ran long enough to be considered stable, start backoff over
+		if time.Since(start) >= restartBackoffMax {
+			backoff = 0
+		}
+		backoff = nextBackoff(backoff)
+
+		p.Lock()
+		switch {
+		case p.livenessExceeded:
+			p.lastExitReason = fmt.Sprintf("liveness deadline exceeded (%s)", p.livenessTimeout)
+		case err != nil:
+			p.lastExitReason = err.Error()
+		default:
+			p.lastExitReason = "exited"
+		}
+		p.restarts++
+		reason := p.lastExitReason
+		p.Unlock()
+
+		p.logger.Warn().
+			Str("reason", reason).
+			Str("backoff", backoff.String()).
+			Msg("long running plugin exited, restarting")
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// nextBackoff doubles the current restart backoff, within
+// restartBackoffMin and restartBackoffMax
+func nextBackoff(current time.Duration) time.Duration {
+	if current < restartBackoffMin {
+		return restartBackoffMin
+	}
+	next := current * 2
+	if next > restartBackoffMax {
+		return restartBackoffMax
+	}
+	return next
+}
@@ -0,0 +1,85 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package plugins
+
+import (
+	"context"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestNextBackoff(t *testing.T) {
+	t.Log("Testing nextBackoff")
+
+	tests := []struct {
+		current time.Duration
+		expect  time.Duration
+	}{
+		{0, restartBackoffMin},
+		{restartBackoffMin, 2 * restartBackoffMin},
+		{2 * restartBackoffMin, 4 * restartBackoffMin},
+		{restartBackoffMax, restartBackoffMax},
+		{restartBackoffMax - time.Second, restartBackoffMax},
+	}
+
+	for _, test := range tests {
+		t.Logf("current %s", test.current)
+		b := nextBackoff(test.current)
+		if b != test.expect {
+			t.Fatalf("expected (%s) got (%s)", test.expect, b)
+		}
+	}
+}
+
+func TestSupervise(t *testing.T) {
+	t.Log("Testing supervise")
+
+	if runtime.GOOS == "windows" {
+		t.Skip("not applicable on windows")
+	}
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("liveness deadline exceeded")
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		p := &plugin{
+			ctx:             ctx,
+			id:              "longrun",
+			name:            "longrun",
+			command:         path.Join("testdata", "supervise", "longrun.sh"),
+			livenessTimeout: 250 * time.Millisecond,
+			longRunning:     true,
+		}
+
+		go p.supervise()
+
+		time.Sleep(2 * time.Second)
+		cancel()
+
+		p.Lock()
+		restarts := p.restarts
+		reason := p.lastExitReason
+		p.Unlock()
+
+		if restarts == 0 {
+			t.Fatal("expected at least one restart")
+		}
+		if !strings.HasPrefix(reason, "liveness deadline exceeded") {
+			t.Fatalf("expected liveness exit reason, got (%s)", reason)
+		}
+
+		m := p.drain()
+		if _, ok := (*m)["metric"]; !ok {
+			t.Fatalf("expected metric, got (%#v)", m)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+#!/bin/sh
+echo "lag i 0"
@@ -0,0 +1,4 @@
+#!/usr/bin/env bash
+
+printf "metric\tn\t1\n\n"
+exec sleep 60
@@ -7,7 +7,9 @@ package plugins
 
 import (
 	"context"
+	"errors"
 	"os/exec"
+	"regexp"
 	"sync"
 	"time"
 
@@ -17,51 +19,181 @@ import (
 
 // Plugins defines plugin manager
 type Plugins struct {
-	active        map[string]*plugin
-	ctx           context.Context
-	logger        zerolog.Logger
-	pluginDir     string
-	reservedNames map[string]bool
-	running       bool
+	active          map[string]*plugin
+	ctx             context.Context
+	disabled        map[string]bool // plugins disabled at runtime (admin api)
+	historySize     int
+	livenessTimeout time.Duration
+	logger          zerolog.Logger
+	longRunning     map[string]bool
+	maxConcurrency  int
+	pluginDir       string
+	priorities      map[string]int
+	recursive       bool
+	reservedNames   map[string]bool
+	stalePolicies   map[string]stalePolicy
+	stalePolicy     stalePolicy
+	running         bool
+	stderrLogLevel  string
 	sync.RWMutex
 }
 
 // Plugin defines a specific plugin
 type plugin struct {
-	cmd             *exec.Cmd
-	command         string
-	ctx             context.Context
-	id              string
-	instanceArgs    []string
-	instanceID      string
-	lastError       error
-	lastRunDuration time.Duration
-	lastStart       time.Time
-	lastEnd         time.Time
-	logger          zerolog.Logger
-	metrics         *cgm.Metrics
-	name            string
-	prevMetrics     *cgm.Metrics
-	runDir          string
-	running         bool
-	runTTL          time.Duration
+	cmd              *exec.Cmd
+	collectRejects   bool
+	command          string
+	ctx              context.Context
+	failedRuns       int
+	historySize      int
+	id               string
+	instanceArgs     []string
+	instanceID       string
+	lastError        error
+	lastRunDuration  time.Duration
+	lastRunStats     runStats
+	lastStart        time.Time
+	lastEnd          time.Time
+	lastExitCode     int
+	lastExitReason   string
+	lastOutput       time.Time
+	lastQueueWait    time.Duration
+	livenessExceeded bool
+	livenessTimeout  time.Duration
+	logger           zerolog.Logger
+	longRunning      bool
+	metrics          *cgm.Metrics
+	name             string
+	prevMetrics      *cgm.Metrics
+	priority         int
+	rejects          []rejectedLine
+	restarts         int
+	runDir           string
+	runHistory       []pluginRun
+	runStats         runStats
+	running          bool
+	runTTL           time.Duration
+	runUser          string
+	stale            bool
+	stalePolicy      stalePolicy
+	stderrHistory    []string
+	stderrLogLevel   string
+	timedOut         bool
+	timeout          time.Duration
+	timeouts         int
 	sync.Mutex
 }
 
+// rejectedLine a line of plugin output which did not result in a metric
+type rejectedLine struct {
+	Line   string
+	Reason string
+}
+
+// pluginDefaults settings applied to all plugins in a directory (and,
+// when scanning recursively, its subdirectories)
+type pluginDefaults struct {
+	stale   *stalePolicy
+	timeout time.Duration
+	ttl     time.Duration
+	user    string
+}
+
+// dirDefaultsConfig format of a plugin directory defaults file
+type dirDefaultsConfig struct {
+	Stale   string `json:"stale"`
+	Timeout string `json:"timeout"`
+	TTL     string `json:"ttl"`
+	User    string `json:"user"`
+}
+
+// runStats counts the plugin output processed during a run
+type runStats struct {
+	duplicates    int
+	linesParsed   int
+	metricsParsed int
+	parseErrors   int
+}
+
+// PluginState defines the state of a plugin, exposed via the admin api
+type PluginState struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Instance    string `json:"instance,omitempty"`
+	Enabled     bool   `json:"enabled"`
+	LongRunning bool   `json:"long_running,omitempty"`
+}
+
 // pluginDetails are exposed via the /inventory endpoint
 type pluginDetails struct {
-	Name            string   `json:"name"`
-	Instance        string   `json:"instance"`
-	Command         string   `json:"command"`
-	Args            []string `json:"args"`
-	LastRunStart    string   `json:"last_run_start"`
-	LastRunEnd      string   `json:"last_run_end"`
-	LastRunDuration string   `json:"last_run_duration"`
-	LastError       string   `json:"last_error"`
+	Name            string      `json:"name"`
+	Instance        string      `json:"instance"`
+	Command         string      `json:"command"`
+	Args            []string    `json:"args"`
+	LastRunStart    string      `json:"last_run_start"`
+	LastRunEnd      string      `json:"last_run_end"`
+	LastRunDuration string      `json:"last_run_duration"`
+	LastError       string      `json:"last_error"`
+	User            string      `json:"user,omitempty"`
+	Timeout         string      `json:"timeout,omitempty"`
+	LongRunning     bool        `json:"long_running,omitempty"`
+	Restarts        int         `json:"restarts,omitempty"`
+	LastExitReason  string      `json:"last_exit_reason,omitempty"`
+	StalePolicy     string      `json:"stale_policy"`
+	Stale           bool        `json:"stale"`
+	Priority        int         `json:"priority"`
+	Disabled        bool        `json:"disabled,omitempty"`
+	LastQueueWait   string      `json:"last_queue_wait"`
+	Runs            []pluginRun `json:"runs,omitempty"`
+	Stderr          []string    `json:"stderr,omitempty"`
+}
+
+// pluginRun details of a single plugin execution, exposed via the /inventory/<plugin> endpoint
+type pluginRun struct {
+	Start         string `json:"start"`
+	Duration      string `json:"duration"`
+	ExitCode      int    `json:"exit_code"`
+	LinesParsed   int    `json:"lines_parsed"`
+	MetricsParsed int    `json:"metrics_parsed"`
+	ParseErrors   int    `json:"parse_errors"`
+	Error         string `json:"error,omitempty"`
 }
 
 const (
 	fieldDelimiter  = "\t"
 	metricDelimiter = "`"
 	nullMetricValue = "[[null]]"
+
+	// pluginNameSeparator separates multiple plugin names in Run and Flush
+	pluginNameSeparator = ","
+
+	// dirDefaultsFile optional file in a plugin directory with
+	// defaults (ttl, timeout, user) for the plugins in the directory
+	dirDefaultsFile = "_defaults.json"
+
+	// selfMetricsPrefix namespace for metrics describing plugin execution
+	selfMetricsPrefix = "agent" + metricDelimiter + "plugins" + metricDelimiter
+
+	// stale metric policies, see parseStalePolicy
+	staleKeep     = "keep"
+	staleExpire   = "expire"
+	staleFailures = "failures"
+	staleNull     = "null"
+
+	// restartBackoffMin initial delay before restarting a long running plugin
+	restartBackoffMin = 1 * time.Second
+	// restartBackoffMax maximum delay before restarting a long running plugin,
+	// a plugin which runs for at least this long is considered stable and the
+	// backoff is reset
+	restartBackoffMax = 5 * time.Minute
+)
+
+var (
+	// ErrNotFound name is not an active plugin
+	ErrNotFound = errors.New("plugin not found")
+
+	// ttlRx plugin run ttl in plugin file name (e.g. foo_ttl30s.sh)
+	ttlRx = regexp.MustCompile(`_ttl(.+)$`)
+	// ttlUnitRx units of plugin run ttl
+	ttlUnitRx = regexp.MustCompile(`(ms|s|m|h)$`)
 )
@@ -0,0 +1,141 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins"
+	"github.com/circonus-labs/circonus-agent/internal/plugins"
+	"github.com/maier/go-appstats"
+	"github.com/pkg/errors"
+)
+
+// adminHandler serves the admin api, only available on the admin socket
+//
+//	GET      /builtins                            list builtin collectors
+//	GET      /plugins                             list plugins
+//	PUT|POST /builtins/<id>/(enable|disable|reload)
+//	PUT|POST /plugins/<name>/(enable|disable|reload)
+func (s *Server) adminHandler(w http.ResponseWriter, r *http.Request) {
+	appstats.IncrementInt("requests_total")
+
+	s.logger.Info().
+		Str("method", r.Method).
+		Str("url", r.URL.String()).
+		Msg("Admin request")
+
+	switch r.Method {
+	case "GET":
+		m := adminListRx.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			s.adminNotFound(w, r)
+			return
+		}
+		if m[1] == "builtins" {
+			if s.builtins == nil {
+				s.adminResponse(w, http.StatusOK, []builtins.CollectorState{})
+				return
+			}
+			s.adminResponse(w, http.StatusOK, s.builtins.List())
+			return
+		}
+		if s.plugins == nil {
+			s.adminResponse(w, http.StatusOK, []plugins.PluginState{})
+			return
+		}
+		s.adminResponse(w, http.StatusOK, s.plugins.List())
+	case "POST":
+		fallthrough
+	case "PUT":
+		m := adminActionRx.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			s.adminNotFound(w, r)
+			return
+		}
+		kind, id, action := m[1], m[2], m[3]
+
+		var err error
+		if kind == "builtins" {
+			err = s.adminBuiltin(id, action)
+		} else {
+			err = s.adminPlugin(id, action)
+		}
+
+		if err != nil {
+			status := http.StatusInternalServerError
+			if cause := errors.Cause(err); cause == builtins.ErrNotFound || cause == plugins.ErrNotFound {
+				status = http.StatusNotFound
+			}
+			s.logger.Warn().
+				Err(err).
+				Str("id", id).
+				Str("action", action).
+				Msg("Admin request failed")
+			s.adminResponse(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+
+		s.adminResponse(w, http.StatusOK, map[string]string{"id": id, "action": action, "result": "ok"})
+	default:
+		appstats.IncrementInt("requests_bad")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// adminBuiltin applies an admin action to a builtin collector
+func (s *Server) adminBuiltin(id, action string) error {
+	if s.builtins == nil {
+		return errors.Wrap(builtins.ErrNotFound, id)
+	}
+	switch action {
+	case "enable":
+		return s.builtins.Enable(id)
+	case "disable":
+		return s.builtins.Disable(id)
+	case "reload":
+		return s.builtins.Reload(id)
+	}
+	return errors.Errorf("unknown action (%s)", action)
+}
+
+// adminPlugin applies an admin action to a plugin
+func (s *Server) adminPlugin(name, action string) error {
+	if s.plugins == nil {
+		return errors.Wrap(plugins.ErrNotFound, name)
+	}
+	switch action {
+	case "enable":
+		return s.plugins.Enable(name)
+	case "disable":
+		return s.plugins.Disable(name)
+	case "reload":
+		return s.plugins.Reload(name, s.builtins)
+	}
+	return errors.Errorf("unknown action (%s)", action)
+}
+
+func (s *Server) adminNotFound(w http.ResponseWriter, r *http.Request) {
+	appstats.IncrementInt("requests_bad")
+	s.logger.Warn().
+		Str("method", r.Method).
+		Str("url", r.URL.String()).
+		Msg("Not found")
+	http.NotFound(w, r)
+}
+
+func (s *Server) adminResponse(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("admin response -> json")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,118 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/circonus-labs/circonus-agent/internal/builtins"
+	"github.com/circonus-labs/circonus-agent/internal/check"
+	"github.com/circonus-labs/circonus-agent/internal/config"
+	"github.com/circonus-labs/circonus-agent/internal/plugins"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestAdminHandler(t *testing.T) {
+	t.Log("Testing adminHandler")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyListen, ":2609")
+	viper.Set(config.KeyPluginDir, "testdata/")
+	b, berr := builtins.New()
+	if berr != nil {
+		t.Fatalf("expected no error, got (%s)", berr)
+	}
+	p, perr := plugins.New(context.Background())
+	if perr != nil {
+		t.Fatalf("expected NO error, got (%s)", perr)
+	}
+	if err := p.Scan(b); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+	c, cerr := check.New(nil)
+	if cerr != nil {
+		t.Fatalf("expected no error, got (%s)", cerr)
+	}
+
+	s, err := New(c, b, p, nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	t.Log("invalid method")
+	{
+		req := httptest.NewRequest("DELETE", "/plugins", nil)
+		w := httptest.NewRecorder()
+		s.adminHandler(w, req)
+		if resp := w.Result(); resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Fatalf("expected %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+		}
+	}
+
+	reqtests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"GET", "/", http.StatusNotFound},
+		{"GET", "/run", http.StatusNotFound},
+		{"GET", "/builtins/foo/enable", http.StatusNotFound},
+		{"POST", "/plugins", http.StatusNotFound},
+		{"POST", "/plugins/test/restart", http.StatusNotFound},
+		{"POST", "/plugins/invalid/disable", http.StatusNotFound},
+		{"POST", "/builtins/invalid/reload", http.StatusNotFound},
+		{"GET", "/builtins", http.StatusOK},
+		{"GET", "/plugins/", http.StatusOK},
+		{"PUT", "/plugins/test/disable", http.StatusOK},
+		{"POST", "/plugins/test/enable/", http.StatusOK},
+		{"POST", "/plugins/test/reload", http.StatusOK},
+	}
+	for _, reqtest := range reqtests {
+		t.Logf("%s %s", reqtest.method, reqtest.path)
+		req := httptest.NewRequest(reqtest.method, reqtest.path, nil)
+		w := httptest.NewRecorder()
+		s.adminHandler(w, req)
+		resp := w.Result()
+		if resp.StatusCode != reqtest.code {
+			t.Fatalf("expected %d, got %d", reqtest.code, resp.StatusCode)
+		}
+	}
+
+	t.Log("plugin list")
+	{
+		if err := p.Disable("test"); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		req := httptest.NewRequest("GET", "/plugins", nil)
+		w := httptest.NewRecorder()
+		s.adminHandler(w, req)
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+		var states []plugins.PluginState
+		if err := json.Unmarshal(body, &states); err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		found := false
+		for _, state := range states {
+			if state.ID == "test" {
+				found = true
+				if state.Enabled {
+					t.Fatalf("expected disabled, got %#v", state)
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("expected plugin test, got %s", string(body))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build !windows
+
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// listenAdminSocket creates the admin socket, restricted to the user running
+// the agent. The socket is created in a private (0700) directory next to the
+// socket path, set to 0600 and then moved into place, so it is never
+// accessible to other users. The process umask is not changed, plugins and
+// collectors may be creating files at the same time.
+func listenAdminSocket(ua *net.UnixAddr) (*net.UnixListener, error) {
+	sockPath := ua.String()
+
+	tmpDir, err := ioutil.TempDir(filepath.Dir(sockPath), ".admin")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating admin socket directory")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpAddr := &net.UnixAddr{Name: filepath.Join(tmpDir, filepath.Base(sockPath)), Net: ua.Net}
+	ul, err := net.ListenUnix(ua.Network(), tmpAddr)
+	if err != nil {
+		return nil, err
+	}
+	// the listener would remove the temporary path on close, the
+	// socket is removed from its final path when the server stops
+	ul.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmpAddr.Name, 0600); err != nil {
+		ul.Close()
+		return nil, errors.Wrap(err, "setting admin socket permissions")
+	}
+
+	if err := os.Rename(tmpAddr.Name, sockPath); err != nil {
+		ul.Close()
+		return nil, errors.Wrap(err, "moving admin socket into place")
+	}
+
+	return ul, nil
+}
@@ -0,0 +1,19 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// +build windows
+
+package server
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// listenAdminSocket the admin socket is not supported on windows
+func listenAdminSocket(ua *net.UnixAddr) (*net.UnixListener, error) {
+	return nil, errors.Errorf("admin socket (%s) not supported on windows", ua.String())
+}
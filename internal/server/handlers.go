@@ -21,19 +21,25 @@ import (
 	"github.com/circonus-labs/circonus-agent/internal/config"
 	"github.com/circonus-labs/circonus-agent/internal/server/promrecv"
 	"github.com/circonus-labs/circonus-agent/internal/server/receiver"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
 	cgm "github.com/circonus-labs/circonus-gometrics"
 	appstats "github.com/maier/go-appstats"
 	"github.com/spf13/viper"
 )
 
 // run handles requests to execute plugins and return metrics emitted
-// handles /, /run, or /run/plugin_name
+// handles /, /run, /run/plugin_name or /run/id1,id2,... where an id may be
+// a builtin, a builtin category (e.g. collector:network), a plugin or an
+// internal server (prom, write, statsd)
 func (s *Server) run(w http.ResponseWriter, r *http.Request) {
-	id := ""
+	var ids []string
+
+	if strings.HasPrefix(r.URL.Path, "/run/") { // run specific item(s)
+		for _, id := range strings.Split(strings.Replace(r.URL.Path, "/run/", "", -1), ",") {
+			if id == "" {
+				continue
+			}
 
-	if strings.HasPrefix(r.URL.Path, "/run/") { // run specific item
-		id = strings.Replace(r.URL.Path, "/run/", "", -1)
-		if id != "" {
 			idOK := false
 
 			// highest priority, internal servers (receiver, statsd, etc.)
@@ -59,6 +65,8 @@ func (s *Server) run(w http.ResponseWriter, r *http.Request) {
 				http.NotFound(w, r)
 				return
 			}
+
+			ids = append(ids, id)
 		}
 	}
 
@@ -67,15 +75,18 @@ func (s *Server) run(w http.ResponseWriter, r *http.Request) {
 
 	metrics := cgm.Metrics{} //map[string]interface{}{}
 
-	// default to true if id is blank, otherwise set all to false
-	runBuiltins := id == ""
-	runPlugins := id == ""
-	flushProm := id == ""
-	flushReceiver := id == ""
-	flushStatsd := id == ""
+	// default to true if no ids, otherwise set all to false
+	all := len(ids) == 0
+	runBuiltins := all
+	runPlugins := all
+	flushProm := all
+	flushReceiver := all
+	flushStatsd := all
+
+	var builtinIDs, pluginIDs []string
 
-	if id != "" {
-		// identify _what_ to run based on the id
+	// identify _what_ to run based on the id(s)
+	for _, id := range ids {
 		switch {
 		case id == "prom":
 			flushProm = true
@@ -85,13 +96,16 @@ func (s *Server) run(w http.ResponseWriter, r *http.Request) {
 			flushStatsd = true
 		case s.builtins.IsBuiltin(id):
 			runBuiltins = true
+			builtinIDs = append(builtinIDs, id)
 		default:
 			runPlugins = true
+			pluginIDs = append(pluginIDs, id)
 		}
 	}
 
 	if runBuiltins {
 		s.logger.Debug().Msg("builtin start")
+		id := strings.Join(builtinIDs, ",") // blank, all builtins
 		s.builtins.Run(id)
 		builtinMetrics := s.builtins.Flush(id)
 		for metricName, metric := range *builtinMetrics {
@@ -105,6 +119,7 @@ func (s *Server) run(w http.ResponseWriter, r *http.Request) {
 		//       1. errors are already logged by Run
 		//       2. do not expose execution state to callers
 		s.logger.Debug().Msg("plugin start")
+		id := strings.Join(pluginIDs, ",") // blank, all plugins
 		s.plugins.Run(id)
 		pluginMetrics := s.plugins.Flush(id)
 		for metricName, metric := range *pluginMetrics {
@@ -183,7 +198,7 @@ func (s *Server) encodeResponse(m *cgm.Metrics, w http.ResponseWriter, r *http.R
 		s.logger.Debug().Bool("gzip", useGzip).Str("accept_encoding", acceptedEncodings).Msg("compressing response")
 	}
 
-	jsonData, err = json.Marshal(m)
+	jsonData, err = json.Marshal(encodableMetrics(m))
 	if err != nil {
 		// log the error and respond with empty metrics
 		s.logger.Error().
@@ -233,9 +248,59 @@ func (s *Server) encodeResponse(m *cgm.Metrics, w http.ResponseWriter, r *http.R
 	}
 }
 
-// inventory returns the current, active plugin inventory
+// encodableMetrics returns metrics ready to be encoded for the broker. Metric
+// values carrying a sample timestamp are emitted with a `_ts` attribute. The
+// metrics are returned untouched if none carry a timestamp.
+func encodableMetrics(m *cgm.Metrics) interface{} {
+	type timestampedMetric struct {
+		Timestamp uint64      `json:"_ts"`
+		Type      string      `json:"_type"`
+		Value     interface{} `json:"_value"`
+	}
+
+	haveTimestamps := false
+	for _, metric := range *m {
+		if _, ok := metric.Value.(tags.TimestampedValue); ok {
+			haveTimestamps = true
+			break
+		}
+	}
+	if !haveTimestamps {
+		return m
+	}
+
+	metrics := make(map[string]interface{}, len(*m))
+	for mn, metric := range *m {
+		if tv, ok := metric.Value.(tags.TimestampedValue); ok {
+			metrics[mn] = timestampedMetric{Timestamp: tv.Timestamp, Type: metric.Type, Value: tv.Value}
+			continue
+		}
+		metrics[mn] = metric
+	}
+
+	return metrics
+}
+
+// inventory returns the current, active plugin inventory. If a plugin
+// is specified (/inventory/<plugin>) the recent stderr output and run
+// history of the plugin are included.
 func (s *Server) inventory(w http.ResponseWriter, r *http.Request) {
-	inventory := s.plugins.Inventory()
+	id := ""
+
+	if strings.HasPrefix(r.URL.Path, "/inventory/") { // specific plugin
+		id = strings.Trim(strings.Replace(r.URL.Path, "/inventory/", "", -1), "/")
+		if id != "" && !s.plugins.IsValid(id) {
+			appstats.IncrementInt("requests_bad")
+			s.logger.Warn().
+				Str("method", r.Method).
+				Str("url", r.URL.String()).
+				Msg("Not found")
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	inventory := s.plugins.Inventory(id)
 	if inventory == nil {
 		inventory = []byte(`{"error": "empty inventory"}`)
 		s.logger.Error().Msg("inventory is nil/empty...")
@@ -332,6 +397,10 @@ func (s *Server) metricsToPromFormat(w io.Writer, prefix string, ts int64, val i
 	switch t := val.(type) {
 	case cgm.Metric:
 		metric := val.(cgm.Metric)
+		if tv, ok := metric.Value.(tags.TimestampedValue); ok {
+			metric.Value = tv.Value
+			ts = int64(tv.Timestamp)
+		}
 		sv := fmt.Sprintf("%v", metric.Value)
 		switch metric.Type {
 		case "i":
@@ -9,6 +9,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -23,6 +24,7 @@ import (
 	"github.com/circonus-labs/circonus-agent/internal/check"
 	"github.com/circonus-labs/circonus-agent/internal/config"
 	"github.com/circonus-labs/circonus-agent/internal/plugins"
+	"github.com/circonus-labs/circonus-agent/internal/tags"
 	cgm "github.com/circonus-labs/circonus-gometrics"
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
@@ -40,6 +42,9 @@ func TestRun(t *testing.T) {
 		{"/", http.StatusOK},
 		{"/run", http.StatusOK},
 		{"/run/test", http.StatusOK},
+		{"/run/test,write", http.StatusOK},
+		{"/run/test,foo", http.StatusNotFound},
+		{"/run/collector:invalid", http.StatusNotFound},
 		{"/run/write", http.StatusOK},
 		{"/run/statsd", http.StatusOK},
 	}
@@ -130,6 +135,38 @@ func TestInventory(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
 	}
+
+	if err := p.Scan(nil); err != nil {
+		t.Fatalf("expected NO error, got (%s)", err)
+	}
+
+	t.Logf("GET /inventory/test -> %d", http.StatusOK)
+	{
+		req := httptest.NewRequest("GET", "/inventory/test", nil)
+		w := httptest.NewRecorder()
+
+		s.inventory(w, req)
+
+		resp := w.Result()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+	}
+
+	t.Logf("GET /inventory/invalid -> %d", http.StatusNotFound)
+	{
+		req := httptest.NewRequest("GET", "/inventory/invalid", nil)
+		w := httptest.NewRecorder()
+
+		s.inventory(w, req)
+
+		resp := w.Result()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected %d, got %d", http.StatusNotFound, resp.StatusCode)
+		}
+	}
 }
 
 func TestWrite(t *testing.T) {
@@ -431,6 +468,39 @@ func TestPromOutput(t *testing.T) {
 	}
 }
 
+func TestEncodableMetrics(t *testing.T) {
+	t.Log("Testing encodableMetrics")
+
+	t.Log("no timestamps")
+	{
+		m := &cgm.Metrics{"foo": cgm.Metric{Type: "L", Value: uint64(1)}}
+		data, err := json.Marshal(encodableMetrics(m))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := `{"foo":{"_type":"L","_value":1}}`
+		if string(data) != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, string(data))
+		}
+	}
+
+	t.Log("w/timestamp")
+	{
+		m := &cgm.Metrics{
+			"foo": cgm.Metric{Type: "L", Value: uint64(1)},
+			"bar": cgm.Metric{Type: "n", Value: tags.TimestampedValue{Timestamp: 1530000000000, Value: []string{"H[1.0e+00]=1"}}},
+		}
+		data, err := json.Marshal(encodableMetrics(m))
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		expect := `{"bar":{"_ts":1530000000000,"_type":"n","_value":["H[1.0e+00]=1"]},"foo":{"_type":"L","_value":1}}`
+		if string(data) != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, string(data))
+		}
+	}
+}
+
 func TestMetricsToPromFormat(t *testing.T) {
 	t.Log("Testing metricsToPromFormat")
 	zerolog.SetGlobalLevel(zerolog.Disabled)
@@ -502,6 +572,24 @@ func TestMetricsToPromFormat(t *testing.T) {
 		}
 	}
 
+	t.Log("timestamped value")
+	{
+		mname := "m"
+		mtype := "i"
+		mval := 1
+		mts := uint64(67890)
+
+		var b bytes.Buffer
+		w := bufio.NewWriter(&b)
+		m := cgm.Metric{Type: mtype, Value: tags.TimestampedValue{Timestamp: mts, Value: mval}}
+		s.metricsToPromFormat(w, mname, ts, m)
+		w.Flush()
+		expect := fmt.Sprintf("%s %d %d\n", mname, mval, mts)
+		if b.String() != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, b.String())
+		}
+	}
+
 	t.Log("bad float conversion")
 	{
 		mname := "m"
@@ -124,6 +124,33 @@ func New(c *check.Check, b *builtins.Builtins, p *plugins.Plugins, ss *statsd.Se
 		}
 	}
 
+	// Admin socket listener (singular)
+	if addr := viper.GetString(config.KeyAdminSocket); addr != "" && runtime.GOOS != "windows" {
+		ua, err := net.ResolveUnixAddr("unix", addr)
+		if err != nil {
+			s.logger.Error().Err(err).Str("addr", addr).Msg("resolving address")
+			return nil, errors.Wrap(err, "Admin socket server")
+		}
+
+		if _, serr := os.Stat(ua.String()); serr == nil || !os.IsNotExist(serr) {
+			s.logger.Error().Str("socket_file", ua.String()).Msg("already exists")
+			return nil, errors.Errorf("Admin socket server file (%s) exists", ua.String())
+		}
+
+		// admin api, restricted to the user running the agent
+		ul, err := listenAdminSocket(ua)
+		if err != nil {
+			s.logger.Error().Err(err).Str("addr", ua.String()).Msg("creating admin socket")
+			return nil, errors.Wrap(err, "creating admin socket")
+		}
+
+		s.svrAdmin = &socketServer{
+			address:  ua,
+			listener: ul,
+			server:   &http.Server{Handler: http.HandlerFunc(s.adminHandler)},
+		}
+	}
+
 	// validation moved to New so, there will always be at least ONE http server
 	// if len(s.svrHTTP) == 0 && s.svrHTTPS == nil && len(s.svrSockets) == 0 {
 	// 	return nil, errors.New("No servers defined")
@@ -161,6 +188,12 @@ func (s *Server) Start() error {
 		})
 	}
 
+	if s.svrAdmin != nil {
+		s.t.Go(func() error {
+			return s.startSocket(s.svrAdmin)
+		})
+	}
+
 	// start a tomb dying listener so that if one server fails to start
 	// all other servers will be stopped. since http.servers don't have
 	// listen with context (yet) and will block waiting for a request
@@ -185,6 +218,9 @@ func (s *Server) Start() error {
 				svr.listener.Close()
 			}
 		}
+		if s.svrAdmin != nil && s.svrAdmin.server != nil {
+			s.svrAdmin.server.Close()
+		}
 
 	}()
 
@@ -220,6 +256,18 @@ func (s *Server) Stop() {
 		}
 	}
 
+	if s.svrAdmin != nil {
+		s.logger.Info().Str("server", s.svrAdmin.address.Name).Msg("Stopping Admin socket server")
+		err := s.svrAdmin.server.Shutdown(ctx)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("server", s.svrAdmin.address.Name).Msg("Closing Admin socket server")
+		}
+		// not removed by the listener, see listenAdminSocket
+		if err := os.Remove(s.svrAdmin.address.Name); err != nil && !os.IsNotExist(err) {
+			s.logger.Warn().Err(err).Str("server", s.svrAdmin.address.Name).Msg("Removing Admin socket")
+		}
+	}
+
 	if s.t.Alive() {
 		s.t.Kill(nil)
 	}
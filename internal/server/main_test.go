@@ -7,7 +7,9 @@ package server
 
 import (
 	"errors"
+	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"testing"
@@ -277,6 +279,44 @@ func TestNew(t *testing.T) {
 				s.svrSockets[0].listener.Close()
 			}
 		}
+
+		t.Log("Testing New w/Admin Socket")
+		{
+			t.Log("\tw/config (file exists)")
+			{
+				viper.Reset()
+				viper.Set(config.KeyAdminSocket, "testdata/exists.sock")
+				_, err := New(nil, nil, nil, nil)
+				if err == nil {
+					t.Fatal("expected error")
+				}
+			}
+
+			t.Log("\tw/valid config")
+			{
+				viper.Reset()
+				viper.Set(config.KeyAdminSocket, path.Join("testdata", "admin.sock"))
+				s, err := New(nil, nil, nil, nil)
+				if err != nil {
+					t.Fatalf("expected no error, got (%s)", err)
+				}
+				if s.svrAdmin == nil {
+					t.Fatal("expected admin socket")
+				}
+				fi, err := os.Stat(path.Join("testdata", "admin.sock"))
+				if err != nil {
+					t.Fatalf("expected no error, got (%s)", err)
+				}
+				if perm := fi.Mode().Perm(); perm != 0600 {
+					t.Fatalf("expected admin socket mode 0600, got %o", perm)
+				}
+				if tmp, _ := filepath.Glob(path.Join("testdata", ".admin*")); len(tmp) != 0 {
+					t.Fatalf("expected temporary socket directory to be removed, found %v", tmp)
+				}
+				s.svrAdmin.listener.Close()
+				os.Remove(path.Join("testdata", "admin.sock"))
+			}
+		}
 	}
 }
 
@@ -10,7 +10,6 @@ import (
 	"fmt"
 	"io"
 	stdlog "log"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -22,11 +21,6 @@ import (
 	"github.com/spf13/viper"
 )
 
-func init() {
-	histogramRx = regexp.MustCompile(`^H\[(?P<bucket>[^\]]+)\]=(?P<count>[0-9]+)$`)
-	histogramRxNames = histogramRx.SubexpNames()
-}
-
 func initCGM() error {
 	metricsmu.Lock()
 	defer metricsmu.Unlock()
@@ -284,71 +278,18 @@ func parseHistogram(metricName string, metric tags.JSONMetric) *[]histSample {
 			case float64:
 				ret = append(ret, histSample{bucket: false, value: v.(float64)})
 			case string:
-				sv := v.(string)
-				if !strings.Contains(sv, "H[") {
-					v2, err := strconv.ParseFloat(sv, 64)
-					if err != nil {
-						log.Error().
-							Str("pkg", "receiver").
-							Str("metric", metricName).
-							Interface("value", v).
-							Int("position", idx).
-							Err(err).
-							Msg("parsing histogram sample")
-						continue
-					}
-					ret = append(ret, histSample{bucket: false, value: float64(v2)})
-					continue
-				}
-
-				//
-				// it's an encoded histogram sample H[value]=count
-				//
-				bucket := ""
-				count := ""
-				matches := histogramRx.FindAllStringSubmatch(sv, -1)
-				for _, match := range matches {
-					for idx, val := range match {
-						switch histogramRxNames[idx] {
-						case "bucket":
-							bucket = val
-						case "count":
-							count = val
-						}
-					}
-				}
-				if bucket == "" || count == "" {
-					log.Error().
-						Str("pkg", "receiver").
-						Str("metric", metricName).
-						Str("sample", sv).
-						Int("position", idx).
-						Msg("invalid encoded histogram sample")
-					continue
-				}
-				b, err := strconv.ParseFloat(bucket, 64)
-				if err != nil {
-					log.Error().
-						Str("pkg", "receiver").
-						Str("metric", metricName).
-						Str("sample", sv).
-						Int("position", idx).
-						Err(err).
-						Msg("encoded histogram sample, value parse")
-					continue
-				}
-				c, err := strconv.ParseInt(count, 10, 64)
+				hs, err := tags.ParseHistogramSample(v.(string))
 				if err != nil {
 					log.Error().
 						Str("pkg", "receiver").
 						Str("metric", metricName).
-						Str("sample", sv).
+						Interface("value", v).
 						Int("position", idx).
 						Err(err).
-						Msg("encoded histogram sample, count parse")
+						Msg("parsing histogram sample")
 					continue
 				}
-				ret = append(ret, histSample{bucket: true, value: b, count: c})
+				ret = append(ret, histSample{bucket: hs.Bucket, value: hs.Value, count: hs.Count})
 			default:
 				log.Error().
 					Str("pkg", "receiver").
@@ -156,6 +156,58 @@ func TestRouter(t *testing.T) {
 		// zerolog.SetGlobalLevel(zerolog.Disabled)
 	}
 
+	t.Log("valid (nested plugin ids)")
+	{
+		viper.Reset()
+		viper.Set(config.KeyListen, ":2609")
+		viper.Set(config.KeyStatsdDisabled, true)
+		viper.Set(config.KeyPluginDir, "testdata/")
+		viper.Set(config.KeyPluginRecursive, true)
+		b, berr := builtins.New()
+		if berr != nil {
+			t.Fatalf("expected no error, got (%s)", berr)
+		}
+		p, perr := plugins.New(context.Background())
+		if perr != nil {
+			t.Fatalf("expected NO error, got (%s)", perr)
+		}
+		if serr := p.Scan(b); serr != nil {
+			t.Fatalf("expected no error, got (%s)", serr)
+		}
+		c, cerr := check.New(nil)
+		if cerr != nil {
+			t.Fatalf("expected no error, got (%s)", cerr)
+		}
+
+		s, err := New(c, b, p, nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		reqtests := []struct {
+			method string
+			path   string
+			code   int
+		}{
+			{"GET", "/run/nested%60test", http.StatusOK},
+			{"GET", "/run/test,nested%60test", http.StatusOK},
+			{"GET", "/run/nested%60invalid", http.StatusNotFound},
+			{"GET", "/inventory/nested%60test", http.StatusOK},
+			{"GET", "/inventory/nested%60invalid", http.StatusNotFound},
+		}
+
+		for _, reqtest := range reqtests {
+			t.Logf("Nested id path (%s %s)", reqtest.method, reqtest.path)
+			req := httptest.NewRequest(reqtest.method, reqtest.path, nil)
+			w := httptest.NewRecorder()
+			s.router(w, req)
+			resp := w.Result()
+			if resp.StatusCode != reqtest.code {
+				t.Fatalf("expected %d, got %d", reqtest.code, resp.StatusCode)
+			}
+		}
+		viper.Reset()
+	}
+
 	t.Log("invalid (PUT /write/foo) w/o data")
 	{
 		viper.Reset()
@@ -47,6 +47,7 @@ type Server struct {
 	ctx        context.Context
 	logger     zerolog.Logger
 	plugins    *plugins.Plugins
+	svrAdmin   *socketServer
 	svrHTTP    []*httpServer
 	svrHTTPS   *sslServer
 	svrSockets []*socketServer
@@ -60,11 +61,13 @@ type previousMetrics struct {
 }
 
 var (
-	pluginPathRx    = regexp.MustCompile("^/(run(/[a-zA-Z0-9_-]*)?)?$")
-	inventoryPathRx = regexp.MustCompile("^/inventory/?$")
+	pluginPathRx    = regexp.MustCompile("^/(run(/[a-zA-Z0-9_,:`-]*)?)?$")
+	inventoryPathRx = regexp.MustCompile("^/inventory(/[a-zA-Z0-9_`-]*)?/?$")
 	writePathRx     = regexp.MustCompile("^/write/[a-zA-Z0-9_-]+$")
 	statsPathRx     = regexp.MustCompile("^/stats/?$")
 	promPathRx      = regexp.MustCompile("^/prom/?$")
+	adminListRx     = regexp.MustCompile("^/(builtins|plugins)/?$")
+	adminActionRx   = regexp.MustCompile("^/(builtins|plugins)/([a-zA-Z0-9_`-]+)/(enable|disable|reload)/?$")
 	lastMetrics     = &previousMetrics{}
 	lastMeticsmu    sync.Mutex
 )
@@ -7,6 +7,7 @@ package tags
 
 import (
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -32,3 +33,60 @@ func PrepStreamTags(tagList string) (string, error) {
 
 	return "|ST[" + strings.Join(t, Separator) + "]", nil
 }
+
+// AddStreamTag adds a category:value tag to a metric name, merging it with
+// any stream tags already present on the metric name. The resulting tag
+// list is sorted, consistent with PrepStreamTags.
+func AddStreamTag(metricName, tag string) string {
+	if tag == "" {
+		return metricName
+	}
+
+	idx := strings.Index(metricName, "|ST[")
+	if idx == -1 || !strings.HasSuffix(metricName, "]") {
+		return metricName + "|ST[" + tag + "]"
+	}
+
+	t := strings.Split(metricName[idx+4:len(metricName)-1], Separator)
+	for _, existing := range t {
+		if existing == tag {
+			return metricName
+		}
+	}
+	t = append(t, tag)
+	sort.Strings(t)
+
+	return metricName[:idx] + "|ST[" + strings.Join(t, Separator) + "]"
+}
+
+// ParseHistogramSample parses a single histogram sample, either a raw value
+// (e.g. 1.2) or an encoded histogram bucket (e.g. H[1.2]=3).
+func ParseHistogramSample(sample string) (HistogramSample, error) {
+	sample = strings.TrimSpace(sample)
+
+	if !strings.HasPrefix(sample, "H[") {
+		v, err := strconv.ParseFloat(sample, 64)
+		if err != nil {
+			return HistogramSample{}, errors.Wrap(err, "histogram sample, value parse")
+		}
+		return HistogramSample{Value: v}, nil
+	}
+
+	//
+	// it's an encoded histogram sample H[value]=count
+	//
+	matches := histogramRx.FindStringSubmatch(sample)
+	if len(matches) != 3 {
+		return HistogramSample{}, errors.New("invalid encoded histogram sample")
+	}
+	b, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return HistogramSample{}, errors.Wrap(err, "encoded histogram sample, value parse")
+	}
+	c, err := strconv.ParseInt(matches[2], 10, 64)
+	if err != nil {
+		return HistogramSample{}, errors.Wrap(err, "encoded histogram sample, count parse")
+	}
+
+	return HistogramSample{Bucket: true, Count: c, Value: b}, nil
+}
@@ -47,3 +47,65 @@ func TestPrepStreamTags(t *testing.T) {
 		}
 	}
 }
+
+func TestAddStreamTag(t *testing.T) {
+	t.Log("Testing AddStreamTag")
+
+	tt := []struct {
+		name   string
+		metric string
+		tag    string
+		expect string
+	}{
+		{"no tag", "foo`bar", "", "foo`bar"},
+		{"no stream tags", "foo`bar", "c1:v1", "foo`bar|ST[c1:v1]"},
+		{"merge stream tags", "foo`bar|ST[dev:sda,c2:v2]", "c1:v1", "foo`bar|ST[c1:v1,c2:v2,dev:sda]"},
+		{"duplicate tag", "foo`bar|ST[c1:v1]", "c1:v1", "foo`bar|ST[c1:v1]"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\ttest -- %s (%s)", tst.name, tst.metric)
+
+		result := AddStreamTag(tst.metric, tst.tag)
+		if result != tst.expect {
+			t.Fatalf("expected (%s) got (%s)", tst.expect, result)
+		}
+	}
+}
+
+func TestParseHistogramSample(t *testing.T) {
+	t.Log("Testing ParseHistogramSample")
+
+	tt := []struct {
+		name        string
+		sample      string
+		expect      HistogramSample
+		shouldError bool
+	}{
+		{"value", "1", HistogramSample{Value: 1}, false},
+		{"value, whitespace", " 1.2 ", HistogramSample{Value: 1.2}, false},
+		{"bucket", "H[1.2]=3", HistogramSample{Bucket: true, Count: 3, Value: 1.2}, false},
+		{"bad value", "1a", HistogramSample{}, true},
+		{"bad bucket format", "H[1.2]", HistogramSample{}, true},
+		{"bad bucket value", "H[1.2b]=1", HistogramSample{}, true},
+		{"bad bucket count", "H[1.2]=1b", HistogramSample{}, true},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\ttest -- %s (%s)", tst.name, tst.sample)
+
+		hs, err := ParseHistogramSample(tst.sample)
+		if tst.shouldError {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected NO error, got (%s)", err)
+		}
+		if hs != tst.expect {
+			t.Fatalf("expected (%#v) got (%#v)", tst.expect, hs)
+		}
+	}
+}
@@ -9,14 +9,31 @@ import "regexp"
 
 // JSONMetric defines an individual metric received in JSON
 type JSONMetric struct {
-	Tags  []string    `json:"_tags"`
-	Type  string      `json:"_type"`
-	Value interface{} `json:"_value"`
+	Tags      []string    `json:"_tags"`
+	Timestamp uint64      `json:"_ts"`
+	Type      string      `json:"_type"`
+	Value     interface{} `json:"_value"`
 }
 
 // JSONMetrics holds list of JSON metrics
 type JSONMetrics map[string]JSONMetric
 
+// TimestampedValue is used as a metric value when the source of the metric
+// supplied the time the sample was observed. The timestamp is emitted as
+// the `_ts` attribute of the metric when metrics are sent to the broker.
+type TimestampedValue struct {
+	Timestamp uint64      // milliseconds since epoch
+	Value     interface{} // the actual metric value
+}
+
+// HistogramSample is a single histogram sample, either a raw value or an
+// encoded bucket (H[value]=count) as sent by cgm to /write and by plugins
+type HistogramSample struct {
+	Bucket bool    // sample is an encoded bucket
+	Count  int64   // number of samples in the bucket
+	Value  float64 // sample value or bucket value
+}
+
 const (
 	// Delimiter defines character separating category from value in a tag e.g. location:london
 	Delimiter = ":"
@@ -28,4 +45,7 @@ const (
 var (
 	valid   = regexp.MustCompile(`^[^:,]+:[^:,]+(,[^:,]+:[^:,]+)*$`)
 	cleaner = regexp.MustCompile(`[\[\]'"` + "`]")
+
+	// histogramRx encoded histogram sample (e.g. coming from a cgm put to /write)
+	histogramRx = regexp.MustCompile(`^H\[([^\]]+)\]=([0-9]+)$`)
 )